@@ -0,0 +1,116 @@
+// Package artifacts stores the artifacts collected from steps and serves them
+// for download.
+package artifacts
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mxinden/automation/configuration"
+	"k8s.io/api/core/v1"
+)
+
+const defaultImage = "curlimages/curl"
+
+// Store is where artifacts are kept. Artifacts are uploaded from within the
+// pods of steps, thus a store describes how to upload instead of uploading
+// itself.
+type Store interface {
+	// UploadCommand returns a shell command storing its standard input as
+	// the artifact with the given key.
+	UploadCommand(key string) (string, error)
+	// Volumes returns the volumes and their mounts the upload command needs.
+	Volumes() ([]v1.Volume, []v1.VolumeMount)
+	// Open returns the content of the artifact with the given key.
+	Open(key string) (io.ReadCloser, error)
+}
+
+// Object is an entry of a store, as listed by the List method of stores.
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ErrNotFound is returned by Open for unknown keys.
+var ErrNotFound = fmt.Errorf("artifact not found")
+
+// NewStore returns the configured store, or nil if artifacts are not
+// configured, as well as the image to collect artifacts with.
+func NewStore(c configuration.Artifacts) (Store, string, error) {
+	image := c.Image
+	if image == "" {
+		image = defaultImage
+	}
+
+	switch {
+	case c.S3 != nil:
+		store, err := NewS3Store(
+			*c.S3,
+			os.Getenv("ARTIFACTS_S3_ACCESS_KEY_ID"),
+			os.Getenv("ARTIFACTS_S3_SECRET_ACCESS_KEY"),
+		)
+		return store, image, err
+	case c.PVC != nil:
+		return NewPVCStore(*c.PVC), image, nil
+	}
+
+	return nil, image, nil
+}
+
+var validKey = regexp.MustCompile(`^[A-Za-z0-9._-]+(/[A-Za-z0-9._-]+)*$`)
+
+// ValidKey returns true for keys which can't escape the store, e.g. via "..".
+func ValidKey(key string) bool {
+	if !validKey.MatchString(key) {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// Handler serves the artifacts of the given store below the given path
+// prefix, e.g. /api/artifacts/. It does not authenticate requests, as the
+// links to artifacts are posted on pull requests: anyone who can reach the
+// server and knows the key of an artifact can download it. Steps must not
+// collect secrets as artifacts, and access needs to be restricted in front
+// of the server, e.g. by an authenticating proxy, where that is not enough.
+func Handler(store Store, prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, prefix)
+		if !ValidKey(key) {
+			http.Error(w, "invalid artifact key", http.StatusBadRequest)
+			return
+		}
+
+		content, err := store.Open(key)
+		if err == ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("Error opening artifact %v: %v", key, err)
+			http.Error(w, "error opening artifact", http.StatusInternalServerError)
+			return
+		}
+		defer content.Close()
+
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(key)))
+		_, err = io.Copy(w, content)
+		if err != nil {
+			log.Printf("Error serving artifact %v: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package artifacts
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/mxinden/automation/configuration"
+	"k8s.io/api/core/v1"
+)
+
+// pvcVolumeName names the volume of the claim in the pods of steps, which is
+// mounted at /<name>.
+const pvcVolumeName = "automation-artifact-store"
+
+// PVCStore keeps artifacts as files on a persistent volume claim.
+type PVCStore struct {
+	claimName  string
+	mountPath  string
+	volumeName string
+}
+
+func NewPVCStore(c configuration.PVCStorage) *PVCStore {
+	return NewNamedPVCStore(c, pvcVolumeName)
+}
+
+// NewNamedPVCStore returns a store whose volume has the given name, so
+// multiple stores can be mounted into the same pod.
+func NewNamedPVCStore(c configuration.PVCStorage, volumeName string) *PVCStore {
+	return &PVCStore{claimName: c.ClaimName, mountPath: c.MountPath, volumeName: volumeName}
+}
+
+// podPath returns the path of the given key within pods.
+func (s *PVCStore) podPath(key string) string {
+	return path.Join("/", s.volumeName, key)
+}
+
+func (s *PVCStore) UploadCommand(key string) (string, error) {
+	file := s.podPath(key)
+	return "mkdir -p '" + path.Dir(file) + "' && cat > '" + file + "'", nil
+}
+
+func (s *PVCStore) DownloadCommand(key string) (string, error) {
+	return "cat '" + s.podPath(key) + "'", nil
+}
+
+func (s *PVCStore) Volumes() ([]v1.Volume, []v1.VolumeMount) {
+	volume := v1.Volume{
+		Name: s.volumeName,
+		VolumeSource: v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: s.claimName},
+		},
+	}
+	mount := v1.VolumeMount{Name: volume.Name, MountPath: s.podPath("")}
+
+	return []v1.Volume{volume}, []v1.VolumeMount{mount}
+}
+
+func (s *PVCStore) Open(key string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.mountPath, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *PVCStore) List() ([]Object, error) {
+	objects := []Object{}
+
+	err := filepath.Walk(s.mountPath, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		key, err := filepath.Rel(s.mountPath, file)
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, Object{
+			Key:          filepath.ToSlash(key),
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+
+	return objects, err
+}
+
+func (s *PVCStore) Delete(key string) error {
+	err := os.Remove(filepath.Join(s.mountPath, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,262 @@
+package artifacts
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mxinden/automation/configuration"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	// uploadURLExpiry bounds the time between creating the pod of a step
+	// and its artifacts being uploaded.
+	uploadURLExpiry = 24 * time.Hour
+	// requestTimeout bounds requests to the object store including reading
+	// their response. It matches the write timeout of the server, as
+	// artifacts are streamed from the object store to their downloader.
+	requestTimeout = 10 * time.Minute
+)
+
+// S3Store keeps artifacts in a bucket of an S3 compatible object store. Pods
+// upload via presigned URLs, thus they never see the credentials.
+type S3Store struct {
+	endpoint        *url.URL
+	bucket          string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	client          *http.Client
+	now             func() time.Time
+}
+
+func NewS3Store(c configuration.S3, accessKeyID, secretAccessKey string) (*S3Store, error) {
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid s3 endpoint")
+	}
+
+	if c.Bucket == "" {
+		return nil, errors.New("missing s3 bucket")
+	}
+
+	region := c.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &S3Store{
+		endpoint:        endpoint,
+		bucket:          c.Bucket,
+		region:          region,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		client:          &http.Client{Timeout: requestTimeout},
+		now:             time.Now,
+	}, nil
+}
+
+func (s *S3Store) UploadCommand(key string) (string, error) {
+	u := s.presign("PUT", key, nil, uploadURLExpiry)
+	return "curl -sSf -T - '" + u + "'", nil
+}
+
+func (s *S3Store) DownloadCommand(key string) (string, error) {
+	u := s.presign("GET", key, nil, uploadURLExpiry)
+	return "curl -sSf '" + u + "'", nil
+}
+
+func (s *S3Store) Volumes() ([]v1.Volume, []v1.VolumeMount) {
+	return nil, nil
+}
+
+func (s *S3Store) Open(key string) (io.ReadCloser, error) {
+	resp, err := s.client.Get(s.presign("GET", key, nil, time.Minute))
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	resp.Body.Close()
+	return nil, fmt.Errorf("failed to get artifact %v: object store responded with %v", key, resp.Status)
+}
+
+// listBucketResult is the response of ListObjectsV2.
+type listBucketResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *S3Store) List() ([]Object, error) {
+	objects := []Object{}
+	query := map[string]string{"list-type": "2"}
+
+	for {
+		resp, err := s.client.Get(s.presign("GET", "", query, time.Minute))
+		if err != nil {
+			return objects, err
+		}
+
+		result := listBucketResult{}
+		if resp.StatusCode == http.StatusOK {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		} else {
+			err = fmt.Errorf("failed to list objects: object store responded with %v", resp.Status)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return objects, err
+		}
+
+		for _, c := range result.Contents {
+			objects = append(objects, Object{Key: c.Key, Size: c.Size, LastModified: c.LastModified})
+		}
+
+		if !result.IsTruncated {
+			return objects, nil
+		}
+		query["continuation-token"] = result.NextContinuationToken
+	}
+}
+
+func (s *S3Store) Delete(key string) error {
+	req, err := http.NewRequest("DELETE", s.presign("DELETE", key, nil, time.Minute), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to delete %v: object store responded with %v", key, resp.Status)
+	}
+	return nil
+}
+
+// presign returns a URL granting the given method on the object with the given
+// key, or on the bucket if the key is empty, signed with AWS signature version
+// 4.
+func (s *S3Store) presign(method, key string, query map[string]string, expiry time.Duration) string {
+	p := "/" + s.bucket
+	if key != "" {
+		p = p + "/" + key
+	}
+
+	return presignV4(
+		method,
+		s.endpoint.Scheme,
+		s.endpoint.Host,
+		p,
+		query,
+		s.region,
+		s.accessKeyID,
+		s.secretAccessKey,
+		s.now().UTC(),
+		expiry,
+	)
+}
+
+func presignV4(method, scheme, host, path string, parameters map[string]string, region, accessKeyID, secretAccessKey string, now time.Time, expiry time.Duration) string {
+	date := now.Format("20060102")
+	scope := date + "/" + region + "/s3/aws4_request"
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    accessKeyID + "/" + scope,
+		"X-Amz-Date":          now.Format("20060102T150405Z"),
+		"X-Amz-Expires":       fmt.Sprint(int(expiry.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	for name, value := range parameters {
+		query[name] = value
+	}
+
+	names := []string{}
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := []string{}
+	for _, name := range names {
+		pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(query[name], true))
+	}
+	canonicalQuery := strings.Join(pairs, "&")
+	canonicalPath := uriEncode(path, false)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalPath,
+		canonicalQuery,
+		"host:" + host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		query["X-Amz-Date"],
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return scheme + "://" + host + canonicalPath + "?" + canonicalQuery + "&X-Amz-Signature=" + signature
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode encodes all but unreserved characters as required by signature
+// version 4. Slashes are kept in paths.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+// Package cache keeps directories of steps across executions, e.g. downloaded
+// dependencies, and evicts them by age and size.
+package cache
+
+import (
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/mxinden/automation/artifacts"
+	"github.com/mxinden/automation/configuration"
+)
+
+const (
+	defaultImage = "curlimages/curl"
+	// volumeName distinguishes the volume of a PVC store from the one of
+	// the artifact store within the same pod.
+	volumeName = "automation-cache-store"
+)
+
+// Store is where caches are kept. Like artifacts, caches are restored and saved
+// from within the pods of steps.
+type Store interface {
+	artifacts.Store
+	// DownloadCommand returns a shell command writing the cache with the
+	// given key to its standard output. It fails if there is no such cache.
+	DownloadCommand(key string) (string, error)
+	List() ([]artifacts.Object, error)
+	Delete(key string) error
+}
+
+// NewStore returns the configured store, or nil if caches are not configured,
+// as well as the image to restore and save caches with.
+func NewStore(c configuration.Caches) (Store, string, error) {
+	image := c.Image
+	if image == "" {
+		image = defaultImage
+	}
+
+	switch {
+	case c.S3 != nil:
+		store, err := artifacts.NewS3Store(
+			*c.S3,
+			os.Getenv("CACHES_S3_ACCESS_KEY_ID"),
+			os.Getenv("CACHES_S3_SECRET_ACCESS_KEY"),
+		)
+		return store, image, err
+	case c.PVC != nil:
+		return artifacts.NewNamedPVCStore(*c.PVC, volumeName), image, nil
+	}
+
+	return nil, image, nil
+}
+
+// Evict deletes all caches saved longer than maxAge ago, then the least
+// recently saved ones until all caches together are at most maxSize. Zero
+// values disable the respective eviction. It returns the keys of the deleted
+// caches. Every object of the store is considered a cache, thus the store
+// must not be shared, see configuration.Caches.
+func Evict(store Store, maxAge time.Duration, maxSize int64, now time.Time) ([]string, error) {
+	evicted := []string{}
+
+	objects, err := store.List()
+	if err != nil {
+		return evicted, err
+	}
+
+	// Newest first, so the oldest ones exceed the maximum size.
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].LastModified.After(objects[j].LastModified)
+	})
+
+	var size int64
+	for _, o := range objects {
+		size = size + o.Size
+
+		tooOld := maxAge != 0 && now.Sub(o.LastModified) > maxAge
+		tooLarge := maxSize != 0 && size > maxSize
+		if !tooOld && !tooLarge {
+			continue
+		}
+
+		err = store.Delete(o.Key)
+		if err != nil {
+			return evicted, err
+		}
+		evicted = append(evicted, o.Key)
+	}
+
+	return evicted, nil
+}
+
+// EvictPeriodically runs Evict every interval, forever.
+func EvictPeriodically(store Store, maxAge time.Duration, maxSize int64, interval time.Duration) {
+	if maxAge == 0 && maxSize == 0 {
+		return
+	}
+
+	for {
+		evicted, err := Evict(store, maxAge, maxSize, time.Now())
+		if err != nil {
+			log.Printf("Error evicting caches: %v", err)
+		}
+		if len(evicted) != 0 {
+			log.Printf("Evicted caches %v", evicted)
+		}
+
+		time.Sleep(interval)
+	}
+}
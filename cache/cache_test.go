@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mxinden/automation/artifacts"
+)
+
+type fakeStore struct {
+	artifacts.Store
+	objects []artifacts.Object
+}
+
+func (s *fakeStore) DownloadCommand(key string) (string, error) {
+	return "", nil
+}
+
+func (s *fakeStore) List() ([]artifacts.Object, error) {
+	return append([]artifacts.Object{}, s.objects...), nil
+}
+
+func (s *fakeStore) Delete(key string) error {
+	rest := []artifacts.Object{}
+	for _, o := range s.objects {
+		if o.Key != key {
+			rest = append(rest, o)
+		}
+	}
+	s.objects = rest
+	return nil
+}
+
+func TestEvict(t *testing.T) {
+	now := time.Date(2019, 1, 10, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name     string
+		maxAge   time.Duration
+		maxSize  int64
+		expected []string
+	}{
+		{"disabled", 0, 0, []string{}},
+		{"by age", 5 * day, 0, []string{"old"}},
+		{"by size", 0, 25, []string{"middle", "old"}},
+		{"by age and size", 5 * day, 35, []string{"old"}},
+	}
+
+	for _, test := range tests {
+		store := &fakeStore{objects: []artifacts.Object{
+			{Key: "old", Size: 10, LastModified: now.Add(-7 * day)},
+			{Key: "new", Size: 20, LastModified: now.Add(-1 * day)},
+			{Key: "middle", Size: 10, LastModified: now.Add(-3 * day)},
+		}}
+
+		evicted, err := Evict(store, test.maxAge, test.maxSize, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sort.Strings(evicted)
+		if !reflect.DeepEqual(evicted, test.expected) {
+			t.Fatalf("%v: expected %v to be evicted but got %v", test.name, test.expected, evicted)
+		}
+		if len(store.objects) != 3-len(test.expected) {
+			t.Fatalf("%v: expected evicted caches to be deleted but got %v", test.name, store.objects)
+		}
+	}
+}
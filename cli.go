@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/mxinden/automation/connector/github"
+	"github.com/mxinden/automation/executor"
+	"github.com/mxinden/automation/executor/docker"
+	"github.com/mxinden/automation/executor/kubernetes"
+)
+
+const usage = `Usage: automation [command]
+
+Without a command the server is started.
+
+Commands:
+  validate <file>   check a pipeline configuration
+  render <file>     print the Kubernetes jobs of a pipeline configuration
+  run <file>        execute a pipeline configuration against the current kubeconfig
+                    or, with --executor docker, a local docker daemon
+  schema            print the JSON Schema of pipeline configurations
+`
+
+// runCommand runs the given subcommand and exits with its status.
+func runCommand(command string, args []string) {
+	var err error
+
+	switch command {
+	case "validate":
+		err = validateCommand(args)
+	case "render":
+		err = renderCommand(args)
+	case "run":
+		err = runPipelineCommand(args)
+	case "schema":
+		err = schemaCommand()
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%v", command, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// gitFlags are the flags of the commands preparing a configuration the way the
+// server would for a given commit.
+type gitFlags struct {
+	repositoryURL string
+	branch        string
+	sha           string
+	event         string
+	changedFiles  string
+}
+
+func (g *gitFlags) register(f *flag.FlagSet) {
+	f.StringVar(&g.repositoryURL, "repository-url", "", "value of GIT_REPOSITORY_URL")
+	f.StringVar(&g.branch, "branch", "master", "value of GIT_BRANCH_NAME, matched against when.branches")
+	f.StringVar(&g.sha, "sha", "", "value of GIT_SHA")
+	f.StringVar(&g.event, "event", executor.EventPush, "event matched against when.events")
+	f.StringVar(&g.changedFiles, "changed-files", "", "comma separated files matched against when.paths")
+}
+
+func (g *gitFlags) conditionContext() executor.ConditionContext {
+	changedFiles := []string{}
+	for _, file := range strings.Split(g.changedFiles, ",") {
+		if file != "" {
+			changedFiles = append(changedFiles, file)
+		}
+	}
+
+	return executor.ConditionContext{
+		Branch:       g.branch,
+		Event:        g.event,
+		ChangedFiles: changedFiles,
+	}
+}
+
+// parseFileArgument parses the flags of the given command followed by exactly
+// one file.
+func parseFileArgument(f *flag.FlagSet, args []string) (string, error) {
+	err := f.Parse(args)
+	if err != nil {
+		return "", err
+	}
+
+	if f.NArg() != 1 {
+		return "", fmt.Errorf("expected exactly one file but got %v arguments", f.NArg())
+	}
+
+	return f.Arg(0), nil
+}
+
+// readConfiguration validates and decodes the given file.
+func readConfiguration(path string) (executor.ExecutionConfiguration, error) {
+	var config executor.ExecutionConfiguration
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	err = executor.ValidateExecutionConfiguration(raw)
+	if validationErrors, ok := err.(executor.ValidationErrors); ok {
+		return config, formatValidationErrors(path, validationErrors)
+	}
+	if err != nil {
+		return config, err
+	}
+
+	return executor.DecodeExecutionConfiguration(bytes.NewReader(raw))
+}
+
+// formatValidationErrors prefixes each error with its file and location, like
+// compilers do.
+func formatValidationErrors(path string, errs executor.ValidationErrors) error {
+	lines := []string{}
+	for _, err := range errs {
+		if err.Line == 0 {
+			lines = append(lines, fmt.Sprintf("%v: %v", path, err.Error()))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%v:%v:%v: %v: %v", path, err.Line, err.Column, err.Path, err.Message))
+	}
+	return fmt.Errorf("%v", strings.Join(lines, "\n"))
+}
+
+func validateCommand(args []string) error {
+	f := flag.NewFlagSet("validate", flag.ExitOnError)
+	path, err := parseFileArgument(f, args)
+	if err != nil {
+		return err
+	}
+
+	_, err = readConfiguration(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%v is valid\n", path)
+	return nil
+}
+
+func renderCommand(args []string) error {
+	f := flag.NewFlagSet("render", flag.ExitOnError)
+	g := gitFlags{}
+	g.register(f)
+	path, err := parseFileArgument(f, args)
+	if err != nil {
+		return err
+	}
+
+	config, err := readConfiguration(path)
+	if err != nil {
+		return err
+	}
+
+	config, err = github.PrepareConfiguration(config, g.repositoryURL, g.sha, g.conditionContext())
+	if err != nil {
+		return err
+	}
+
+	for _, job := range kubernetes.RenderJobs(config) {
+		manifest, err := yaml.Marshal(job)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("---\n%v", string(manifest))
+	}
+
+	return nil
+}
+
+func runPipelineCommand(args []string) error {
+	f := flag.NewFlagSet("run", flag.ExitOnError)
+	g := gitFlags{}
+	g.register(f)
+	executorName := f.String("executor", "kubernetes", "executor to run the steps with, kubernetes or docker")
+	namespace := f.String("namespace", "default", "namespace to create the jobs in")
+	kubeconfig := f.String("kubeconfig", "", "path of the kubeconfig, defaults to $KUBECONFIG or ~/.kube/config")
+	kubeContext := f.String("context", "", "context of the kubeconfig to use, defaults to its current context")
+	dockerSocket := f.String("docker-socket", docker.DefaultSocketPath, "socket of the docker daemon")
+	path, err := parseFileArgument(f, args)
+	if err != nil {
+		return err
+	}
+
+	config, err := readConfiguration(path)
+	if err != nil {
+		return err
+	}
+
+	config, err = github.PrepareConfiguration(config, g.repositoryURL, g.sha, g.conditionContext())
+	if err != nil {
+		return err
+	}
+
+	var e executor.Executor
+	switch *executorName {
+	case "kubernetes":
+		kubernetesExecutor, err := kubernetes.NewKubernetesExecutor(*namespace, kubernetes.ClientOptions{
+			Kubeconfig: *kubeconfig,
+			Context:    *kubeContext,
+		})
+		if err != nil {
+			return err
+		}
+		e = &kubernetesExecutor
+	case "docker":
+		dockerExecutor := docker.NewDockerExecutor(*dockerSocket)
+		e = &dockerExecutor
+	default:
+		return fmt.Errorf("unknown executor %q, expected kubernetes or docker", *executorName)
+	}
+
+	return executePipeline(e, config, os.Stdout)
+}
+
+// executePipeline executes the given configuration and prints its result. It
+// fails if any step failed, so the command exits with a non-zero status.
+func executePipeline(e executor.Executor, config executor.ExecutionConfiguration, out io.Writer) error {
+	result, err := e.Execute(config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(out, formatExecutionResult(result))
+
+	if !result.DidSucceed() {
+		return fmt.Errorf("pipeline failed")
+	}
+	return nil
+}
+
+func formatExecutionResult(r executor.ExecutionResult) string {
+	var b strings.Builder
+
+	for stageI, stage := range r.Stages {
+		fmt.Fprintf(&b, "Stage %v\n", nameOrIndex(stage.Name, stageI))
+
+		for stepI, step := range stage.Steps {
+			name := nameOrIndex(step.Name, stepI)
+
+			switch {
+			case step.Skipped:
+				fmt.Fprintf(&b, "  Step %v skipped\n", name)
+				continue
+			case step.NotRun:
+				fmt.Fprintf(&b, "  Step %v not run\n", name)
+				continue
+			case step.DidSucceed():
+				fmt.Fprintf(&b, "  Step %v succeeded\n", name)
+			default:
+				fmt.Fprintf(&b, "  Step %v failed\n", name)
+			}
+
+			containers := []executor.ContainerResult{}
+			containers = append(containers, step.InitContainers...)
+			containers = append(containers, step.Containers...)
+			containers = append(containers, step.Services...)
+			for _, c := range containers {
+				fmt.Fprintf(&b, "    %v (%v) %v", c.Name, c.Image, c.State)
+				if c.State == executor.ContainerStateTerminated {
+					fmt.Fprintf(&b, " with exit code %v", c.ExitCode)
+				}
+				if c.Reason != "" {
+					fmt.Fprintf(&b, ": %v", c.Reason)
+				}
+				fmt.Fprintln(&b)
+			}
+
+			if len(step.TestSuites) != 0 {
+				passed, failed, skipped := executor.CountTestCases(step.TestSuites)
+				fmt.Fprintf(&b, "    tests: %v passed, %v failed, %v skipped\n", passed, failed, skipped)
+				for _, suite := range step.TestSuites {
+					for _, c := range suite.Failed() {
+						fmt.Fprintf(&b, "      FAIL %v %v\n", suite.Name, c.Name)
+					}
+				}
+			}
+
+			for _, line := range strings.Split(strings.TrimRight(step.Output, "\n"), "\n") {
+				fmt.Fprintf(&b, "    | %v\n", line)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func nameOrIndex(name string, i int) string {
+	if name == "" {
+		return fmt.Sprint(i)
+	}
+	return name
+}
+
+func schemaCommand() error {
+	schema, err := executor.JSONSchema()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(schema))
+	return nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mxinden/automation/executor"
+	"github.com/mxinden/automation/executor/fake"
+)
+
+func TestFormatExecutionResult(t *testing.T) {
+	r := executor.ExecutionResult{
+		Stages: []executor.StageResult{
+			{
+				Name: "test",
+				Steps: []executor.StepResult{
+					{Name: "docs", Skipped: true},
+					{
+						Name: "unit",
+						Containers: []executor.ContainerResult{
+							{Name: "go", Image: "golang", State: executor.ContainerStateTerminated, ExitCode: 1, Reason: "Error"},
+						},
+						TestSuites: []executor.TestSuiteResult{
+							{
+								Name: "pkg",
+								Cases: []executor.TestCaseResult{
+									{Name: "TestA", State: executor.TestStatePassed},
+									{Name: "TestB", State: executor.TestStateFailed},
+								},
+							},
+						},
+						Output: "--- FAIL: TestB\n",
+					},
+				},
+			},
+			{
+				Steps: []executor.StepResult{
+					{Containers: []executor.ContainerResult{{Name: "build", Image: "golang", State: executor.ContainerStateTerminated}}},
+					{Name: "deploy", NotRun: true},
+				},
+			},
+		},
+	}
+
+	expected := `Stage test
+  Step docs skipped
+  Step unit failed
+    go (golang) terminated with exit code 1: Error
+    tests: 1 passed, 1 failed, 0 skipped
+      FAIL pkg TestB
+    | --- FAIL: TestB
+Stage 1
+  Step 0 succeeded
+    build (golang) terminated with exit code 0
+    | 
+  Step deploy not run
+`
+
+	if output := formatExecutionResult(r); output != expected {
+		t.Fatalf("expected\n%v\nbut got\n%v", expected, output)
+	}
+}
+
+func TestFormatValidationErrors(t *testing.T) {
+	errs := executor.ValidationErrors{
+		{Line: 3, Column: 7, Path: "stages[0].steps[0].containers", Message: "is required"},
+		{Path: "stages[0].steps[1].image", Message: "is required"},
+	}
+
+	expected := "pipeline.yaml:3:7: stages[0].steps[0].containers: is required\n" +
+		"pipeline.yaml: stages[0].steps[1].image: is required"
+
+	if err := formatValidationErrors("pipeline.yaml", errs); err.Error() != expected {
+		t.Fatalf("expected\n%v\nbut got\n%v", expected, err)
+	}
+}
+
+func TestGitFlagsConditionContext(t *testing.T) {
+	f := flag.NewFlagSet("render", flag.ContinueOnError)
+	g := gitFlags{}
+	g.register(f)
+
+	err := f.Parse([]string{"-branch", "release/1.0", "-event", "tag", "-changed-files", "main.go,,docs/README.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := g.conditionContext()
+	if ctx.Branch != "release/1.0" || ctx.Event != executor.EventTag {
+		t.Fatalf("expected branch and event of the flags but got %+v", ctx)
+	}
+	if strings.Join(ctx.ChangedFiles, ",") != "main.go,docs/README.md" {
+		t.Fatalf("expected changed files main.go and docs/README.md but got %v", ctx.ChangedFiles)
+	}
+
+	f = flag.NewFlagSet("render", flag.ContinueOnError)
+	g = gitFlags{}
+	g.register(f)
+
+	ctx = g.conditionContext()
+	if ctx.Branch != "master" || ctx.Event != executor.EventPush || len(ctx.ChangedFiles) != 0 {
+		t.Fatalf("expected a push to master without changed files by default but got %+v", ctx)
+	}
+}
+
+// writePipeline writes the given configuration to a temporary file.
+func writePipeline(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "automation-config.yaml")
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const validPipeline = `
+stages:
+  - steps:
+      - name: test
+        containers:
+          - image: golang
+            command: go test ./...
+`
+
+const invalidPipeline = `
+stages:
+  - steps:
+      - name: test
+        containers:
+          - command: go test ./...
+`
+
+func TestReadConfiguration(t *testing.T) {
+	path := writePipeline(t, validPipeline)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	config, err := readConfiguration(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Stages) != 1 || config.Stages[0].Steps[0].Name != "test" {
+		t.Fatalf("expected the step of the file but got %+v", config)
+	}
+
+	invalid := writePipeline(t, invalidPipeline)
+	defer os.RemoveAll(filepath.Dir(invalid))
+
+	_, err = readConfiguration(invalid)
+	if err == nil || !strings.HasPrefix(err.Error(), invalid+":6:") {
+		t.Fatalf("expected validation errors located in %v but got %v", invalid, err)
+	}
+
+	_, err = readConfiguration(filepath.Join(filepath.Dir(path), "missing.yaml"))
+	if err == nil {
+		t.Fatal("expected missing file to fail")
+	}
+}
+
+func TestExecutePipeline(t *testing.T) {
+	path := writePipeline(t, validPipeline)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	config, err := readConfiguration(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	err = executePipeline(fake.NewFakeExecutor(), config, out)
+	if err != nil {
+		t.Fatalf("expected succeeding pipeline to succeed but got %v", err)
+	}
+	if !strings.Contains(out.String(), "Step test succeeded") {
+		t.Fatalf("expected result to be printed but got %v", out.String())
+	}
+
+	out.Reset()
+	failing := fake.NewFakeExecutor(fake.Rule{Command: "go test", ExitCode: 1})
+	err = executePipeline(failing, config, out)
+	if err == nil {
+		t.Fatal("expected failing pipeline to fail")
+	}
+	if !strings.Contains(out.String(), "Step test failed") {
+		t.Fatalf("expected result to be printed but got %v", out.String())
+	}
+}
+
+// TestRunCommandExitStatus runs the test binary itself as the command, as
+// runCommand exits the process.
+func TestRunCommandExitStatus(t *testing.T) {
+	if args := os.Getenv("AUTOMATION_TEST_COMMAND"); args != "" {
+		fields := strings.Fields(args)
+		runCommand(fields[0], fields[1:])
+		os.Exit(0)
+	}
+
+	valid := writePipeline(t, validPipeline)
+	defer os.RemoveAll(filepath.Dir(valid))
+	invalid := writePipeline(t, invalidPipeline)
+	defer os.RemoveAll(filepath.Dir(invalid))
+
+	tests := []struct {
+		args     string
+		exitCode int
+	}{
+		{"validate " + valid, 0},
+		{"validate " + invalid, 1},
+		{"validate", 1},
+		{"unknown", 2},
+	}
+
+	for _, tt := range tests {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestRunCommandExitStatus$")
+		cmd.Env = append(os.Environ(), "AUTOMATION_TEST_COMMAND="+tt.args)
+		err := cmd.Run()
+
+		exitCode := 0
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.Sys().(interface{ ExitStatus() int }).ExitStatus()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		if exitCode != tt.exitCode {
+			t.Fatalf("expected %q to exit with %v but got %v", tt.args, tt.exitCode, exitCode)
+		}
+	}
+}
@@ -2,13 +2,189 @@ package configuration
 
 import (
 	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
 
+	"github.com/mxinden/automation/executor"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
+const defaultShutdownGracePeriod = 25 * time.Second
+
 type Configuration struct {
 	Repositories []string `yaml:"repositories"`
 	Namespace    string   `yaml:"namespace"`
+	// Kubernetes configures how the server connects to Kubernetes.
+	Kubernetes Kubernetes `yaml:"kubernetes"`
+	// Clusters are the clusters steps can run in, selected by the cluster or
+	// clusterSelector of a step. Steps selecting neither run in the first
+	// cluster. Without clusters, all steps run in the cluster configured by
+	// Kubernetes and Namespace.
+	Clusters []Cluster `yaml:"clusters"`
+	// GithubAPIURL is the base URL of the GitHub API, e.g. of a GitHub
+	// Enterprise instance. Defaults to https://api.github.com/.
+	GithubAPIURL string `yaml:"githubAPIURL"`
+	// ExternalURL is the URL the server is reachable at, used for links
+	// e.g. to artifacts.
+	ExternalURL string      `yaml:"externalURL"`
+	Resources   Resources   `yaml:"resources"`
+	Artifacts   Artifacts   `yaml:"artifacts"`
+	Caches      Caches      `yaml:"caches"`
+	TestReports TestReports `yaml:"testReports"`
+	Masking     Masking     `yaml:"masking"`
+	Isolation   Isolation   `yaml:"isolation"`
+	// ShutdownGracePeriod is the time running executions get to finish once
+	// the server is asked to terminate, e.g. "9m". Defaults to 25s, within
+	// the default termination grace period of Kubernetes.
+	ShutdownGracePeriod string `yaml:"shutdownGracePeriod"`
+	// DefaultPolicy restricts the configurations of repositories without a
+	// policy of their own. Without either, a repository can request
+	// anything.
+	DefaultPolicy *executor.Policy `yaml:"defaultPolicy"`
+	// Policies restrict the configurations of repositories by repository,
+	// e.g. "github.com/mxinden/automation".
+	Policies map[string]executor.Policy `yaml:"policies"`
+}
+
+// Kubernetes configures the client of the Kubernetes API. Without InCluster,
+// Kubeconfig and Context, the in-cluster configuration is used when running in
+// a cluster and the kubeconfig otherwise.
+type Kubernetes struct {
+	InCluster bool `yaml:"inCluster"`
+	// Kubeconfig is the path of a kubeconfig file. Defaults to $KUBECONFIG
+	// or ~/.kube/config.
+	Kubeconfig string `yaml:"kubeconfig"`
+	// Context is the context of the kubeconfig to use.
+	Context string `yaml:"context"`
+	// QPS and Burst limit the requests to the API server.
+	QPS   float32 `yaml:"qps"`
+	Burst int     `yaml:"burst"`
+}
+
+// Cluster configures a Kubernetes cluster steps can run in.
+type Cluster struct {
+	Name string `yaml:"name"`
+	// Labels are matched against the clusterSelector of steps, e.g.
+	// "arch: arm64".
+	Labels map[string]string `yaml:"labels"`
+	// Namespace defaults to the namespace of the configuration.
+	Namespace  string `yaml:"namespace"`
+	Kubernetes `yaml:",inline"`
+	// MaxConcurrentJobs limits the jobs running in the cluster at once.
+	// Zero means no limit.
+	MaxConcurrentJobs int `yaml:"maxConcurrentJobs"`
+}
+
+// Resources configures the compute resources of all containers executed on
+// behalf of the configured repositories. Quantities are given in the
+// Kubernetes notation, e.g. "500m" cpu or "2Gi" memory.
+type Resources struct {
+	// DefaultRequests and DefaultLimits apply to containers not specifying
+	// a request or limit for the respective resource themselves.
+	DefaultRequests map[string]string `yaml:"defaultRequests"`
+	DefaultLimits   map[string]string `yaml:"defaultLimits"`
+	// Max caps the requests and limits a repository can configure.
+	Max map[string]string `yaml:"max"`
+}
+
+// Artifacts configures where artifacts of steps are stored, either in an S3
+// compatible object store or on a persistent volume claim. Without either,
+// artifacts are not collected. Stored artifacts are served unauthenticated at
+// /api/artifacts/ to anyone knowing their link.
+type Artifacts struct {
+	// Image collects and uploads artifacts. It needs a shell, tar and
+	// curl. Defaults to curlimages/curl.
+	Image string      `yaml:"image"`
+	S3    *S3         `yaml:"s3"`
+	PVC   *PVCStorage `yaml:"pvc"`
+}
+
+// S3 configures an S3 compatible object store, e.g. MinIO. The credentials
+// are taken from the ARTIFACTS_S3_ACCESS_KEY_ID and
+// ARTIFACTS_S3_SECRET_ACCESS_KEY environment variables.
+type S3 struct {
+	// Endpoint is the URL of the object store, e.g. http://minio:9000.
+	// Buckets are addressed by path.
+	Endpoint string `yaml:"endpoint"`
+	Bucket   string `yaml:"bucket"`
+	Region   string `yaml:"region"`
+}
+
+// PVCStorage stores artifacts on a persistent volume claim, mounted both into
+// the pods of steps and into the server.
+type PVCStorage struct {
+	ClaimName string `yaml:"claimName"`
+	// MountPath is the path the claim is mounted at in the server.
+	MountPath string `yaml:"mountPath"`
+}
+
+// Caches configures where the caches of steps are stored, either in an S3
+// compatible object store or on a persistent volume claim, which must not be
+// the one of artifacts. Without either, caches are neither restored nor saved. The credentials of S3 are taken from
+// the CACHES_S3_ACCESS_KEY_ID and CACHES_S3_SECRET_ACCESS_KEY environment
+// variables.
+type Caches struct {
+	// Image restores and saves caches. It needs a shell, tar and curl.
+	// Defaults to curlimages/curl.
+	Image string      `yaml:"image"`
+	S3    *S3         `yaml:"s3"`
+	PVC   *PVCStorage `yaml:"pvc"`
+	// MaxAge evicts caches saved longer ago, e.g. "168h".
+	MaxAge string `yaml:"maxAge"`
+	// MaxSize evicts the least recently saved caches once all caches
+	// together exceed it, e.g. "50Gi".
+	MaxSize string `yaml:"maxSize"`
+}
+
+// TestReports configures collecting the report files of steps.
+type TestReports struct {
+	// Image prints report files to its logs. It needs a shell and base64.
+	// Defaults to busybox.
+	Image string `yaml:"image"`
+}
+
+// Isolation configures running each execution in a namespace of its own,
+// which is deleted afterwards. The server needs to be allowed to manage
+// namespaces and the objects within them.
+type Isolation struct {
+	Namespaces bool `yaml:"namespaces"`
+	// Quota limits the resources of each execution, e.g. "requests.cpu" or
+	// "pods", in the Kubernetes notation.
+	Quota map[string]string `yaml:"quota"`
+	// BlockedCIDRs are the IP ranges executions can't connect to. They are
+	// required, as only blocking the pod and service networks of the
+	// cluster keeps executions from reaching pods of other namespaces.
+	BlockedCIDRs []string `yaml:"blockedCIDRs"`
+}
+
+// Masking configures values redacted from the results of steps, on top of the
+// values of the secrets the steps reference via environment variables or
+// volumes.
+type Masking struct {
+	// Secrets names secrets in the namespace, all values of which are
+	// masked.
+	Secrets []string `yaml:"secrets"`
+	// Env names environment variables of the server, the values of which
+	// are masked.
+	Env []string `yaml:"env"`
+}
+
+// Values returns the values of the environment variables to mask.
+func (m *Masking) Values() []string {
+	values := []string{}
+	for _, name := range m.Env {
+		if value := os.Getenv(name); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
 }
 
 func Parse() (Configuration, error) {
@@ -23,9 +199,262 @@ func Parse() (Configuration, error) {
 		return config, err
 	}
 
+	if config.GithubAPIURL != "" {
+		_, err = url.Parse(config.GithubAPIURL)
+		if err != nil {
+			return config, errors.Wrap(err, "invalid githubAPIURL")
+		}
+	}
+
+	if config.Artifacts.S3 != nil && config.Artifacts.PVC != nil {
+		return config, errors.New("artifacts can either be stored in s3 or on a pvc, not both")
+	}
+
+	if config.Caches.S3 != nil && config.Caches.PVC != nil {
+		return config, errors.New("caches can either be stored in s3 or on a pvc, not both")
+	}
+
+	err = config.validateStores()
+	if err != nil {
+		return config, err
+	}
+
+	_, _, err = config.Caches.Eviction()
+	if err != nil {
+		return config, err
+	}
+
+	_, err = config.ShutdownGracePeriodDuration()
+	if err != nil {
+		return config, err
+	}
+
+	err = config.validateClusters()
+	if err != nil {
+		return config, err
+	}
+
+	err = config.validateIsolation()
+	if err != nil {
+		return config, err
+	}
+
+	err = config.validatePolicies()
+	if err != nil {
+		return config, err
+	}
+
+	// Catch invalid quantities on startup instead of on first execution.
+	_, err = config.Resources.Defaults()
+	if err != nil {
+		return config, err
+	}
+	_, err = config.Resources.Maximum()
+	if err != nil {
+		return config, err
+	}
+
 	return config, nil
 }
 
+func (r *Resources) Defaults() (v1.ResourceRequirements, error) {
+	requests, err := toResourceList(r.DefaultRequests)
+	if err != nil {
+		return v1.ResourceRequirements{}, errors.Wrap(err, "failed to parse default requests")
+	}
+
+	limits, err := toResourceList(r.DefaultLimits)
+	if err != nil {
+		return v1.ResourceRequirements{}, errors.Wrap(err, "failed to parse default limits")
+	}
+
+	return v1.ResourceRequirements{Requests: requests, Limits: limits}, nil
+}
+
+func (r *Resources) Maximum() (v1.ResourceList, error) {
+	max, err := toResourceList(r.Max)
+	if err != nil {
+		return max, errors.Wrap(err, "failed to parse maximum resources")
+	}
+	return max, nil
+}
+
+// ShutdownGracePeriodDuration returns the parsed ShutdownGracePeriod.
+func (c *Configuration) ShutdownGracePeriodDuration() (time.Duration, error) {
+	if c.ShutdownGracePeriod == "" {
+		return defaultShutdownGracePeriod, nil
+	}
+
+	d, err := time.ParseDuration(c.ShutdownGracePeriod)
+	if err != nil {
+		return d, errors.Wrap(err, "invalid shutdownGracePeriod")
+	}
+	return d, nil
+}
+
+// ExecutionClusters returns the clusters steps can run in, with defaults
+// applied. Without configured clusters, it returns a single cluster named
+// "default".
+func (c *Configuration) ExecutionClusters() []Cluster {
+	if len(c.Clusters) == 0 {
+		return []Cluster{{Name: "default", Namespace: c.Namespace, Kubernetes: c.Kubernetes}}
+	}
+
+	clusters := []Cluster{}
+	for _, cluster := range c.Clusters {
+		if cluster.Namespace == "" {
+			cluster.Namespace = c.Namespace
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+func (c *Configuration) validateClusters() error {
+	names := map[string]bool{}
+	for _, cluster := range c.Clusters {
+		if cluster.Name == "" {
+			return errors.New("clusters need a name")
+		}
+		if names[cluster.Name] {
+			return errors.Errorf("duplicate cluster %v", cluster.Name)
+		}
+		names[cluster.Name] = true
+	}
+
+	// Persistent volume claims can only be mounted within their own
+	// cluster.
+	if len(c.Clusters) > 1 && (c.Artifacts.PVC != nil || c.Caches.PVC != nil) {
+		return errors.New("multiple clusters can't be combined with artifacts or caches on a pvc")
+	}
+
+	return nil
+}
+
+// validateStores rejects artifacts and caches sharing a bucket or claim, as
+// evicting caches deletes any object of their store.
+func (c *Configuration) validateStores() error {
+	a, b := c.Artifacts, c.Caches
+
+	if a.S3 != nil && b.S3 != nil && a.S3.Bucket == b.S3.Bucket &&
+		strings.TrimSuffix(a.S3.Endpoint, "/") == strings.TrimSuffix(b.S3.Endpoint, "/") {
+		return errors.Errorf("artifacts and caches can't share s3 bucket %v", a.S3.Bucket)
+	}
+
+	if a.PVC != nil && b.PVC != nil && a.PVC.ClaimName == b.PVC.ClaimName {
+		return errors.Errorf("artifacts and caches can't share pvc %v", a.PVC.ClaimName)
+	}
+
+	return nil
+}
+
+// ResourceQuota returns the hard limit of the resource quota of each
+// execution.
+func (i *Isolation) ResourceQuota() (v1.ResourceList, error) {
+	quota, err := toResourceList(i.Quota)
+	if err != nil {
+		return quota, errors.Wrap(err, "failed to parse isolation quota")
+	}
+	return quota, nil
+}
+
+func (c *Configuration) validateIsolation() error {
+	if !c.Isolation.Namespaces {
+		return nil
+	}
+
+	// Persistent volume claims can only be mounted within their own
+	// namespace.
+	if c.Artifacts.PVC != nil || c.Caches.PVC != nil {
+		return errors.New("isolated namespaces can't be combined with artifacts or caches on a pvc")
+	}
+
+	// Network policies can't deny egress by namespace, thus executions
+	// reach everything within the cluster not blocked by IP range.
+	if len(c.Isolation.BlockedCIDRs) == 0 {
+		return errors.New("isolated namespaces need blockedCIDRs, at least covering the pod and service networks of the cluster")
+	}
+
+	for _, cidr := range c.Isolation.BlockedCIDRs {
+		_, _, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return errors.Wrap(err, "invalid isolation blockedCIDRs")
+		}
+	}
+
+	_, err := c.Isolation.ResourceQuota()
+	return err
+}
+
+// Eviction returns the maximum age and the maximum total size of caches. Zero
+// values disable the respective eviction.
+func (c *Caches) Eviction() (time.Duration, int64, error) {
+	var maxAge time.Duration
+	var maxSize int64
+
+	if c.MaxAge != "" {
+		var err error
+		maxAge, err = time.ParseDuration(c.MaxAge)
+		if err != nil {
+			return maxAge, maxSize, errors.Wrap(err, "invalid caches maxAge")
+		}
+	}
+
+	if c.MaxSize != "" {
+		quantity, err := resource.ParseQuantity(c.MaxSize)
+		if err != nil {
+			return maxAge, maxSize, errors.Wrap(err, "invalid caches maxSize")
+		}
+		maxSize = quantity.Value()
+	}
+
+	return maxAge, maxSize, nil
+}
+
+func toResourceList(m map[string]string) (v1.ResourceList, error) {
+	list := v1.ResourceList{}
+
+	for name, value := range m {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return list, errors.Wrapf(err, "invalid quantity %v for %v", value, name)
+		}
+		list[v1.ResourceName(name)] = quantity
+	}
+
+	return list, nil
+}
+
+// PolicyFor returns the policy of the given repository, or nil if the
+// repository is not restricted.
+func (c *Configuration) PolicyFor(repository string) *executor.Policy {
+	if p, ok := c.Policies[repository]; ok {
+		return &p
+	}
+	return c.DefaultPolicy
+}
+
+func (c *Configuration) validatePolicies() error {
+	policies := map[string]executor.Policy{}
+	for repository, p := range c.Policies {
+		policies[repository] = p
+	}
+	if c.DefaultPolicy != nil {
+		policies["defaultPolicy"] = *c.DefaultPolicy
+	}
+
+	for name, p := range policies {
+		for _, pattern := range p.Images {
+			_, err := path.Match(pattern, "")
+			if err != nil {
+				return errors.Wrapf(err, "invalid image pattern %v in policy of %v", pattern, name)
+			}
+		}
+	}
+
+	return nil
+}
+
 func (c *Configuration) ContainsRepository(url string) bool {
 	if equalsAny(url, c.Repositories) {
 		return true
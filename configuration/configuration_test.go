@@ -0,0 +1,26 @@
+package configuration
+
+import "testing"
+
+func TestValidateStores(t *testing.T) {
+	c := Configuration{
+		Artifacts: Artifacts{S3: &S3{Endpoint: "http://minio:9000", Bucket: "automation"}},
+		Caches:    Caches{S3: &S3{Endpoint: "http://minio:9000/", Bucket: "automation"}},
+	}
+	if err := c.validateStores(); err == nil {
+		t.Fatal("expected artifacts and caches sharing a bucket to be rejected")
+	}
+
+	c.Caches.S3.Bucket = "caches"
+	if err := c.validateStores(); err != nil {
+		t.Fatalf("expected separate buckets to be accepted but got %v", err)
+	}
+
+	c = Configuration{
+		Artifacts: Artifacts{PVC: &PVCStorage{ClaimName: "automation"}},
+		Caches:    Caches{PVC: &PVCStorage{ClaimName: "automation"}},
+	}
+	if err := c.validateStores(); err == nil {
+		t.Fatal("expected artifacts and caches sharing a claim to be rejected")
+	}
+}
@@ -0,0 +1,354 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxinden/automation/configuration"
+	"github.com/mxinden/automation/connector/github/githubtest"
+	"github.com/mxinden/automation/executor"
+	"github.com/mxinden/automation/executor/fake"
+	"github.com/mxinden/automation/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	samplePayloadSHA = "24eed9c248bf63affc30be865986da27cdae12fe"
+	sampleConfig     = `stages:
+  - steps:
+      - name: test
+        containers:
+          - image: golang
+            command: go test ./...
+`
+)
+
+// triggerSamplePullRequest sends the sample pull request webhook, signed like
+// GitHub does, to a connector talking to the given fake GitHub API.
+func triggerSamplePullRequest(t *testing.T, server *githubtest.Server, f *fake.FakeExecutor) {
+	triggerSamplePullRequestWithConfiguration(t, server, f, configuration.Configuration{})
+}
+
+// triggerSamplePullRequestWithConfiguration is like triggerSamplePullRequest,
+// but with the given server configuration on top of the defaults.
+func triggerSamplePullRequestWithConfiguration(t *testing.T, server *githubtest.Server, f *fake.FakeExecutor, c configuration.Configuration) {
+	connector := newSampleConnector(server, f, c)
+
+	recorder := sendSamplePullRequest(t, &connector)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected webhook to be accepted but got %v: %v", recorder.Code, recorder.Body.String())
+	}
+}
+
+// newSampleConnector returns a connector for the sample project talking to
+// the given fake GitHub API, with the given server configuration on top of
+// the defaults.
+func newSampleConnector(server *githubtest.Server, f *fake.FakeExecutor, c configuration.Configuration) GithubConnector {
+	c.Repositories = []string{"github.com/mxinden/sample-project"}
+	c.GithubAPIURL = server.URL
+	c.ExternalURL = "https://automation.example.com"
+	return NewGithubConnector(c, f)
+}
+
+// sendSamplePullRequest sends the sample pull request webhook, signed like
+// GitHub does, to the given connector.
+func sendSamplePullRequest(t *testing.T, connector *GithubConnector) *httptest.ResponseRecorder {
+	secret := "secret"
+	os.Setenv("GITHUB_WEBHOOK_SECRET", secret)
+	defer os.Unsetenv("GITHUB_WEBHOOK_SECRET")
+
+	payload, err := ioutil.ReadFile("../../scripts/sample-github-payload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(payload)
+
+	req := httptest.NewRequest("POST", "/api/github/trigger", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", "pull_request")
+	req.Header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+
+	recorder := httptest.NewRecorder()
+	connector.TriggerHandler(recorder, req)
+	return recorder
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	m := dto.Metric{}
+	err := c.Write(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestPullRequestSuccess(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFile("mxinden", "sample-project", samplePayloadSHA, "automation-config.yaml", sampleConfig)
+	server.SetPullRequestFiles("mxinden", "sample-project", 1, []string{"README.md"})
+
+	succeeded := metrics.ExecutionsFinished.WithLabelValues("github.com/mxinden/sample-project", metrics.OutcomeSuccess)
+	succeededBefore := counterValue(t, succeeded)
+
+	f := fake.NewFakeExecutor(fake.Rule{Command: "go test", Output: "ok\n"})
+	triggerSamplePullRequest(t, server, f)
+
+	status, ok := server.WaitForStatus(samplePayloadSHA, 5*time.Second)
+	if !ok {
+		t.Fatalf("expected a final status but got %v", server.Statuses())
+	}
+	if status.State != string(ExecutionStatusSuccess) {
+		t.Fatalf("expected status success but got %v", status.State)
+	}
+
+	if counterValue(t, succeeded) != succeededBefore+1 {
+		t.Fatal("expected successful execution to be counted")
+	}
+
+	if server.Statuses()[0].State != string(ExecutionStatusPending) {
+		t.Fatalf("expected pending status first but got %v", server.Statuses()[0].State)
+	}
+
+	comments := server.Comments()
+	if len(comments) != 1 || comments[0].Number != 1 || !strings.Contains(comments[0].Body, "ok\n") {
+		t.Fatalf("expected result comment with logs on pull request 1 but got %+v", comments)
+	}
+
+	configurations := f.Configurations()
+	if len(configurations) != 1 {
+		t.Fatalf("expected 1 execution but got %v", len(configurations))
+	}
+	if !findEnvVarInConfig("GIT_SHA", samplePayloadSHA, configurations[0]) {
+		t.Fatalf("expected GIT_SHA to be passed to containers but got %+v", configurations[0])
+	}
+}
+
+func TestPullRequestFailure(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFile("mxinden", "sample-project", samplePayloadSHA, "automation-config.yaml", sampleConfig)
+
+	f := fake.NewFakeExecutor(fake.Rule{Command: "go test", ExitCode: 1, Output: "FAIL\n"})
+	triggerSamplePullRequest(t, server, f)
+
+	status, ok := server.WaitForStatus(samplePayloadSHA, 5*time.Second)
+	if !ok {
+		t.Fatalf("expected a final status but got %v", server.Statuses())
+	}
+	if status.State != string(ExecutionStatusFailure) {
+		t.Fatalf("expected status failure but got %v", status.State)
+	}
+}
+
+func TestPullRequestInvalidConfiguration(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFile("mxinden", "sample-project", samplePayloadSHA, "automation-config.yaml", "stages:\n  - steps:\n      - containers: []\n")
+
+	f := fake.NewFakeExecutor()
+	triggerSamplePullRequest(t, server, f)
+
+	status, ok := server.WaitForStatus(samplePayloadSHA, 5*time.Second)
+	if !ok {
+		t.Fatalf("expected a final status but got %v", server.Statuses())
+	}
+	if status.State != string(ExecutionStatusFailure) || !strings.Contains(status.Description, "invalid automation-config.yaml") {
+		t.Fatalf("expected failure status for invalid configuration but got %+v", status)
+	}
+
+	if len(f.Configurations()) != 0 {
+		t.Fatal("expected invalid configuration not to be executed")
+	}
+}
+
+func TestPullRequestPolicyViolation(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFile("mxinden", "sample-project", samplePayloadSHA, "automation-config.yaml", sampleConfig)
+
+	c := configuration.Configuration{
+		DefaultPolicy: &executor.Policy{Images: []string{"*"}},
+		Policies: map[string]executor.Policy{
+			"github.com/mxinden/sample-project": {Images: []string{"quay.io/mxinden/*"}},
+		},
+	}
+
+	f := fake.NewFakeExecutor()
+	triggerSamplePullRequestWithConfiguration(t, server, f, c)
+
+	status, ok := server.WaitForStatus(samplePayloadSHA, 5*time.Second)
+	if !ok {
+		t.Fatalf("expected a final status but got %v", server.Statuses())
+	}
+	if status.State != string(ExecutionStatusFailure) || !strings.Contains(status.Description, "policy violated") {
+		t.Fatalf("expected failure status for policy violation but got %+v", status)
+	}
+
+	comments := server.Comments()
+	if len(comments) != 1 || !strings.Contains(comments[0].Body, "stages[0].steps[0](test).containers[0].image") {
+		t.Fatalf("expected comment listing the offending field but got %+v", comments)
+	}
+
+	if len(f.Configurations()) != 0 {
+		t.Fatal("expected configuration violating the policy not to be executed")
+	}
+}
+
+func TestPullRequestArtifactLinks(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFile("mxinden", "sample-project", samplePayloadSHA, "automation-config.yaml", `stages:
+  - steps:
+      - volumes:
+          - name: repository
+            emptyDir: {}
+        containers:
+          - image: golang
+            command: go test -coverprofile coverage.out
+            volumeMounts:
+              - name: repository
+                mountPath: /src
+        artifacts:
+          - /src/coverage.out
+`)
+
+	f := fake.NewFakeExecutor()
+	triggerSamplePullRequest(t, server, f)
+
+	_, ok := server.WaitForStatus(samplePayloadSHA, 5*time.Second)
+	if !ok {
+		t.Fatalf("expected a final status but got %v", server.Statuses())
+	}
+
+	link := "[/src/coverage.out](https://automation.example.com/api/artifacts/fake/0-coverage.out.tar.gz)"
+	comments := server.Comments()
+	if len(comments) != 1 || !strings.Contains(comments[0].Body, link) {
+		t.Fatalf("expected comment to link artifact %v but got %+v", link, comments)
+	}
+}
+
+func TestPullRequestCacheKeys(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFile("mxinden", "sample-project", samplePayloadSHA, "Gopkg.lock", "lock")
+	server.AddFile("mxinden", "sample-project", samplePayloadSHA, "automation-config.yaml", `stages:
+  - steps:
+      - volumes:
+          - name: repository
+            emptyDir: {}
+        containers:
+          - image: golang
+            command: dep ensure && go build
+            volumeMounts:
+              - name: repository
+                mountPath: /src
+        caches:
+          - path: /src/vendor
+            key: 'dep-{{ checksum "Gopkg.lock" }}'
+`)
+
+	f := fake.NewFakeExecutor()
+	triggerSamplePullRequest(t, server, f)
+
+	_, ok := server.WaitForStatus(samplePayloadSHA, 5*time.Second)
+	if !ok {
+		t.Fatalf("expected a final status but got %v", server.Statuses())
+	}
+
+	// sha256 of "lock"
+	expectedKey := "mxinden/sample-project/dep-0c030586945fe504b604ecc2e875c38ede400cd5cd73da9730302162e6b02c6f"
+	steps := f.Steps()
+	if len(steps) != 1 || steps[0].Caches[0].Key != expectedKey {
+		t.Fatalf("expected cache key %v but got %+v", expectedKey, steps)
+	}
+
+	comments := server.Comments()
+	if len(comments) != 1 || !strings.Contains(comments[0].Body, "Cache /src/vendor missed and saved") {
+		t.Fatalf("expected comment to report the cache but got %+v", comments)
+	}
+}
+
+func TestShutdownHandsOffRunningExecutions(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFile("mxinden", "sample-project", samplePayloadSHA, "automation-config.yaml", sampleConfig)
+
+	f := fake.NewFakeExecutor(fake.Rule{Command: "go test", Delay: time.Minute})
+	connector := newSampleConnector(server, f, configuration.Configuration{})
+
+	recorder := sendSamplePullRequest(t, &connector)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected webhook to be accepted but got %v: %v", recorder.Code, recorder.Body.String())
+	}
+
+	// Wait for the execution to be running.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(f.Configurations()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := connector.Shutdown(ctx)
+	if err == nil {
+		t.Fatal("expected shutdown to time out waiting for the running execution")
+	}
+
+	status, ok := server.WaitForStatus(samplePayloadSHA, 5*time.Second)
+	if !ok {
+		t.Fatalf("expected a final status but got %v", server.Statuses())
+	}
+	if status.State != string(ExecutionStatusFailure) || status.Description != shutdownStatusDescription {
+		t.Fatalf("expected running execution to be handed off but got %+v", status)
+	}
+
+	recorder = sendSamplePullRequest(t, &connector)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected webhooks to be rejected while shutting down but got %v", recorder.Code)
+	}
+}
+
+func TestShutdownWithoutRunningExecutions(t *testing.T) {
+	connector := NewGithubConnector(configuration.Configuration{}, fake.NewFakeExecutor())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := connector.Shutdown(ctx)
+	if err != nil {
+		t.Fatalf("expected shutdown to return right away but got %v", err)
+	}
+}
+
+func TestCheckGithub(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+
+	connector := NewGithubConnector(configuration.Configuration{GithubAPIURL: server.URL}, fake.NewFakeExecutor())
+
+	os.Unsetenv("GITHUB_API_TOKEN")
+	err := connector.CheckGithub(context.Background())
+	if err == nil {
+		t.Fatal("expected check to fail without token")
+	}
+
+	os.Setenv("GITHUB_API_TOKEN", "token")
+	defer os.Unsetenv("GITHUB_API_TOKEN")
+	err = connector.CheckGithub(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
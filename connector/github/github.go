@@ -6,23 +6,27 @@ import (
 	"github.com/google/go-github/github"
 	"github.com/mxinden/automation/configuration"
 	"github.com/mxinden/automation/executor"
+	"github.com/mxinden/automation/metrics"
 	"golang.org/x/oauth2"
 	"k8s.io/api/core/v1"
+	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"regexp"
 	"strings"
 )
 
 type GithubConnector struct {
-	config   configuration.Configuration
-	executor executor.Executor
+	config     configuration.Configuration
+	executor   executor.Executor
+	executions *executions
 }
 
 func NewGithubConnector(c configuration.Configuration, e executor.Executor) GithubConnector {
 	return GithubConnector{
-		config:   c,
-		executor: e,
+		config:     c,
+		executor:   e,
+		executions: newExecutions(),
 	}
 }
 
@@ -33,36 +37,111 @@ type PRExecution struct {
 	prNumber int
 	client   *github.Client
 	ctx      context.Context
+	// externalURL is the URL of the server, used to link artifacts.
+	externalURL string
 }
 
-func NewPRExecution(owner, name, sha string, prNumber int) *PRExecution {
-	e := &PRExecution{owner: owner, name: name, sha: sha, prNumber: prNumber}
-	t := os.Getenv("GITHUB_API_TOKEN")
-	e.ctx = context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: t},
-	)
-	tc := oauth2.NewClient(e.ctx, ts)
-	e.client = github.NewClient(tc)
+func NewPRExecution(client *github.Client, owner, name, sha string, prNumber int) *PRExecution {
+	return &PRExecution{
+		owner:    owner,
+		name:     name,
+		sha:      sha,
+		prNumber: prNumber,
+		client:   client,
+		ctx:      context.Background(),
+	}
+}
+
+// newGithubClient returns a client of the configured GitHub API,
+// authenticated by the given token unless it is empty.
+func (c *GithubConnector) newGithubClient(token string) (*github.Client, error) {
+	httpClient := &http.Client{}
+	if token != "" {
+		ts := oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: token},
+		)
+		httpClient = oauth2.NewClient(context.Background(), ts)
+	}
+	httpClient.Transport = metrics.GithubTransport(httpClient.Transport)
+
+	client := github.NewClient(httpClient)
+
+	if c.config.GithubAPIURL != "" {
+		baseURL := c.config.GithubAPIURL
+		if !strings.HasSuffix(baseURL, "/") {
+			baseURL = baseURL + "/"
+		}
+
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, err
+		}
+		client.BaseURL = u
+	}
+
+	return client, nil
+}
+
+// CheckGithub returns an error unless the GitHub API is reachable with the
+// configured credentials.
+func (c *GithubConnector) CheckGithub(ctx context.Context) error {
+	token := os.Getenv("GITHUB_API_TOKEN")
+	if token == "" {
+		return fmt.Errorf("GITHUB_API_TOKEN is not set")
+	}
+
+	client, err := c.newGithubClient(token)
+	if err != nil {
+		return err
+	}
 
-	return e
+	// Requests for the rate limit don't count against it.
+	_, _, err = client.RateLimits(ctx)
+	return err
 }
 
 func (c *GithubConnector) runFromPREvent(event github.PullRequestEvent) error {
+	client, err := c.newGithubClient(os.Getenv("GITHUB_API_TOKEN"))
+	if err != nil {
+		return err
+	}
+
 	// TODO: Still needed?
 	e := NewPRExecution(
+		client,
 		*event.Repo.Owner.Login,
 		*event.Repo.Name,
 		*event.PullRequest.Head.SHA,
 		*event.PullRequest.Number,
 	)
+	e.externalURL = c.config.ExternalURL
 
-	err := e.SetStatusPending()
+	err = e.SetStatusPending()
 	if err != nil {
 		return err
 	}
 
-	executionResult, err := c.run(*event.Repo.CloneURL, e.owner, e.name, *event.PullRequest.Head.Ref, *event.PullRequest.Head.SHA)
+	c.executions.trackPullRequest(e)
+	defer c.executions.untrackPullRequest(e)
+
+	changedFiles, err := e.getChangedFiles()
+	if err != nil {
+		return err
+	}
+
+	conditionContext := executor.ConditionContext{
+		Branch:       *event.PullRequest.Head.Ref,
+		Event:        executor.EventPullRequest,
+		ChangedFiles: changedFiles,
+	}
+
+	executionResult, err := c.run(*event.Repo.CloneURL, e.owner, e.name, *event.PullRequest.Head.SHA, conditionContext)
+	if validationErrors, ok := err.(executor.ValidationErrors); ok {
+		return e.SetStatusInvalidConfiguration(validationErrors)
+	}
+	if violations, ok := err.(executor.PolicyViolations); ok {
+		return e.SetStatusPolicyViolations(violations)
+	}
 	if err != nil {
 		return err
 	}
@@ -75,40 +154,160 @@ func (c *GithubConnector) runFromPREvent(event github.PullRequestEvent) error {
 	return nil
 }
 
+// getChangedFiles returns the paths of all files changed by the pull request.
+func (e *PRExecution) getChangedFiles() ([]string, error) {
+	files := []string{}
+	opt := &github.ListOptions{PerPage: 100}
+
+	for {
+		commitFiles, resp, err := e.client.PullRequests.ListFiles(e.ctx, e.owner, e.name, e.prNumber, opt)
+		if err != nil {
+			return files, err
+		}
+
+		for _, f := range commitFiles {
+			files = append(files, f.GetFilename())
+		}
+
+		if resp.NextPage == 0 {
+			return files, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
 func (c *GithubConnector) runFromPushEvent(event github.PushEvent) error {
-	_, err := c.run(
+	client, err := c.newGithubClient("")
+	if err != nil {
+		return err
+	}
+
+	changedFiles, ok := getPushChangedFiles(client, event)
+	conditionContext := executor.ConditionContext{
+		// TODO: Find cleaner solution
+		Branch:              gitRefToBranchName(*event.Ref),
+		Event:               gitRefToEvent(*event.Ref),
+		ChangedFiles:        changedFiles,
+		ChangedFilesUnknown: !ok,
+	}
+
+	_, err = c.run(
 		*event.Repo.CloneURL,
 		*event.Repo.Owner.Name,
 		*event.Repo.Name,
-		// TODO: Find cleaner solution
-		gitRefToBranchName(*event.Ref),
 		*event.After,
+		conditionContext,
 	)
 	return err
 }
 
-func (c *GithubConnector) run(repoURL, repoOwner, repoName, branchName, sha string) (executor.ExecutionResult, error) {
+func (c *GithubConnector) run(repoURL, repoOwner, repoName, sha string, conditionContext executor.ConditionContext) (executor.ExecutionResult, error) {
 	executionResult := executor.ExecutionResult{}
-	config, err := GetConfiguration(repoOwner, repoName, sha)
+	client, err := c.newGithubClient("")
+	if err != nil {
+		return executionResult, err
+	}
+
+	config, err := GetConfiguration(client, repoOwner, repoName, sha)
+	if err != nil {
+		return executionResult, err
+	}
+
+	config, err = PrepareConfiguration(config, repoURL, sha, conditionContext)
+	if err != nil {
+		return executionResult, err
+	}
+
+	config, err = executor.ResolveCacheKeys(config, repoOwner+"/"+repoName, repositoryFileReader(client, repoOwner, repoName, sha))
 	if err != nil {
 		return executionResult, err
 	}
 
-	config, err = addEnvVars(repoURL, branchName, sha, config)
+	config, err = c.applyResourceConfiguration(config)
 	if err != nil {
 		return executionResult, err
 	}
 
-	return c.executor.Execute(config)
+	repository := "github.com/" + repoOwner + "/" + repoName
+
+	if policy := c.config.PolicyFor(repository); policy != nil {
+		clusterLabels := map[string]map[string]string{}
+		for _, cluster := range c.config.ExecutionClusters() {
+			clusterLabels[cluster.Name] = cluster.Labels
+		}
+
+		err = executor.CheckPolicy(config, *policy, clusterLabels)
+		if err != nil {
+			return executionResult, err
+		}
+	}
+
+	metrics.ExecutionsStarted.WithLabelValues(repository).Inc()
+
+	executionResult, err = c.executor.Execute(config)
+
+	outcome := metrics.OutcomeFailure
+	switch {
+	case err != nil:
+		outcome = metrics.OutcomeError
+	case executionResult.DidSucceed():
+		outcome = metrics.OutcomeSuccess
+	}
+	metrics.ExecutionsFinished.WithLabelValues(repository, outcome).Inc()
+	metrics.ObserveExecutionResult(repository, executionResult)
+
+	return executionResult, err
+}
+
+// PrepareConfiguration resolves the variables of the given configuration,
+// skips the steps whose conditions don't match and passes the git context to
+// all containers as GIT_* environment variables.
+func PrepareConfiguration(config executor.ExecutionConfiguration, repoURL, sha string, conditionContext executor.ConditionContext) (executor.ExecutionConfiguration, error) {
+	config, err := executor.ResolveVariables(config, gitContext(repoURL, conditionContext.Branch, sha))
+	if err != nil {
+		return config, err
+	}
+
+	config = executor.ApplyConditions(config, conditionContext)
+
+	return addEnvVars(repoURL, conditionContext.Branch, sha, config)
+}
+
+// applyResourceConfiguration applies the server side resource defaults and
+// ensures the configuration does not exceed the server side maximum.
+func (c *GithubConnector) applyResourceConfiguration(config executor.ExecutionConfiguration) (executor.ExecutionConfiguration, error) {
+	defaults, err := c.config.Resources.Defaults()
+	if err != nil {
+		return config, err
+	}
+
+	max, err := c.config.Resources.Maximum()
+	if err != nil {
+		return config, err
+	}
+
+	config = executor.ApplyResourceDefaults(config, defaults)
+
+	return config, executor.CheckResourceMaximum(config, max)
+}
+
+// gitContext returns the values describing the commit under test, which are
+// available as environment variables and as variables in the configuration.
+func gitContext(repoURL, branch, sha string) map[string]string {
+	return map[string]string{
+		"GIT_REPOSITORY_URL": repoURL,
+		"GIT_SHA":            sha,
+		"GIT_BRANCH_NAME":    branch,
+	}
 }
 
 func addEnvVars(repoURL, branch, sha string, c executor.ExecutionConfiguration) (executor.ExecutionConfiguration, error) {
 	config := c
 
-	env := []v1.EnvVar{
-		v1.EnvVar{Name: "GIT_REPOSITORY_URL", Value: repoURL},
-		v1.EnvVar{Name: "GIT_SHA", Value: sha},
-		v1.EnvVar{Name: "GIT_BRANCH_NAME", Value: branch},
+	context := gitContext(repoURL, branch, sha)
+	env := []v1.EnvVar{}
+	for _, name := range []string{"GIT_REPOSITORY_URL", "GIT_SHA", "GIT_BRANCH_NAME"} {
+		env = append(env, v1.EnvVar{Name: name, Value: context[name]})
 	}
 
 	for stageI, stage := range config.Stages {
@@ -125,18 +324,85 @@ func addEnvVars(repoURL, branch, sha string, c executor.ExecutionConfiguration)
 	return config, nil
 }
 
+// gitRefToEvent distinguishes pushes of tags from pushes of branches.
+func gitRefToEvent(ref string) string {
+	if strings.HasPrefix(ref, "refs/tags/") {
+		return executor.EventTag
+	}
+	return executor.EventPush
+}
+
+const (
+	// maxPushEventCommits is the number of commits GitHub includes in a
+	// push event at most.
+	maxPushEventCommits = 20
+	// maxComparisonFiles is the number of files GitHub includes in a
+	// comparison of two commits at most.
+	maxComparisonFiles = 300
+	// nullSHA is the commit before the push of a new branch.
+	nullSHA = "0000000000000000000000000000000000000000"
+)
+
+// getPushChangedFiles returns the paths of all files changed by the push. The
+// commits of push events are left out for force pushes and truncated for
+// large pushes, thus the commits before and after the push are compared then.
+// It returns false if the changed files can't be determined, e.g. for the
+// push of a new branch.
+func getPushChangedFiles(client *github.Client, event github.PushEvent) ([]string, bool) {
+	truncated := len(event.Commits) >= maxPushEventCommits || event.GetSize() > len(event.Commits)
+	if len(event.Commits) != 0 && !truncated && !event.GetForced() && !event.GetCreated() {
+		return getPushEventChangedFiles(event), true
+	}
+
+	before, after := event.GetBefore(), event.GetAfter()
+	if event.GetCreated() || before == "" || before == nullSHA || after == "" {
+		log.Printf("changed files of push to %v unknown, matching all paths conditions", event.GetRef())
+		return nil, false
+	}
+
+	repo := event.GetRepo()
+	comparison, _, err := client.Repositories.CompareCommits(context.Background(), repo.GetOwner().GetName(), repo.GetName(), before, after)
+	if err != nil {
+		log.Printf("failed to compare %v...%v, matching all paths conditions: %v", before, after, err)
+		return nil, false
+	}
+	if len(comparison.Files) >= maxComparisonFiles {
+		log.Printf("comparison %v...%v is truncated, matching all paths conditions", before, after)
+		return nil, false
+	}
+
+	files := []string{}
+	for _, f := range comparison.Files {
+		files = append(files, f.GetFilename())
+	}
+	return files, true
+}
+
+// getPushEventChangedFiles returns the paths of all files added, removed or
+// modified by the commits of the push.
+func getPushEventChangedFiles(event github.PushEvent) []string {
+	files := []string{}
+	for _, commit := range event.Commits {
+		files = append(files, commit.Added...)
+		files = append(files, commit.Removed...)
+		files = append(files, commit.Modified...)
+	}
+	return files
+}
+
+// gitRefToBranchName extracts e.g. "release/1.0" out of
+// "refs/heads/release/1.0", or the tag out of "refs/tags/v1.0.0".
 func gitRefToBranchName(ref string) string {
-	// extract e.g. "push-test" out of "refs/heads/push-test"
-	re := regexp.MustCompile("[^/]*$")
-	return re.FindString(ref)
+	if strings.HasPrefix(ref, "refs/tags/") {
+		return strings.TrimPrefix(ref, "refs/tags/")
+	}
+	return strings.TrimPrefix(ref, "refs/heads/")
 }
 
-func GetConfiguration(owner, name, sha string) (executor.ExecutionConfiguration, error) {
+func GetConfiguration(client *github.Client, owner, name, sha string) (executor.ExecutionConfiguration, error) {
 	var config executor.ExecutionConfiguration
 	ctx := context.Background()
 
-	client := github.NewClient(&http.Client{})
-
 	file, _, _, err := client.Repositories.GetContents(ctx, owner, name, "automation-config.yaml", &github.RepositoryContentGetOptions{Ref: sha})
 	if err != nil {
 		return config, err
@@ -147,6 +413,11 @@ func GetConfiguration(owner, name, sha string) (executor.ExecutionConfiguration,
 		return config, err
 	}
 
+	err = executor.ValidateExecutionConfiguration([]byte(rawConfig))
+	if err != nil {
+		return config, err
+	}
+
 	config, err = executor.DecodeExecutionConfiguration(strings.NewReader(rawConfig))
 	if err != nil {
 		return config, err
@@ -155,6 +426,23 @@ func GetConfiguration(owner, name, sha string) (executor.ExecutionConfiguration,
 	return config, nil
 }
 
+// repositoryFileReader returns a function reading the files of the given
+// repository at the given commit.
+func repositoryFileReader(client *github.Client, owner, name, sha string) func(path string) ([]byte, error) {
+	return func(path string) ([]byte, error) {
+		file, _, _, err := client.Repositories.GetContents(context.Background(), owner, name, path, &github.RepositoryContentGetOptions{Ref: sha})
+		if err != nil {
+			return nil, err
+		}
+		if file == nil {
+			return nil, fmt.Errorf("%v is a directory", path)
+		}
+
+		content, err := file.GetContent()
+		return []byte(content), err
+	}
+}
+
 type ExecutionStatus string
 
 var (
@@ -164,7 +452,44 @@ var (
 )
 
 func (e *PRExecution) SetStatusPending() error {
-	return e.updateGithubCommitStatus(ExecutionStatusPending)
+	return e.updateGithubCommitStatus(ExecutionStatusPending, "")
+}
+
+// SetStatusInvalidConfiguration reports the problems of the configuration of
+// the pull request instead of executing it.
+func (e *PRExecution) SetStatusInvalidConfiguration(errs executor.ValidationErrors) error {
+	body := "Invalid automation-config.yaml for " + e.sha + ":\n\n```\n" + errs.Error() + "\n```"
+	comment := github.IssueComment{
+		Body: &body,
+	}
+	_, _, err := e.client.Issues.CreateComment(e.ctx, e.owner, e.name, e.prNumber, &comment)
+	if err != nil {
+		return err
+	}
+
+	return e.updateGithubCommitStatus(
+		ExecutionStatusFailure,
+		fmt.Sprintf("invalid automation-config.yaml: %v problem(s)", len(errs)),
+	)
+}
+
+// SetStatusPolicyViolations reports the fields of the configuration of the
+// pull request violating the policy of the repository instead of executing
+// it.
+func (e *PRExecution) SetStatusPolicyViolations(violations executor.PolicyViolations) error {
+	body := "automation-config.yaml for " + e.sha + " violates the policy of this repository:\n\n```\n" + violations.Error() + "\n```"
+	comment := github.IssueComment{
+		Body: &body,
+	}
+	_, _, err := e.client.Issues.CreateComment(e.ctx, e.owner, e.name, e.prNumber, &comment)
+	if err != nil {
+		return err
+	}
+
+	return e.updateGithubCommitStatus(
+		ExecutionStatusFailure,
+		fmt.Sprintf("policy violated: %v field(s)", len(violations)),
+	)
 }
 
 func (e *PRExecution) SetStatus(r executor.ExecutionResult) error {
@@ -178,23 +503,26 @@ func (e *PRExecution) SetStatus(r executor.ExecutionResult) error {
 		return err
 	}
 
-	return e.updateGithubCommitStatus(executionStatus)
+	return e.updateGithubCommitStatus(executionStatus, "")
 }
 
-func (e *PRExecution) updateGithubCommitStatus(s ExecutionStatus) error {
+func (e *PRExecution) updateGithubCommitStatus(s ExecutionStatus, description string) error {
 	context := "Automation"
 	state := string(s)
 	status := github.RepoStatus{
 		State:   &state,
 		Context: &context,
 	}
+	if description != "" {
+		status.Description = &description
+	}
 
 	_, _, err := e.client.Repositories.CreateStatus(e.ctx, e.owner, e.name, e.sha, &status)
 	return err
 }
 
 func (e *PRExecution) addResultAsPRComment(s ExecutionStatus, r executor.ExecutionResult) error {
-	body := "Result for " + e.sha + ": " + string(s) + formatLogsForGithubComment(r)
+	body := "Result for " + e.sha + ": " + string(s) + formatLogsForGithubComment(r, e.externalURL)
 	comment := github.IssueComment{
 		Body: &body,
 	}
@@ -202,23 +530,52 @@ func (e *PRExecution) addResultAsPRComment(s ExecutionStatus, r executor.Executi
 	return err
 }
 
-func formatLogsForGithubComment(r executor.ExecutionResult) string {
+func formatLogsForGithubComment(r executor.ExecutionResult, externalURL string) string {
 	comment := "\n\n"
 	for stageI, stageResult := range r.Stages {
-		comment = comment + fmt.Sprintf("\n\nStage %v<p>", stageI)
+		comment = comment + fmt.Sprintf("\n\nStage %v<p>", nameOrIndex(stageResult.Name, stageI))
 
 		for stepI, stepResult := range stageResult.Steps {
-			comment = comment + fmt.Sprintf("\n\n<details><summary>Step %v</summary><p>", stepI)
+			if stepResult.Skipped {
+				comment = comment + fmt.Sprintf("\n\nStep %v skipped", nameOrIndex(stepResult.Name, stepI))
+				continue
+			}
+
+			if stepResult.NotRun {
+				comment = comment + fmt.Sprintf("\n\nStep %v not run", nameOrIndex(stepResult.Name, stepI))
+				continue
+			}
+
+			comment = comment + fmt.Sprintf("\n\n<details><summary>Step %v</summary><p>", nameOrIndex(stepResult.Name, stepI))
 
 			for initContainerI, initContainerResult := range stepResult.InitContainers {
-				comment = comment + fmt.Sprintf("\n\nInitContainer %v ExitCode %v", initContainerI, initContainerResult.ExitCode)
+				comment = comment + fmt.Sprintf("\n\nInitContainer %v %v", nameOrIndex(initContainerResult.Name, initContainerI), formatContainerResult(initContainerResult))
 			}
 
 			for containerI, containerResult := range stepResult.Containers {
-				comment = comment + fmt.Sprintf("\n\nContainer %v ExitCode %v", containerI, containerResult.ExitCode)
+				comment = comment + fmt.Sprintf("\n\nContainer %v %v", nameOrIndex(containerResult.Name, containerI), formatContainerResult(containerResult))
+			}
+
+			for _, serviceResult := range stepResult.Services {
+				comment = comment + fmt.Sprintf("\n\nService %v %v", serviceResult.Name, formatContainerResult(serviceResult))
+			}
+
+			for _, artifact := range stepResult.Artifacts {
+				comment = comment + fmt.Sprintf("\n\nArtifact %v", formatArtifact(artifact, externalURL))
+			}
+
+			for _, cache := range stepResult.Caches {
+				comment = comment + fmt.Sprintf("\n\nCache %v %v", cache.Path, formatCacheResult(cache))
 			}
 
-			comment = comment + fmt.Sprintf("\n\nLogs: \n\n ```\n\n%v```", stepResult.Output)
+			// Failed tests are the interesting part of the logs of steps
+			// with test reports.
+			if len(stepResult.TestSuites) != 0 {
+				comment = comment + formatTestSuites(stepResult.TestSuites)
+				comment = comment + fmt.Sprintf("\n\n<details><summary>Logs</summary>\n\n```\n\n%v```\n\n</details>", stepResult.Output)
+			} else {
+				comment = comment + fmt.Sprintf("\n\nLogs: \n\n ```\n\n%v```", stepResult.Output)
+			}
 
 			comment = comment + "\n\n</p></details>"
 		}
@@ -228,3 +585,94 @@ func formatLogsForGithubComment(r executor.ExecutionResult) string {
 
 	return comment
 }
+
+// formatArtifact links the given artifact, if the URL of the server is known.
+func formatArtifact(a executor.Artifact, externalURL string) string {
+	if externalURL == "" {
+		return fmt.Sprintf("%v (%v)", a.Path, a.Key)
+	}
+	return fmt.Sprintf("[%v](%v/api/artifacts/%v)", a.Path, strings.TrimSuffix(externalURL, "/"), a.Key)
+}
+
+// maxFailedTestsInComment bounds the table of failed tests, as comments are
+// limited in size.
+const maxFailedTestsInComment = 50
+
+// formatTestSuites summarizes the given suites and lists their failed tests as
+// a table.
+func formatTestSuites(suites []executor.TestSuiteResult) string {
+	passed, failed, skipped := executor.CountTestCases(suites)
+	s := fmt.Sprintf("\n\nTests: %v passed, %v failed, %v skipped", passed, failed, skipped)
+
+	if failed == 0 {
+		return s
+	}
+
+	s = s + "\n\n| Suite | Test | Message |\n| --- | --- | --- |"
+	rows := 0
+	for _, suite := range suites {
+		for _, c := range suite.Failed() {
+			if rows == maxFailedTestsInComment {
+				return s + fmt.Sprintf("\n\n... and %v more failed tests", failed-rows)
+			}
+
+			name := c.Name
+			if c.ClassName != "" && c.ClassName != suite.Name {
+				name = c.ClassName + "." + name
+			}
+
+			s = s + fmt.Sprintf("\n| %v | %v | %v |", escapeTableCell(suite.Name), escapeTableCell(name), escapeTableCell(c.Message))
+			rows++
+		}
+	}
+
+	return s
+}
+
+// escapeTableCell fits the given text into a cell of a markdown table.
+func escapeTableCell(s string) string {
+	const maxLength = 300
+	if runes := []rune(strings.TrimSpace(s)); len(runes) > maxLength {
+		s = string(runes[:maxLength]) + "..."
+	}
+
+	s = strings.NewReplacer("|", "\\|", "<", "&lt;", ">", "&gt;").Replace(strings.TrimSpace(s))
+	return strings.Replace(s, "\n", "<br>", -1)
+}
+
+func formatCacheResult(r executor.CacheResult) string {
+	switch {
+	case r.Restored:
+		return "restored"
+	case r.Saved:
+		return "missed and saved"
+	default:
+		return "missed"
+	}
+}
+
+func nameOrIndex(name string, i int) string {
+	if name == "" {
+		return fmt.Sprint(i)
+	}
+	return name
+}
+
+func formatContainerResult(r executor.ContainerResult) string {
+	if r.State != executor.ContainerStateTerminated {
+		s := fmt.Sprintf("(%v) %v", r.Image, r.State)
+		if r.Reason != "" {
+			s = s + fmt.Sprintf(" Reason %v", r.Reason)
+		}
+		return s
+	}
+
+	s := fmt.Sprintf("(%v) ExitCode %v", r.Image, r.ExitCode)
+	if r.ExitCode != 0 && r.Reason != "" {
+		s = s + fmt.Sprintf(" Reason %v", r.Reason)
+	}
+	if !r.StartTime.IsZero() && !r.CompletionTime.IsZero() {
+		s = s + fmt.Sprintf(" Duration %v", r.CompletionTime.Sub(r.StartTime))
+	}
+	return s
+}
@@ -1,8 +1,12 @@
 package github
 
 import (
+	"github.com/google/go-github/github"
+	"github.com/mxinden/automation/configuration"
+	"github.com/mxinden/automation/connector/github/githubtest"
 	"github.com/mxinden/automation/executor"
 	"k8s.io/api/core/v1"
+	"strings"
 	"testing"
 )
 
@@ -71,6 +75,43 @@ func TestAddEnvVarsAppendsNotReplaces(t *testing.T) {
 	}
 }
 
+func TestPrepareConfigurationStepsExtendingOneTemplate(t *testing.T) {
+	t.Parallel()
+
+	rawConfig := `
+templates:
+  go:
+    containers:
+      - image: golang
+        command: go test ./...
+        env:
+          - name: GOFLAGS
+            value: -mod=vendor
+stages:
+  - steps:
+      - name: test
+        extends: go
+      - name: vet
+        extends: go
+`
+
+	c, err := executor.DecodeExecutionConfiguration(strings.NewReader(rawConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = PrepareConfiguration(c, "my fancy url", "1234", executor.ConditionContext{Branch: "master", Event: "push"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range c.Stages[0].Steps {
+		if env := step.Containers[0].Env; len(env) != 4 {
+			t.Fatalf("expected step %v to have its own 4 env vars but got %v", step.Name, env)
+		}
+	}
+}
+
 func TestGitReferenceToBranchName(t *testing.T) {
 	ref := "refs/heads/push-test"
 	expectedBranch := "push-test"
@@ -82,6 +123,138 @@ func TestGitReferenceToBranchName(t *testing.T) {
 	}
 }
 
+func TestGitReferenceToBranchNameWithSlashes(t *testing.T) {
+	for ref, expected := range map[string]string{
+		"refs/heads/release/1.0":   "release/1.0",
+		"refs/heads/feature/a/b":   "feature/a/b",
+		"refs/tags/release/v1.0.0": "release/v1.0.0",
+		"refs/tags/v1.0.0":         "v1.0.0",
+	} {
+		if branch := gitRefToBranchName(ref); branch != expected {
+			t.Fatalf("expected %v to be branch %v but got %v", ref, expected, branch)
+		}
+	}
+
+	when := executor.Condition{Branches: []string{"release/*"}}
+	if !when.Matches(executor.ConditionContext{Branch: gitRefToBranchName("refs/heads/release/1.0")}) {
+		t.Fatal("expected release/* to match a push to release/1.0")
+	}
+}
+
+func TestFormatLogsForGithubCommentUsesNames(t *testing.T) {
+	r := executor.ExecutionResult{
+		Stages: []executor.StageResult{
+			{
+				Name: "build",
+				Steps: []executor.StepResult{
+					{
+						Name: "go-build",
+						Containers: []executor.ContainerResult{
+							{Name: "compile", State: executor.ContainerStateTerminated},
+						},
+					},
+					{},
+					{Name: "deploy", NotRun: true},
+				},
+			},
+		},
+	}
+
+	comment := formatLogsForGithubComment(r, "")
+
+	for _, expected := range []string{"Stage build", "Step go-build", "Container compile", "Step 1", "Step deploy not run"} {
+		if !strings.Contains(comment, expected) {
+			t.Fatalf("expected comment to contain '%v' but got %v", expected, comment)
+		}
+	}
+}
+
+func TestGitReferenceToEvent(t *testing.T) {
+	if e := gitRefToEvent("refs/heads/master"); e != executor.EventPush {
+		t.Fatalf("expected %v but got %v", executor.EventPush, e)
+	}
+
+	if e := gitRefToEvent("refs/tags/v1.0.0"); e != executor.EventTag {
+		t.Fatalf("expected %v but got %v", executor.EventTag, e)
+	}
+}
+
+func TestGetPushEventChangedFiles(t *testing.T) {
+	event := github.PushEvent{
+		Commits: []github.PushEventCommit{
+			{Added: []string{"new.go"}, Modified: []string{"main.go"}},
+			{Removed: []string{"old.go"}},
+		},
+	}
+
+	files := getPushEventChangedFiles(event)
+
+	if strings.Join(files, ",") != "new.go,main.go,old.go" {
+		t.Fatalf("expected new.go, main.go and old.go to be changed but got %v", files)
+	}
+}
+
+func TestGetPushChangedFiles(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.SetComparisonFiles("mxinden", "sample-project", "aaa", "bbb", []string{"docs/README.md"})
+
+	connector := NewGithubConnector(configuration.Configuration{GithubAPIURL: server.URL}, nil)
+	client, err := connector.newGithubClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &github.PushEventRepository{
+		Name:  github.String("sample-project"),
+		Owner: &github.PushEventRepoOwner{Name: github.String("mxinden")},
+	}
+	commits := []github.PushEventCommit{{Modified: []string{"main.go"}}}
+
+	tests := []struct {
+		name    string
+		event   github.PushEvent
+		files   []string
+		unknown bool
+	}{
+		{
+			name:  "commits of the event",
+			event: github.PushEvent{Before: github.String("aaa"), After: github.String("bbb"), Repo: repo, Commits: commits},
+			files: []string{"main.go"},
+		},
+		{
+			name:  "force push",
+			event: github.PushEvent{Before: github.String("aaa"), After: github.String("bbb"), Repo: repo, Forced: github.Bool(true)},
+			files: []string{"docs/README.md"},
+		},
+		{
+			name:  "truncated commits",
+			event: github.PushEvent{Before: github.String("aaa"), After: github.String("bbb"), Repo: repo, Commits: commits, Size: github.Int(21)},
+			files: []string{"docs/README.md"},
+		},
+		{
+			name:    "new branch",
+			event:   github.PushEvent{Before: github.String(nullSHA), After: github.String("bbb"), Repo: repo, Created: github.Bool(true)},
+			unknown: true,
+		},
+		{
+			name:    "failing comparison",
+			event:   github.PushEvent{Before: github.String("ccc"), After: github.String("bbb"), Repo: repo},
+			unknown: true,
+		},
+	}
+
+	for _, tt := range tests {
+		files, ok := getPushChangedFiles(client, tt.event)
+		if ok == tt.unknown {
+			t.Fatalf("%v: expected changed files to be unknown to be %v", tt.name, tt.unknown)
+		}
+		if strings.Join(files, ",") != strings.Join(tt.files, ",") {
+			t.Fatalf("%v: expected changed files %v but got %v", tt.name, tt.files, files)
+		}
+	}
+}
+
 func findEnvVarInConfig(name, value string, config executor.ExecutionConfiguration) bool {
 	for _, stage := range config.Stages {
 		for _, step := range stage.Steps {
@@ -112,3 +285,39 @@ func MakeExecutionConfigurationWithOneContainer() executor.ExecutionConfiguratio
 		},
 	}
 }
+
+func TestFormatLogsForGithubCommentSummarizesTests(t *testing.T) {
+	r := executor.ExecutionResult{
+		Stages: []executor.StageResult{
+			{
+				Steps: []executor.StepResult{
+					{
+						Output: "all the logs",
+						TestSuites: []executor.TestSuiteResult{
+							{
+								Name: "github.com/mxinden/automation/executor",
+								Cases: []executor.TestCaseResult{
+									{Name: "TestA", State: executor.TestStatePassed},
+									{Name: "TestB", State: executor.TestStateFailed, Message: "expected <nil>\nbut got a|b"},
+									{Name: "TestC", State: executor.TestStateSkipped},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	comment := formatLogsForGithubComment(r, "")
+
+	for _, expected := range []string{
+		"Tests: 1 passed, 1 failed, 1 skipped",
+		"| github.com/mxinden/automation/executor | TestB | expected &lt;nil&gt;<br>but got a\\|b |",
+		"<details><summary>Logs</summary>",
+	} {
+		if !strings.Contains(comment, expected) {
+			t.Fatalf("expected comment to contain '%v' but got %v", expected, comment)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+// Package githubtest provides a fake of the parts of the GitHub API used by
+// the GitHub connector, to test the connector without GitHub.
+package githubtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Status struct {
+	Owner       string
+	Repo        string
+	SHA         string
+	State       string
+	Context     string
+	Description string
+}
+
+type Comment struct {
+	Owner  string
+	Repo   string
+	Number int
+	Body   string
+}
+
+// Server serves file contents, the files of pull requests and comparisons, and
+// records commit statuses and issue comments. Its URL is meant to be used as the base URL of
+// a GitHub client.
+type Server struct {
+	*httptest.Server
+
+	mu               sync.Mutex
+	files            map[string]string
+	pullRequestFiles map[string][]string
+	comparisonFiles  map[string][]string
+	statuses         []Status
+	comments         []Comment
+}
+
+func NewServer() *Server {
+	s := &Server{
+		files:            map[string]string{},
+		pullRequestFiles: map[string][]string{},
+		comparisonFiles:  map[string][]string{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// AddFile serves the given content for the file at path in the repository
+// owner/repo at the given git reference.
+func (s *Server) AddFile(owner, repo, ref, path, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[owner+"/"+repo+"/"+ref+"/"+path] = content
+}
+
+// SetPullRequestFiles sets the files changed by the given pull request.
+func (s *Server) SetPullRequestFiles(owner, repo string, number int, files []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pullRequestFiles[owner+"/"+repo+"/"+strconv.Itoa(number)] = files
+}
+
+// SetComparisonFiles sets the files changed between the given commits.
+// Comparisons of other commits are not found.
+func (s *Server) SetComparisonFiles(owner, repo, base, head string, files []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.comparisonFiles[owner+"/"+repo+"/"+base+"..."+head] = files
+}
+
+func (s *Server) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Status{}, s.statuses...)
+}
+
+func (s *Server) Comments() []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Comment{}, s.comments...)
+}
+
+// WaitForStatus waits for a status other than pending to be set on the given
+// commit, as the connector executes asynchronously.
+func (s *Server) WaitForStatus(sha string, timeout time.Duration) (Status, bool) {
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		for _, status := range s.Statuses() {
+			if status.SHA == sha && status.State != "pending" {
+				return status, true
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return Status{}, false
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" && r.URL.Path == "/rate_limit" {
+		s.handleRateLimit(w, r)
+		return
+	}
+
+	// Paths look like /repos/{owner}/{repo}/{resource}/...
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 5 || parts[0] != "repos" {
+		http.NotFound(w, r)
+		return
+	}
+	owner, repo := parts[1], parts[2]
+
+	switch {
+	case r.Method == "GET" && parts[3] == "contents":
+		s.handleContents(w, r, owner, repo, strings.Join(parts[4:], "/"))
+	case r.Method == "GET" && parts[3] == "pulls" && len(parts) == 6 && parts[5] == "files":
+		s.handlePullRequestFiles(w, owner, repo, parts[4])
+	case r.Method == "GET" && parts[3] == "compare":
+		s.handleComparison(w, owner, repo, parts[4])
+	case r.Method == "POST" && parts[3] == "statuses":
+		s.handleStatus(w, r, owner, repo, parts[4])
+	case r.Method == "POST" && parts[3] == "issues" && len(parts) == 6 && parts[5] == "comments":
+		s.handleComment(w, r, owner, repo, parts[4])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleRateLimit serves a rate limit to authenticated clients only, just
+// like GitHub rejects invalid credentials.
+func (s *Server) handleRateLimit(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		http.Error(w, `{"message": "Requires authentication"}`, http.StatusUnauthorized)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"resources": map[string]interface{}{
+			"core": map[string]int{"limit": 5000, "remaining": 4999, "reset": 0},
+		},
+	})
+}
+
+func (s *Server) handleContents(w http.ResponseWriter, r *http.Request, owner, repo, path string) {
+	s.mu.Lock()
+	content, ok := s.files[owner+"/"+repo+"/"+r.URL.Query().Get("ref")+"/"+path]
+	s.mu.Unlock()
+
+	if !ok {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"type":     "file",
+		"encoding": "base64",
+		"path":     path,
+		"content":  base64.StdEncoding.EncodeToString([]byte(content)),
+	})
+}
+
+func (s *Server) handlePullRequestFiles(w http.ResponseWriter, owner, repo, number string) {
+	s.mu.Lock()
+	files := s.pullRequestFiles[owner+"/"+repo+"/"+number]
+	s.mu.Unlock()
+
+	commitFiles := []map[string]string{}
+	for _, f := range files {
+		commitFiles = append(commitFiles, map[string]string{"filename": f})
+	}
+
+	writeJSON(w, http.StatusOK, commitFiles)
+}
+
+func (s *Server) handleComparison(w http.ResponseWriter, owner, repo, basehead string) {
+	s.mu.Lock()
+	files, ok := s.comparisonFiles[owner+"/"+repo+"/"+basehead]
+	s.mu.Unlock()
+
+	if !ok {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+		return
+	}
+
+	commitFiles := []map[string]string{}
+	for _, f := range files {
+		commitFiles = append(commitFiles, map[string]string{"filename": f})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"files": commitFiles})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request, owner, repo, sha string) {
+	status := struct {
+		State       string `json:"state"`
+		Context     string `json:"context"`
+		Description string `json:"description"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.statuses = append(s.statuses, Status{
+		Owner:       owner,
+		Repo:        repo,
+		SHA:         sha,
+		State:       status.State,
+		Context:     status.Context,
+		Description: status.Description,
+	})
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, status)
+}
+
+func (s *Server) handleComment(w http.ResponseWriter, r *http.Request, owner, repo, number string) {
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	comment := struct {
+		Body string `json:"body"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&comment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.comments = append(s.comments, Comment{Owner: owner, Repo: repo, Number: n, Body: comment.Body})
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, comment)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
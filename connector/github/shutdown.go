@@ -0,0 +1,93 @@
+package github
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// shutdownStatusDescription is the status of pull requests whose executions
+// were still running when the server shut down.
+const shutdownStatusDescription = "automation server shut down during the execution, push to retrigger"
+
+// executions tracks the executions started by webhooks, so the server can
+// wait for them when shutting down.
+type executions struct {
+	mutex    sync.Mutex
+	draining bool
+	running  sync.WaitGroup
+	// pullRequests are the running executions of pull requests, which are
+	// handed off on shutdown by failing their status.
+	pullRequests map[*PRExecution]bool
+}
+
+func newExecutions() *executions {
+	return &executions{pullRequests: map[*PRExecution]bool{}}
+}
+
+// start registers a new execution, unless the server is shutting down. Each
+// started execution needs to be marked done.
+func (e *executions) start() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.draining {
+		return false
+	}
+	e.running.Add(1)
+	return true
+}
+
+func (e *executions) done() {
+	e.running.Done()
+}
+
+func (e *executions) trackPullRequest(pr *PRExecution) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.pullRequests[pr] = true
+}
+
+func (e *executions) untrackPullRequest(pr *PRExecution) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.pullRequests, pr)
+}
+
+// Shutdown stops starting executions for new webhooks and waits for the
+// running executions until the given context is done. Pull requests whose
+// executions are still running by then get a failed status, asking to
+// retrigger them, instead of staying pending forever.
+func (c *GithubConnector) Shutdown(ctx context.Context) error {
+	c.executions.mutex.Lock()
+	c.executions.draining = true
+	c.executions.mutex.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		c.executions.running.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+	}
+
+	c.executions.mutex.Lock()
+	pullRequests := []*PRExecution{}
+	for pr := range c.executions.pullRequests {
+		pullRequests = append(pullRequests, pr)
+	}
+	c.executions.mutex.Unlock()
+
+	for _, pr := range pullRequests {
+		err := pr.updateGithubCommitStatus(ExecutionStatusFailure, shutdownStatusDescription)
+		if err != nil {
+			log.Printf("failed to hand off execution of %v/%v@%v: %v", pr.owner, pr.name, pr.sha, err)
+		}
+	}
+
+	return ctx.Err()
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/google/go-github/github"
 	"github.com/mxinden/automation/configuration"
+	"github.com/mxinden/automation/metrics"
 )
 
 type AuthorAssociation string
@@ -19,11 +20,46 @@ var (
 	AuthorAssociationOWNER        AuthorAssociation = "OWNER"
 )
 
+// Reasons webhooks are rejected for, as reported by the webhooks rejected
+// metric.
+const (
+	rejectionInvalidPayload     = "invalid_payload"
+	rejectionUnparsablePayload  = "unparsable_payload"
+	rejectionUnsupportedEvent   = "unsupported_event"
+	rejectionUnauthorizedAuthor = "unauthorized_author"
+	rejectionUnknownRepository  = "unknown_repository"
+	rejectionShuttingDown       = "shutting_down"
+)
+
+// rejection is an error rejecting a webhook for the given reason.
+type rejection struct {
+	reason string
+	err    error
+}
+
+func (r rejection) Error() string {
+	return r.err.Error()
+}
+
+var errShuttingDown = rejection{
+	reason: rejectionShuttingDown,
+	err:    errors.New("server is shutting down"),
+}
+
 func (c *GithubConnector) TriggerHandler(w http.ResponseWriter, r *http.Request) {
+	// The event type is sent by the client, thus unknown types are
+	// aggregated to keep the number of metric labels bounded.
+	eventType := github.WebHookType(r)
+	if eventType != "pull_request" && eventType != "push" {
+		eventType = "other"
+	}
+	metrics.WebhooksReceived.WithLabelValues(eventType).Inc()
+
 	s := os.Getenv("GITHUB_WEBHOOK_SECRET")
 	payload, err := github.ValidatePayload(r, []byte(s))
 	if err != nil {
 		log.Printf("Error validating payload: %v", err)
+		metrics.WebhooksRejected.WithLabelValues(eventType, rejectionInvalidPayload).Inc()
 		http.Error(w, "error validating payload", http.StatusBadRequest)
 		return
 	}
@@ -31,6 +67,7 @@ func (c *GithubConnector) TriggerHandler(w http.ResponseWriter, r *http.Request)
 	event, err := github.ParseWebHook(github.WebHookType(r), payload)
 	if err != nil {
 		log.Printf("Error parsing payload: %v", err)
+		metrics.WebhooksRejected.WithLabelValues(eventType, rejectionUnparsablePayload).Inc()
 		http.Error(w, "error parsing payload", http.StatusBadRequest)
 		return
 	}
@@ -41,11 +78,26 @@ func (c *GithubConnector) TriggerHandler(w http.ResponseWriter, r *http.Request)
 	case *github.PushEvent:
 		err = c.processPushEvent(event)
 	default:
-		err = errors.New(fmt.Sprintf("error expecting pull request or push event but got: %v", github.WebHookType(r)))
+		err = rejection{
+			reason: rejectionUnsupportedEvent,
+			err:    errors.New(fmt.Sprintf("error expecting pull request or push event but got: %v", github.WebHookType(r))),
+		}
 	}
 	if err != nil {
 		log.Print(err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		reason := "other"
+		if r, ok := err.(rejection); ok {
+			reason = r.reason
+		}
+		metrics.WebhooksRejected.WithLabelValues(eventType, reason).Inc()
+
+		// The request is fine, the server is just not available for it
+		// anymore.
+		code := http.StatusBadRequest
+		if err == errShuttingDown {
+			code = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), code)
 	}
 
 	return
@@ -57,12 +109,24 @@ func (c *GithubConnector) processPullRequestEvent(e *github.PullRequestEvent) er
 		return err
 	}
 
-	go log.Println(c.runFromPREvent(*e))
+	if !c.executions.start() {
+		return errShuttingDown
+	}
+	go func() {
+		defer c.executions.done()
+		log.Println(c.runFromPREvent(*e))
+	}()
 	return nil
 }
 
 func (c *GithubConnector) processPushEvent(e *github.PushEvent) error {
-	go log.Println(c.runFromPushEvent(*e))
+	if !c.executions.start() {
+		return errShuttingDown
+	}
+	go func() {
+		defer c.executions.done()
+		log.Println(c.runFromPushEvent(*e))
+	}()
 	return nil
 }
 
@@ -73,21 +137,27 @@ func checkPRAuthorPermissions(c configuration.Configuration, event *github.PullR
 		event.PullRequest.GetAuthorAssociation(),
 		[]AuthorAssociation{AuthorAssociationCOLLABORATOR, AuthorAssociationMEMBER, AuthorAssociationOWNER},
 	) {
-		return errors.New(
-			fmt.Sprintf(
-				"event author not one of %v, %v, %v",
-				AuthorAssociationOWNER,
-				AuthorAssociationMEMBER,
-				AuthorAssociationCOLLABORATOR,
+		return rejection{
+			reason: rejectionUnauthorizedAuthor,
+			err: errors.New(
+				fmt.Sprintf(
+					"event author not one of %v, %v, %v",
+					AuthorAssociationOWNER,
+					AuthorAssociationMEMBER,
+					AuthorAssociationCOLLABORATOR,
+				),
 			),
-		)
+		}
 	}
 
 	if !c.ContainsRepository("github.com/" + event.Repo.GetFullName()) {
-		return errors.New(fmt.Sprintf(
-			"%v is not a configured repository",
-			event.Repo.GetFullName(),
-		))
+		return rejection{
+			reason: rejectionUnknownRepository,
+			err: errors.New(fmt.Sprintf(
+				"%v is not a configured repository",
+				event.Repo.GetFullName(),
+			)),
+		}
 	}
 	return nil
 }
@@ -2,7 +2,7 @@ package github
 
 import (
 	"github.com/mxinden/automation/configuration"
-	"github.com/mxinden/automation/executor/kubernetes"
+	"github.com/mxinden/automation/executor/fake"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -22,8 +22,7 @@ func TestTableTriggerEndpoint(t *testing.T) {
 	c := configuration.Configuration{
 		Repositories: []string{"github.com/mxinden/sample-project"},
 	}
-	executor := kubernetes.NewKubernetesExecutor("automation")
-	automationAPI := NewGithubConnector(c, &executor)
+	automationAPI := NewGithubConnector(c, fake.NewFakeExecutor())
 
 	for _, tt := range triggerEndpoinTests {
 		req, err := httpReqFromFile(tt.requestBodyPath)
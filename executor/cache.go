@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var invalidCacheKeyCharacters = regexp.MustCompile("[^A-Za-z0-9._-]+")
+
+// ResolveCacheKeys renders the key templates of all caches. A template can
+// reference files of the repository at the commit under test, which are read
+// via readFile, e.g. 'go-{{ checksum "Gopkg.lock" }}'. The rendered keys are
+// prefixed by the given scope, e.g. the repository, so different repositories
+// never share a cache.
+func ResolveCacheKeys(c ExecutionConfiguration, scope string, readFile func(path string) ([]byte, error)) (ExecutionConfiguration, error) {
+	funcs := cacheKeyFuncs(readFile)
+
+	for stageI := range c.Stages {
+		for stepI := range c.Stages[stageI].Steps {
+			step := &c.Stages[stageI].Steps[stepI]
+
+			caches := []CacheConfiguration{}
+			for _, cache := range step.Caches {
+				key, err := renderCacheKey(cache.Key, funcs)
+				if err != nil {
+					return c, fmt.Errorf("cache %v of step %v: %v", cache.Path, step.Name, err)
+				}
+				if prefix := sanitizeCacheKey(scope); prefix != "" {
+					key = prefix + "/" + key
+				}
+				cache.Key = key
+				caches = append(caches, cache)
+			}
+			step.Caches = caches
+		}
+	}
+
+	return c, nil
+}
+
+// cacheKeyFuncs returns the functions available in cache key templates.
+func cacheKeyFuncs(readFile func(path string) ([]byte, error)) template.FuncMap {
+	return template.FuncMap{
+		// checksum hashes the content of the given files.
+		"checksum": func(paths ...string) (string, error) {
+			if len(paths) == 0 {
+				return "", fmt.Errorf("checksum needs at least one file")
+			}
+
+			hash := sha256.New()
+			for _, path := range paths {
+				content, err := readFile(path)
+				if err != nil {
+					return "", fmt.Errorf("failed to read %v: %v", path, err)
+				}
+				hash.Write(content)
+			}
+			return hex.EncodeToString(hash.Sum(nil)), nil
+		},
+	}
+}
+
+func renderCacheKey(key string, funcs template.FuncMap) (string, error) {
+	t, err := template.New("key").Funcs(funcs).Parse(key)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	err = t.Execute(&b, nil)
+	if err != nil {
+		return "", err
+	}
+
+	rendered := sanitizeCacheKey(b.String())
+	if rendered == "" {
+		return "", fmt.Errorf("key %q renders empty", key)
+	}
+	return rendered, nil
+}
+
+// sanitizeCacheKey keeps slash separated segments of characters valid in keys
+// of the cache store.
+func sanitizeCacheKey(key string) string {
+	segments := []string{}
+	for _, segment := range strings.Split(key, "/") {
+		segment = invalidCacheKeyCharacters.ReplaceAllString(segment, "-")
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "/")
+}
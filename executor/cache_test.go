@@ -0,0 +1,52 @@
+package executor
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResolveCacheKeys(t *testing.T) {
+	files := map[string]string{"Gopkg.lock": "lock"}
+	readFile := func(path string) ([]byte, error) {
+		content, ok := files[path]
+		if !ok {
+			return nil, fmt.Errorf("file not found")
+		}
+		return []byte(content), nil
+	}
+
+	shared := []CacheConfiguration{{Path: "/go/pkg/dep", Key: `dep-{{ checksum "Gopkg.lock" }}`}}
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{
+				Steps: []StepConfiguration{
+					{Caches: shared},
+					{Caches: shared},
+					{Caches: []CacheConfiguration{{Path: "/root/.cache", Key: "go build/../cache"}}},
+				},
+			},
+		},
+	}
+
+	c, err := ResolveCacheKeys(c, "github.com/mxinden/automation", readFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sha256 of "lock"
+	expected := "github.com/mxinden/automation/dep-0c030586945fe504b604ecc2e875c38ede400cd5cd73da9730302162e6b02c6f"
+	for i := 0; i < 2; i++ {
+		if key := c.Stages[0].Steps[i].Caches[0].Key; key != expected {
+			t.Fatalf("expected key of step %v to be %v but got %v", i, expected, key)
+		}
+	}
+
+	if key := c.Stages[0].Steps[2].Caches[0].Key; key != "github.com/mxinden/automation/go-build/cache" {
+		t.Fatalf("expected key to be sanitized but got %v", key)
+	}
+
+	c.Stages[0].Steps[0].Caches[0].Key = `{{ checksum "missing" }}`
+	if _, err := ResolveCacheKeys(c, "", readFile); err == nil {
+		t.Fatal("expected checksum of missing file to fail")
+	}
+}
@@ -0,0 +1,122 @@
+package executor
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	EventPush        = "push"
+	EventPullRequest = "pull_request"
+	EventTag         = "tag"
+)
+
+// Condition restricts when a step or stage is run. Each field restricts the
+// run to any of the given values, empty fields don't restrict it at all. All
+// fields need to match for the condition to match.
+type Condition struct {
+	// Branches are glob patterns like "release/*" matched against the
+	// branch, or the tag, the execution was triggered for. "*" does not
+	// match "/", "**" does.
+	Branches []string `yaml:"branches"`
+	// Events are any of "push", "pull_request" and "tag".
+	Events []string `yaml:"events"`
+	// Paths are glob patterns like "docs/**" of which at least one needs to
+	// match any of the changed files. They match if the changed files are
+	// unknown, e.g. for the first push of a branch.
+	Paths []string `yaml:"paths"`
+}
+
+// ConditionContext describes what triggered an execution.
+type ConditionContext struct {
+	Branch       string
+	Event        string
+	ChangedFiles []string
+	// ChangedFilesUnknown is set if the changed files could not be
+	// determined, so paths conditions match rather than steps being skipped
+	// without notice.
+	ChangedFilesUnknown bool
+}
+
+func (c *Condition) Matches(ctx ConditionContext) bool {
+	if c == nil {
+		return true
+	}
+
+	if len(c.Branches) != 0 && !matchesAnyGlob(c.Branches, ctx.Branch) {
+		return false
+	}
+
+	if len(c.Events) != 0 && !containsString(c.Events, ctx.Event) {
+		return false
+	}
+
+	if len(c.Paths) != 0 && !ctx.ChangedFilesUnknown {
+		matched := false
+		for _, file := range ctx.ChangedFiles {
+			if matchesAnyGlob(c.Paths, file) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ApplyConditions marks all steps to be skipped whose condition, or the
+// condition of their stage, does not match the given context.
+func ApplyConditions(c ExecutionConfiguration, ctx ConditionContext) ExecutionConfiguration {
+	for stageI, stage := range c.Stages {
+		for stepI, step := range stage.Steps {
+			if !stage.When.Matches(ctx) || !step.When.Matches(ctx) {
+				c.Stages[stageI].Steps[stepI].Skip = true
+			}
+		}
+	}
+
+	return c
+}
+
+func matchesAnyGlob(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if globToRegexp(p).MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func globToRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		}
+	}
+
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
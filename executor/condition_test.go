@@ -0,0 +1,107 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConditionMatches(t *testing.T) {
+	ctx := ConditionContext{
+		Branch:       "release/v1",
+		Event:        EventPush,
+		ChangedFiles: []string{"docs/setup/README.md", "main.go"},
+	}
+
+	tests := []struct {
+		name      string
+		condition *Condition
+		matches   bool
+	}{
+		{"no condition", nil, true},
+		{"empty condition", &Condition{}, true},
+		{"branch glob", &Condition{Branches: []string{"master", "release/*"}}, true},
+		{"other branch", &Condition{Branches: []string{"master"}}, false},
+		{"single star does not cross slash", &Condition{Branches: []string{"*"}}, false},
+		{"event", &Condition{Events: []string{EventPush}}, true},
+		{"other event", &Condition{Events: []string{EventPullRequest, EventTag}}, false},
+		{"double star path", &Condition{Paths: []string{"docs/**"}}, true},
+		{"single star path", &Condition{Paths: []string{"*.go"}}, true},
+		{"unchanged path", &Condition{Paths: []string{"vendor/**"}}, false},
+		{"all fields need to match", &Condition{Branches: []string{"release/*"}, Events: []string{EventTag}}, false},
+	}
+
+	for _, tt := range tests {
+		if tt.condition.Matches(ctx) != tt.matches {
+			t.Fatalf("%v: expected condition to match to be %v", tt.name, tt.matches)
+		}
+	}
+}
+
+func TestConditionMatchesUnknownChangedFiles(t *testing.T) {
+	ctx := ConditionContext{Branch: "master", Event: EventPush, ChangedFilesUnknown: true}
+
+	if !(&Condition{Paths: []string{"docs/**"}}).Matches(ctx) {
+		t.Fatal("expected paths to match unknown changed files")
+	}
+	if (&Condition{Paths: []string{"docs/**"}, Events: []string{EventTag}}).Matches(ctx) {
+		t.Fatal("expected other fields to still need to match")
+	}
+}
+
+func TestApplyConditions(t *testing.T) {
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{
+				When: &Condition{Events: []string{EventPush}},
+				Steps: []StepConfiguration{
+					{Name: "test"},
+					{Name: "deploy", When: &Condition{Branches: []string{"master"}}},
+				},
+			},
+			{
+				When:  &Condition{Events: []string{EventTag}},
+				Steps: []StepConfiguration{{Name: "release"}},
+			},
+		},
+	}
+
+	c = ApplyConditions(c, ConditionContext{Branch: "feature", Event: EventPush})
+
+	if c.Stages[0].Steps[0].Skip {
+		t.Fatal("expected test step not to be skipped")
+	}
+
+	if !c.Stages[0].Steps[1].Skip {
+		t.Fatal("expected deploy step on feature branch to be skipped")
+	}
+
+	if !c.Stages[1].Steps[0].Skip {
+		t.Fatal("expected release step of tag stage to be skipped on push")
+	}
+}
+
+func TestDecodeExecutionConfigurationWhen(t *testing.T) {
+	rawConfig := `
+stages:
+  - steps:
+      - when:
+          branches: ["master"]
+          events: ["push"]
+        skip: true
+`
+
+	c, err := DecodeExecutionConfiguration(strings.NewReader(rawConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step := c.Stages[0].Steps[0]
+
+	if step.When.Branches[0] != "master" || step.When.Events[0] != EventPush {
+		t.Fatalf("expected when clause to be parsed properly but got %+v", step.When)
+	}
+
+	if step.Skip {
+		t.Fatal("expected skip not to be settable through the configuration")
+	}
+}
@@ -0,0 +1,271 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// client talks to the Docker Engine API over a unix socket. Paths are not
+// prefixed with an API version, thus the daemon's current version is used.
+type client struct {
+	http *http.Client
+}
+
+func newClient(socketPath string) *client {
+	return &client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// do sends a request with the given JSON body and decodes a JSON response into
+// result, if given. Non-2xx responses are returned as errors carrying the
+// message of the daemon.
+func (c *client) do(method, path string, query url.Values, body interface{}, result interface{}) error {
+	resp, err := c.request(method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (c *client) request(method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	u := "http://docker" + path
+	if len(query) != 0 {
+		u = u + "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to %v %v", method, path)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		message := struct {
+			Message string `json:"message"`
+		}{}
+		raw, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(raw, &message) != nil || message.Message == "" {
+			message.Message = strings.TrimSpace(string(raw))
+		}
+		return nil, apiError{statusCode: resp.StatusCode, message: message.Message}
+	}
+
+	return resp, nil
+}
+
+type apiError struct {
+	statusCode int
+	message    string
+}
+
+func (e apiError) Error() string {
+	return fmt.Sprintf("docker daemon responded with %v: %v", e.statusCode, e.message)
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(apiError)
+	return ok && e.statusCode == http.StatusNotFound
+}
+
+type containerConfig struct {
+	Image      string     `json:"Image"`
+	Entrypoint []string   `json:"Entrypoint,omitempty"`
+	Cmd        []string   `json:"Cmd,omitempty"`
+	Env        []string   `json:"Env,omitempty"`
+	WorkingDir string     `json:"WorkingDir,omitempty"`
+	User       string     `json:"User,omitempty"`
+	HostConfig hostConfig `json:"HostConfig"`
+}
+
+type hostConfig struct {
+	Binds      []string `json:"Binds,omitempty"`
+	Privileged bool     `json:"Privileged,omitempty"`
+	Memory     int64    `json:"Memory,omitempty"`
+	NanoCPUs   int64    `json:"NanoCpus,omitempty"`
+}
+
+type containerState struct {
+	ExitCode   int32     `json:"ExitCode"`
+	OOMKilled  bool      `json:"OOMKilled"`
+	Error      string    `json:"Error"`
+	StartedAt  time.Time `json:"StartedAt"`
+	FinishedAt time.Time `json:"FinishedAt"`
+}
+
+func (c *client) createContainer(name string, config containerConfig) (string, error) {
+	created := struct {
+		ID string `json:"Id"`
+	}{}
+	err := c.do("POST", "/containers/create", url.Values{"name": {name}}, config, &created)
+	return created.ID, err
+}
+
+func (c *client) startContainer(id string) error {
+	return c.do("POST", "/containers/"+id+"/start", nil, nil, nil)
+}
+
+func (c *client) waitContainer(id string) error {
+	return c.do("POST", "/containers/"+id+"/wait", nil, nil, nil)
+}
+
+func (c *client) inspectContainer(id string) (containerState, error) {
+	inspected := struct {
+		State containerState `json:"State"`
+	}{}
+	err := c.do("GET", "/containers/"+id+"/json", nil, nil, &inspected)
+	return inspected.State, err
+}
+
+// containerLogs returns stdout and stderr of the given container interleaved.
+func (c *client) containerLogs(id string) (string, error) {
+	resp, err := c.request("GET", "/containers/"+id+"/logs", url.Values{"stdout": {"1"}, "stderr": {"1"}}, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	return demultiplexLogs(resp.Body)
+}
+
+// demultiplexLogs strips the headers of the log stream of a container without
+// a TTY. Each frame is prefixed by the stream type and its big endian length.
+func demultiplexLogs(r io.Reader) (string, error) {
+	var logs bytes.Buffer
+	header := make([]byte, 8)
+
+	for {
+		_, err := io.ReadFull(r, header)
+		if err == io.EOF {
+			return logs.String(), nil
+		}
+		if err != nil {
+			return logs.String(), err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		_, err = io.CopyN(&logs, r, size)
+		if err != nil {
+			return logs.String(), err
+		}
+	}
+}
+
+func (c *client) removeContainer(id string) error {
+	return c.do("DELETE", "/containers/"+id, url.Values{"force": {"1"}, "v": {"1"}}, nil, nil)
+}
+
+// imageDigest returns the digest of the given local image, if it has been
+// pulled from a registry.
+func (c *client) imageDigest(image string) (string, error) {
+	inspected := struct {
+		RepoDigests []string `json:"RepoDigests"`
+	}{}
+	err := c.do("GET", "/images/"+image+"/json", nil, nil, &inspected)
+	if err != nil || len(inspected.RepoDigests) == 0 {
+		return "", err
+	}
+
+	digest := inspected.RepoDigests[0]
+	return digest[strings.Index(digest, "@")+1:], nil
+}
+
+// pullImage pulls the given image unless it is present already.
+func (c *client) pullImage(image string) error {
+	_, err := c.imageDigest(image)
+	if err == nil {
+		return nil
+	}
+	if !isNotFound(err) {
+		return err
+	}
+
+	fromImage, tag := splitImageTag(image)
+	resp, err := c.request("POST", "/images/create", url.Values{"fromImage": {fromImage}, "tag": {tag}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Failures during the pull are reported within the progress stream.
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		progress := struct {
+			Error string `json:"error"`
+		}{}
+		err := decoder.Decode(&progress)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if progress.Error != "" {
+			return errors.New(progress.Error)
+		}
+	}
+}
+
+// splitImageTag splits "golang:1.10" into "golang" and "1.10", defaulting to
+// the "latest" tag, as the daemon pulls all tags otherwise.
+func splitImageTag(image string) (string, string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+
+	i := strings.LastIndex(image, ":")
+	if i == -1 || strings.Contains(image[i:], "/") {
+		return image, "latest"
+	}
+	return image[:i], image[i+1:]
+}
+
+func (c *client) createVolume(name string) error {
+	return c.do("POST", "/volumes/create", nil, map[string]string{"Name": name}, nil)
+}
+
+func (c *client) removeVolume(name string) error {
+	return c.do("DELETE", "/volumes/"+name, url.Values{"force": {"1"}}, nil, nil)
+}
@@ -0,0 +1,323 @@
+package docker
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxinden/automation/executor"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+)
+
+const DefaultSocketPath = "/var/run/docker.sock"
+
+// DockerExecutor runs steps as containers of a local Docker daemon, e.g. to
+// try out a pipeline without access to a Kubernetes cluster. Only emptyDir and
+// hostPath volumes are supported, services and artifacts are not. Caches and
+// test report files are ignored, test reports in the output are parsed.
+type DockerExecutor struct {
+	client *client
+}
+
+func NewDockerExecutor(socketPath string) DockerExecutor {
+	return DockerExecutor{client: newClient(socketPath)}
+}
+
+// Execute runs the steps of the given configuration, each as soon as the steps
+// it depends on succeeded.
+func (d *DockerExecutor) Execute(c executor.ExecutionConfiguration) (executor.ExecutionResult, error) {
+	return executor.ExecuteGraph(c, d.executeStep)
+}
+
+// executeStep runs the init containers of the given step one after another
+// and then all its containers in parallel, mirroring the semantics of a pod.
+func (d *DockerExecutor) executeStep(step executor.StepConfiguration) (executor.StepResult, error) {
+	stepResult := executor.StepResult{}
+
+	if len(step.Services) != 0 {
+		return stepResult, errors.New("services are not supported by the docker executor")
+	}
+
+	if len(step.Artifacts) != 0 {
+		return stepResult, errors.New("artifacts are not supported by the docker executor")
+	}
+
+	if hasTestReportFiles(step.TestReports) {
+		log.Printf("ignoring test report files of step %v, as they are not supported by the docker executor", step.Name)
+	}
+
+	// Caches only speed up steps, thus steps run without them.
+	if len(step.Caches) != 0 {
+		log.Printf("ignoring caches of step %v, as they are not supported by the docker executor", step.Name)
+	}
+
+	prefix := getNamePrefix(step.Name)
+
+	binds, err := d.createVolumes(prefix, step.Volumes)
+	defer d.removeVolumes(prefix, step.Volumes)
+	if err != nil {
+		return stepResult, err
+	}
+
+	stepResult.StartTime = time.Now()
+
+	initContainersSucceeded := true
+	for i, c := range step.InitContainers {
+		if !initContainersSucceeded {
+			stepResult.InitContainers = append(stepResult.InitContainers, didNotRun(c, "PodInitializing"))
+			continue
+		}
+
+		result, _, err := d.runContainer(fmt.Sprintf("%v-init-container-%v", prefix, i), c, binds)
+		if err != nil {
+			return stepResult, err
+		}
+		stepResult.InitContainers = append(stepResult.InitContainers, result)
+		initContainersSucceeded = result.DidSucceed()
+	}
+
+	if !initContainersSucceeded {
+		for _, c := range step.Containers {
+			stepResult.Containers = append(stepResult.Containers, didNotRun(c, "PodInitializing"))
+		}
+		stepResult.CompletionTime = time.Now()
+		return stepResult, nil
+	}
+
+	results := make([]executor.ContainerResult, len(step.Containers))
+	logs := make([]string, len(step.Containers))
+	errs := make([]error, len(step.Containers))
+
+	var wg sync.WaitGroup
+	for i, c := range step.Containers {
+		wg.Add(1)
+		go func(i int, c executor.ContainerConfiguration) {
+			defer wg.Done()
+			results[i], logs[i], errs[i] = d.runContainer(fmt.Sprintf("%v-container-%v", prefix, i), c, binds)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return stepResult, err
+		}
+	}
+
+	stepResult.Containers = results
+	stepResult.Output = strings.Join(logs, "")
+	stepResult.CompletionTime = time.Now()
+
+	if len(step.TestReports) != 0 {
+		stepResult.TestSuites, err = executor.ParseTestReports(step.TestReports, stepResult.Output, map[int]string{})
+		if err != nil {
+			log.Printf("failed to parse test reports of step %v: %v", step.Name, err)
+		}
+	}
+
+	return stepResult, nil
+}
+
+// runContainer runs the given container to completion and returns its result
+// and logs. A container whose image can't be pulled did not run, which is not
+// an error of the executor.
+func (d *DockerExecutor) runContainer(name string, c executor.ContainerConfiguration, binds map[string]string) (executor.ContainerResult, string, error) {
+	err := d.client.pullImage(c.Image)
+	if err != nil {
+		result := didNotRun(c, "ErrImagePull")
+		result.Message = err.Error()
+		return result, err.Error(), nil
+	}
+
+	config, err := containerConfToDockerConfig(c, binds)
+	if err != nil {
+		return executor.ContainerResult{}, "", err
+	}
+
+	id, err := d.client.createContainer(name, config)
+	if err != nil {
+		return executor.ContainerResult{}, "", errors.Wrapf(err, "failed to create container %v", name)
+	}
+	defer d.client.removeContainer(id)
+
+	err = d.client.startContainer(id)
+	if err != nil {
+		return executor.ContainerResult{}, "", errors.Wrapf(err, "failed to start container %v", name)
+	}
+
+	err = d.client.waitContainer(id)
+	if err != nil {
+		return executor.ContainerResult{}, "", errors.Wrapf(err, "failed to wait for container %v", name)
+	}
+
+	state, err := d.client.inspectContainer(id)
+	if err != nil {
+		return executor.ContainerResult{}, "", errors.Wrapf(err, "failed to inspect container %v", name)
+	}
+
+	logs, err := d.client.containerLogs(id)
+	if err != nil {
+		return executor.ContainerResult{}, "", errors.Wrapf(err, "failed to retrieve logs of container %v", name)
+	}
+
+	digest, err := d.client.imageDigest(c.Image)
+	if err != nil {
+		return executor.ContainerResult{}, "", errors.Wrapf(err, "failed to inspect image %v", c.Image)
+	}
+
+	result := getContainerResult(c, state)
+	result.ImageDigest = digest
+
+	return result, logs, nil
+}
+
+func getContainerResult(c executor.ContainerConfiguration, state containerState) executor.ContainerResult {
+	result := executor.ContainerResult{
+		Name:           c.Name,
+		Image:          c.Image,
+		State:          executor.ContainerStateTerminated,
+		ExitCode:       state.ExitCode,
+		StartTime:      state.StartedAt,
+		CompletionTime: state.FinishedAt,
+		Message:        state.Error,
+	}
+
+	// Follow the reasons given by Kubernetes.
+	switch {
+	case state.OOMKilled:
+		result.Reason = "OOMKilled"
+	case state.ExitCode == 0:
+		result.Reason = "Completed"
+	default:
+		result.Reason = "Error"
+	}
+
+	return result
+}
+
+func didNotRun(c executor.ContainerConfiguration, reason string) executor.ContainerResult {
+	return executor.ContainerResult{
+		Name:   c.Name,
+		Image:  c.Image,
+		State:  executor.ContainerStateDidNotRun,
+		Reason: reason,
+	}
+}
+
+func containerConfToDockerConfig(c executor.ContainerConfiguration, binds map[string]string) (containerConfig, error) {
+	config := containerConfig{
+		Image:      c.Image,
+		WorkingDir: c.WorkingDir,
+	}
+
+	// Like the kubelet, each environment variable can reference the ones
+	// defined before it, commands and arguments can reference all of them.
+	mapping := map[string]string{}
+	for _, e := range c.Env {
+		if e.ValueFrom != nil {
+			return config, fmt.Errorf("env %v: valueFrom is not supported by the docker executor", e.Name)
+		}
+		value := expandVariables(e.Value, mapping)
+		mapping[e.Name] = value
+		config.Env = append(config.Env, e.Name+"="+value)
+	}
+
+	entrypoint, args := c.Process()
+	config.Entrypoint = expandVariablesList(entrypoint, mapping)
+	config.Cmd = expandVariablesList(args, mapping)
+
+	for _, m := range c.VolumeMounts {
+		source, ok := binds[m.Name]
+		if !ok {
+			return config, fmt.Errorf("volume mount of unknown volume %v", m.Name)
+		}
+		config.HostConfig.Binds = append(config.HostConfig.Binds, source+":"+m.MountPath)
+	}
+
+	if c.SecurityContext != nil {
+		if c.SecurityContext.Privileged != nil {
+			config.HostConfig.Privileged = *c.SecurityContext.Privileged
+		}
+		if c.SecurityContext.RunAsUser != nil {
+			config.User = fmt.Sprint(*c.SecurityContext.RunAsUser)
+		}
+	}
+
+	if memory, ok := c.Resources.Limits[v1.ResourceMemory]; ok {
+		config.HostConfig.Memory = memory.Value()
+	}
+	if cpu, ok := c.Resources.Limits[v1.ResourceCPU]; ok {
+		config.HostConfig.NanoCPUs = cpu.MilliValue() * 1000000
+	}
+
+	return config, nil
+}
+
+// createVolumes creates a named Docker volume for every emptyDir volume and
+// returns the bind source of every volume by its name.
+func (d *DockerExecutor) createVolumes(prefix string, volumes []v1.Volume) (map[string]string, error) {
+	binds := map[string]string{}
+
+	for _, v := range volumes {
+		switch {
+		case v.EmptyDir != nil:
+			name := prefix + "-" + v.Name
+			err := d.client.createVolume(name)
+			if err != nil {
+				return binds, errors.Wrapf(err, "failed to create volume %v", name)
+			}
+			binds[v.Name] = name
+		case v.HostPath != nil:
+			binds[v.Name] = v.HostPath.Path
+		default:
+			return binds, fmt.Errorf("volume %v: only emptyDir and hostPath volumes are supported by the docker executor", v.Name)
+		}
+	}
+
+	return binds, nil
+}
+
+func (d *DockerExecutor) removeVolumes(prefix string, volumes []v1.Volume) {
+	for _, v := range volumes {
+		if v.EmptyDir != nil {
+			d.client.removeVolume(prefix + "-" + v.Name)
+		}
+	}
+}
+
+var invalidNameCharacters = regexp.MustCompile("[^a-zA-Z0-9_.-]+")
+
+var letters = []rune("abcdefghijklmnopqrstuvwxyz")
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// getNamePrefix returns a prefix unique to one execution of the given step for
+// the names of its containers and volumes.
+func getNamePrefix(stepName string) string {
+	suffix := make([]rune, 10)
+	for i := range suffix {
+		suffix[i] = letters[rand.Intn(len(letters))]
+	}
+
+	name := strings.Trim(invalidNameCharacters.ReplaceAllString(stepName, "-"), "-")
+	if name == "" {
+		return "automation-" + string(suffix)
+	}
+	return "automation-" + name + "-" + string(suffix)
+}
+
+func hasTestReportFiles(reports []executor.TestReportConfiguration) bool {
+	for _, r := range reports {
+		if r.Path != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mxinden/automation/executor"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestDemultiplexLogs(t *testing.T) {
+	var stream bytes.Buffer
+	for i, frame := range []string{"hello ", "world\n"} {
+		header := make([]byte, 8)
+		header[0] = byte(i + 1)
+		binary.BigEndian.PutUint32(header[4:], uint32(len(frame)))
+		stream.Write(header)
+		stream.WriteString(frame)
+	}
+
+	logs, err := demultiplexLogs(&stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if logs != "hello world\n" {
+		t.Fatalf("expected logs %q but got %q", "hello world\n", logs)
+	}
+}
+
+func TestSplitImageTag(t *testing.T) {
+	tests := []struct {
+		image     string
+		fromImage string
+		tag       string
+	}{
+		{"golang", "golang", "latest"},
+		{"golang:1.10", "golang", "1.10"},
+		{"localhost:5000/golang", "localhost:5000/golang", "latest"},
+		{"localhost:5000/golang:1.10", "localhost:5000/golang", "1.10"},
+		{"golang@sha256:abc", "golang@sha256:abc", ""},
+	}
+
+	for _, test := range tests {
+		fromImage, tag := splitImageTag(test.image)
+		if fromImage != test.fromImage || tag != test.tag {
+			t.Fatalf("expected %v to be split into %v and %v but got %v and %v", test.image, test.fromImage, test.tag, fromImage, tag)
+		}
+	}
+}
+
+func TestContainerConfToDockerConfig(t *testing.T) {
+	privileged := true
+	c := executor.ContainerConfiguration{
+		Image:        "golang",
+		Command:      "go test",
+		WorkingDir:   "/src",
+		Env:          []v1.EnvVar{{Name: "CGO_ENABLED", Value: "0"}},
+		VolumeMounts: []executor.VolumeMount{{Name: "src", MountPath: "/src"}},
+		SecurityContext: &v1.SecurityContext{
+			Privileged: &privileged,
+		},
+		Resources: v1.ResourceRequirements{
+			Limits: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("500m"),
+				v1.ResourceMemory: resource.MustParse("1Gi"),
+			},
+		},
+	}
+
+	config, err := containerConfToDockerConfig(c, map[string]string{"src": "automation-test-src"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := containerConfig{
+		Image:      "golang",
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        []string{"go test"},
+		Env:        []string{"CGO_ENABLED=0"},
+		WorkingDir: "/src",
+		HostConfig: hostConfig{
+			Binds:      []string{"automation-test-src:/src"},
+			Privileged: true,
+			Memory:     1024 * 1024 * 1024,
+			NanoCPUs:   500000000,
+		},
+	}
+
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("expected %+v but got %+v", expected, config)
+	}
+
+	c.VolumeMounts = []executor.VolumeMount{{Name: "unknown", MountPath: "/unknown"}}
+	_, err = containerConfToDockerConfig(c, map[string]string{})
+	if err == nil {
+		t.Fatal("expected mount of unknown volume to fail")
+	}
+}
+
+func TestExpandVariables(t *testing.T) {
+	mapping := map[string]string{"GIT_SHA": "1234", "EMPTY": ""}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"git checkout $(GIT_SHA)", "git checkout 1234"},
+		{"$(GIT_SHA)$(GIT_SHA)", "12341234"},
+		{"echo $(UNKNOWN)", "echo $(UNKNOWN)"},
+		{"echo x$(EMPTY)x", "echo xx"},
+		{"echo $$(GIT_SHA)", "echo $(GIT_SHA)"},
+		{"echo $HOME ${HOME}", "echo $HOME ${HOME}"},
+		{"echo $(GIT_SHA", "echo $(GIT_SHA"},
+		{"echo $", "echo $"},
+	}
+
+	for _, test := range tests {
+		if expanded := expandVariables(test.input, mapping); expanded != test.expected {
+			t.Fatalf("expected %q to be expanded to %q but got %q", test.input, test.expected, expanded)
+		}
+	}
+}
+
+func TestContainerConfToDockerConfigExpandsVariables(t *testing.T) {
+	c := executor.ContainerConfiguration{
+		Image:   "alpine/git",
+		Command: "git checkout $(GIT_SHA) && echo $(REF)",
+		Env: []v1.EnvVar{
+			{Name: "GIT_SHA", Value: "1234"},
+			{Name: "REF", Value: "sha-$(GIT_SHA)"},
+		},
+	}
+
+	config, err := containerConfToDockerConfig(c, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(config.Cmd, []string{"git checkout 1234 && echo sha-1234"}) {
+		t.Fatalf("expected variables to be expanded in the command but got %v", config.Cmd)
+	}
+	if !reflect.DeepEqual(config.Env, []string{"GIT_SHA=1234", "REF=sha-1234"}) {
+		t.Fatalf("expected variables to be expanded in the environment but got %v", config.Env)
+	}
+}
+
+func TestGetContainerResult(t *testing.T) {
+	c := executor.ContainerConfiguration{Image: "golang"}
+
+	result := getContainerResult(c, containerState{ExitCode: 137, OOMKilled: true})
+	if result.DidSucceed() || result.Reason != "OOMKilled" {
+		t.Fatalf("expected OOM killed container to fail but got %+v", result)
+	}
+
+	result = getContainerResult(c, containerState{ExitCode: 0})
+	if !result.DidSucceed() {
+		t.Fatalf("expected container to succeed but got %+v", result)
+	}
+}
+
+func TestGetNamePrefix(t *testing.T) {
+	prefix := getNamePrefix("test (go=1.10)")
+	if !strings.HasPrefix(prefix, "automation-test-go-1.10-") {
+		t.Fatalf("expected sanitized step name in prefix but got %v", prefix)
+	}
+
+	if getNamePrefix("a") == getNamePrefix("a") {
+		t.Fatal("expected prefixes to be unique")
+	}
+}
+
+// TestExecute runs a pipeline against the local Docker daemon, if there is
+// one.
+func TestExecute(t *testing.T) {
+	if _, err := os.Stat(DefaultSocketPath); err != nil {
+		t.Skip("no docker daemon available")
+	}
+
+	c := executor.ExecutionConfiguration{
+		Stages: []executor.StageConfiguration{
+			{
+				Steps: []executor.StepConfiguration{
+					{
+						Volumes: []v1.Volume{{Name: "shared", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}},
+						InitContainers: []executor.ContainerConfiguration{
+							{Image: "alpine", Command: "echo $GREETING > /shared/greeting", Env: []v1.EnvVar{{Name: "GREETING", Value: "hello"}}, VolumeMounts: []executor.VolumeMount{{Name: "shared", MountPath: "/shared"}}},
+						},
+						Containers: []executor.ContainerConfiguration{
+							{Image: "alpine", Command: "cat greeting", WorkingDir: "/shared", VolumeMounts: []executor.VolumeMount{{Name: "shared", MountPath: "/shared"}}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	d := NewDockerExecutor(DefaultSocketPath)
+	result, err := d.Execute(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.DidSucceed() {
+		t.Fatalf("expected pipeline to succeed but got %+v", result)
+	}
+
+	if output := result.Stages[0].Steps[0].Output; output != "hello\n" {
+		t.Fatalf("expected output %q but got %q", "hello\n", output)
+	}
+}
@@ -0,0 +1,68 @@
+package docker
+
+import (
+	"bytes"
+)
+
+// expandVariables replaces references of the form $(VAR) with the value of
+// VAR in the given mapping, like the kubelet does for the commands, arguments
+// and environment variables of containers. References to unknown variables
+// are kept as is, $$ escapes a $.
+func expandVariables(input string, mapping map[string]string) string {
+	var buf bytes.Buffer
+	checkpoint := 0
+
+	for cursor := 0; cursor < len(input); cursor++ {
+		if input[cursor] != '$' || cursor+1 >= len(input) {
+			continue
+		}
+
+		buf.WriteString(input[checkpoint:cursor])
+
+		name, isReference, advance := readVariableReference(input[cursor+1:])
+		if !isReference {
+			buf.WriteString(name)
+		} else if value, ok := mapping[name]; ok {
+			buf.WriteString(value)
+		} else {
+			buf.WriteString("$(" + name + ")")
+		}
+
+		cursor += advance
+		checkpoint = cursor + 1
+	}
+
+	return buf.String() + input[checkpoint:]
+}
+
+// readVariableReference reads what follows a $. It returns either the name of
+// the referenced variable or the literal text to write, whether it is a
+// reference and the number of bytes read.
+func readVariableReference(input string) (string, bool, int) {
+	switch input[0] {
+	case '$':
+		return "$", false, 1
+	case '(':
+		for i := 1; i < len(input); i++ {
+			if input[i] == ')' {
+				return input[1:i], true, i + 1
+			}
+		}
+		return "$(", false, 1
+	default:
+		return "$" + input[:1], false, 1
+	}
+}
+
+// expandVariablesList expands the variables of all elements into a new list.
+func expandVariablesList(list []string, mapping map[string]string) []string {
+	if list == nil {
+		return nil
+	}
+
+	expanded := []string{}
+	for _, s := range list {
+		expanded = append(expanded, expandVariables(s, mapping))
+	}
+	return expanded
+}
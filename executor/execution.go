@@ -4,37 +4,159 @@ import (
 	"io"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	"strings"
 	"time"
 )
 
 type ExecutionConfiguration struct {
-	Stages []StageConfiguration `yaml:"stages"`
+	// Variables are referenced as ${{ NAME }} and resolved by
+	// ResolveVariables.
+	Variables map[string]string `yaml:"variables"`
+	// Templates are steps other steps can extend.
+	Templates map[string]StepConfiguration `yaml:"templates"`
+	Stages    []StageConfiguration         `yaml:"stages"`
 }
 
+// DecodeExecutionConfiguration decodes the given configuration, applies step
+// templates and expands build matrices. Variables are left untouched, as they
+// might reference values only known at execution time.
 func DecodeExecutionConfiguration(r io.Reader) (ExecutionConfiguration, error) {
 	c := ExecutionConfiguration{}
 	err := yaml.NewYAMLOrJSONDecoder(r, 4096).Decode(&c)
-	return c, err
+	if err != nil {
+		return c, err
+	}
+
+	c, err = ApplyTemplates(c)
+	if err != nil {
+		return c, err
+	}
+
+	return ExpandMatrices(c)
 }
 
 type StageConfiguration struct {
+	Name  string              `yaml:"name"`
+	When  *Condition          `yaml:"when"`
 	Steps []StepConfiguration `yaml:"steps"`
 }
 
 type StepConfiguration struct {
+	// Name identifies the step within the configuration, e.g. to be
+	// referenced in DependsOn of other steps.
+	Name string `yaml:"name"`
+	// Extends names a template of which all fields not set on the step are
+	// taken.
+	Extends string `yaml:"extends"`
+	// DependsOn lists the names of the steps that need to succeed before this
+	// step is run. Without it a step depends on all steps of the previous
+	// stage.
+	DependsOn []string   `yaml:"dependsOn"`
+	When      *Condition `yaml:"when"`
+	// Matrix expands the step into one step per combination of its axes.
+	Matrix *Matrix `yaml:"matrix"`
+	// Skip is set by ApplyConditions. It can not be set in a configuration
+	// file.
+	Skip               bool                     `json:"-" yaml:"-"`
 	InitContainers     []ContainerConfiguration `yaml:"initContainers"`
 	Containers         []ContainerConfiguration `yaml:"containers"`
 	Volumes            []v1.Volume              `yaml:"volumes"`
 	ServiceAccountName string                   `yaml:"serviceAccountName"`
+	NodeSelector       map[string]string        `yaml:"nodeSelector"`
+	Tolerations        []v1.Toleration          `yaml:"tolerations"`
+	Affinity           *v1.Affinity             `yaml:"affinity"`
+	PriorityClassName  string                   `yaml:"priorityClassName"`
+	Services           []ServiceConfiguration   `yaml:"services"`
+	// Cluster names the cluster the step runs in. ClusterSelector selects
+	// the cluster by its labels instead, e.g. "arch: arm64". Without either,
+	// the step runs in the default cluster of the server.
+	Cluster         string            `yaml:"cluster"`
+	ClusterSelector map[string]string `yaml:"clusterSelector"`
+	// Artifacts are absolute paths of files or directories within the
+	// volumes of the step, collected once all containers of the step
+	// terminated.
+	Artifacts []string `yaml:"artifacts"`
+	// Caches are restored right before the containers of the step start and
+	// saved once all of them succeeded.
+	Caches []CacheConfiguration `yaml:"caches"`
+	// TestReports are parsed into structured test results once all
+	// containers of the step terminated.
+	TestReports []TestReportConfiguration `yaml:"testReports"`
+}
+
+// CacheConfiguration describes a directory kept across executions, e.g. the
+// downloaded dependencies of a build.
+type CacheConfiguration struct {
+	// Path is the absolute path of the directory within the volumes of the
+	// step.
+	Path string `yaml:"path"`
+	// Key identifies the content of the cache. It is a template, which can
+	// hash files of the repository, e.g. 'go-{{ checksum "Gopkg.lock" }}'.
+	// See ResolveCacheKeys.
+	Key string `yaml:"key"`
+}
+
+// TestReportConfiguration describes a report of the tests run by a step.
+type TestReportConfiguration struct {
+	// Format is either "junit" for JUnit XML or "go-test-json" for the
+	// output of "go test -json".
+	Format string `yaml:"format"`
+	// Path is the absolute path of the report within the volumes of the
+	// step. go-test-json reports without a path are parsed from the output
+	// of the step.
+	Path string `yaml:"path"`
+}
+
+// ServiceConfiguration describes a long-running helper container, e.g. a
+// database, running alongside the containers of a step. Services are reachable
+// on localhost and are stopped once all containers of the step terminated.
+type ServiceConfiguration struct {
+	Name string `yaml:"name"`
+	// Command is optional for services. If empty the entrypoint of the image
+	// is used.
+	ContainerConfiguration `yaml:",inline"`
+	// ReadinessCheck is a shell command run inside the service container.
+	// The containers of the step only start once it succeeded.
+	ReadinessCheck string `yaml:"readinessCheck"`
 }
 
 type ContainerConfiguration struct {
-	Command         string              `yaml:"command"`
-	Image           string              `yaml:"image"`
-	Env             []v1.EnvVar         `yaml:"env"`
-	VolumeMounts    []VolumeMount       `yaml:"volumeMounts"`
-	WorkingDir      string              `yaml:"workingDir"`
-	SecurityContext *v1.SecurityContext `yaml:"securityContext"`
+	// Name is used to derive the name of the container in Kubernetes, thus
+	// it needs to be unique within a step.
+	Name string `yaml:"name"`
+	// Command is run by the shell of the container. Containers without a
+	// shell, like distroless images, are given Entrypoint and Args instead.
+	Command string `yaml:"command"`
+	// Shell runs Command, e.g. "bash -eo pipefail". Defaults to "/bin/sh".
+	Shell string `yaml:"shell"`
+	// Entrypoint replaces the entrypoint of the image, if given.
+	Entrypoint []string `yaml:"entrypoint"`
+	// Args are passed to the entrypoint as is.
+	Args            []string                `yaml:"args"`
+	Image           string                  `yaml:"image"`
+	Env             []v1.EnvVar             `yaml:"env"`
+	VolumeMounts    []VolumeMount           `yaml:"volumeMounts"`
+	WorkingDir      string                  `yaml:"workingDir"`
+	SecurityContext *v1.SecurityContext     `yaml:"securityContext"`
+	Resources       v1.ResourceRequirements `yaml:"resources"`
+}
+
+// DefaultShell runs the command of containers not configuring a shell.
+const DefaultShell = "/bin/sh"
+
+// Process returns the entrypoint and arguments to start the container with. A
+// nil entrypoint keeps the entrypoint of the image.
+func (c *ContainerConfiguration) Process() ([]string, []string) {
+	if c.Command == "" {
+		return c.Entrypoint, c.Args
+	}
+
+	shell := c.Shell
+	if shell == "" {
+		shell = DefaultShell
+	}
+
+	return append(strings.Fields(shell), "-c"), []string{c.Command}
 }
 
 type VolumeMount struct {
@@ -56,34 +178,110 @@ func (r *ExecutionResult) DidSucceed() bool {
 }
 
 type StageResult struct {
+	Name  string
 	Steps []StepResult
 }
 
 func (r *StageResult) DidSucceed() bool {
 	for _, stepResult := range r.Steps {
-		for _, containerResult := range stepResult.Containers {
-			if containerResult.ExitCode != 0 {
-				return false
-			}
-		}
-		for _, initContainerResult := range stepResult.InitContainers {
-			if initContainerResult.ExitCode != 0 {
-				return false
-			}
-
+		if !stepResult.DidSucceed() {
+			return false
 		}
 	}
 	return true
 }
 
 type StepResult struct {
+	Name string
+	// Skipped steps did not run, as their condition did not match.
+	Skipped bool
+	// NotRun steps did not run, as a step they depend on failed or the
+	// execution failed with an error. They don't succeed.
+	NotRun         bool
 	InitContainers []ContainerResult
 	Containers     []ContainerResult
+	// Services don't influence whether a step succeeded.
+	Services []ContainerResult
+	// Artifacts are the collected artifacts of the step. Artifacts which
+	// could not be collected, e.g. because their path did not exist, are
+	// missing.
+	Artifacts []Artifact
+	// Caches lists whether the caches of the step were restored and saved.
+	Caches []CacheResult
+	// TestSuites are the results of the test reports of the step.
+	TestSuites     []TestSuiteResult
 	Output         string
 	StartTime      time.Time
 	CompletionTime time.Time
 }
 
+func (r *StepResult) DidSucceed() bool {
+	if r.NotRun {
+		return false
+	}
+	for _, containerResult := range r.Containers {
+		if !containerResult.DidSucceed() {
+			return false
+		}
+	}
+	for _, initContainerResult := range r.InitContainers {
+		if !initContainerResult.DidSucceed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Artifact is a collected file or directory, stored as a gzipped tarball.
+type Artifact struct {
+	Path string
+	// Key identifies the artifact in the artifact store.
+	Key string
+}
+
+type CacheResult struct {
+	Path string
+	Key  string
+	// Restored is false on a cache miss.
+	Restored bool
+	// Saved is true if the cache was missed and saved after the step
+	// succeeded.
+	Saved bool
+}
+
+type ContainerState string
+
+var (
+	// ContainerStateDidNotRun is the state of a container that never started,
+	// e.g. because its image could not be pulled or a previous init container
+	// failed.
+	ContainerStateDidNotRun ContainerState = "did not run"
+	// ContainerStateRunning is the state of a container that started but was
+	// stopped before terminating on its own.
+	ContainerStateRunning    ContainerState = "running"
+	ContainerStateTerminated ContainerState = "terminated"
+)
+
 type ContainerResult struct {
-	ExitCode int32
+	Name  string
+	Image string
+	// ImageDigest is the digest of the image the container actually ran, if
+	// known.
+	ImageDigest    string
+	State          ContainerState
+	ExitCode       int32
+	StartTime      time.Time
+	CompletionTime time.Time
+	// Reason states why the container terminated, or why it is not
+	// terminated, e.g. because its image could not be pulled or its pod got
+	// evicted.
+	Reason       string
+	Message      string
+	RestartCount int32
+}
+
+// DidSucceed returns true only for containers which actually terminated with a
+// zero exit code.
+func (r *ContainerResult) DidSucceed() bool {
+	return r.State == ContainerStateTerminated && r.ExitCode == 0
 }
@@ -2,6 +2,7 @@ package executor
 
 import (
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -36,3 +37,115 @@ func TestDecodeExecutionConfigurationPrivileged(t *testing.T) {
 		t.Fatal("expected container security context to be privileged")
 	}
 }
+
+func TestDecodeExecutionConfigurationResources(t *testing.T) {
+	rawContent, err := os.Open("./execution_test_resources_fixture.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := DecodeExecutionConfiguration(rawContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step := c.Stages[0].Steps[0]
+
+	if step.NodeSelector["disktype"] != "ssd" || step.Tolerations[0].Key != "dedicated" || step.PriorityClassName != "low" {
+		t.Fatal("expected scheduling configuration to be parsed properly in execution configuration decoding")
+	}
+
+	if cpu := step.Containers[0].Resources.Requests["cpu"]; cpu.String() != "500m" {
+		t.Fatalf("expected cpu request 500m but got %v", cpu.String())
+	}
+}
+
+func TestDecodeExecutionConfigurationServices(t *testing.T) {
+	rawContent, err := os.Open("./execution_test_services_fixture.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := DecodeExecutionConfiguration(rawContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := c.Stages[0].Steps[0].Services[0]
+
+	if service.Name != "postgres" || service.Image != "postgres" || service.ReadinessCheck != "pg_isready -h localhost" {
+		t.Fatalf("expected service to be parsed properly in execution configuration decoding but got %+v", service)
+	}
+}
+
+func TestStageResultDidSucceed(t *testing.T) {
+	tests := []struct {
+		name       string
+		containers []ContainerResult
+		succeeded  bool
+	}{
+		{
+			name:       "zero exit code",
+			containers: []ContainerResult{{State: ContainerStateTerminated, ExitCode: 0}},
+			succeeded:  true,
+		},
+		{
+			name:       "non-zero exit code",
+			containers: []ContainerResult{{State: ContainerStateTerminated, ExitCode: 1}},
+			succeeded:  false,
+		},
+		{
+			name:       "did not run",
+			containers: []ContainerResult{{State: ContainerStateDidNotRun}},
+			succeeded:  false,
+		},
+		{
+			name:       "still running",
+			containers: []ContainerResult{{State: ContainerStateRunning}},
+			succeeded:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		r := StageResult{Steps: []StepResult{{Containers: tt.containers}}}
+		if r.DidSucceed() != tt.succeeded {
+			t.Fatalf("%v: expected stage to succeed to be %v", tt.name, tt.succeeded)
+		}
+	}
+}
+
+func TestContainerConfigurationProcess(t *testing.T) {
+	tests := []struct {
+		container  ContainerConfiguration
+		entrypoint []string
+		args       []string
+	}{
+		{
+			ContainerConfiguration{Command: "go test"},
+			[]string{"/bin/sh", "-c"},
+			[]string{"go test"},
+		},
+		{
+			ContainerConfiguration{Command: "go test | tee report", Shell: "bash -eo pipefail"},
+			[]string{"bash", "-eo", "pipefail", "-c"},
+			[]string{"go test | tee report"},
+		},
+		{
+			ContainerConfiguration{Entrypoint: []string{"/app"}, Args: []string{"--check"}},
+			[]string{"/app"},
+			[]string{"--check"},
+		},
+		{
+			ContainerConfiguration{Args: []string{"--check"}},
+			nil,
+			[]string{"--check"},
+		},
+	}
+
+	for _, test := range tests {
+		entrypoint, args := test.container.Process()
+		if !reflect.DeepEqual(entrypoint, test.entrypoint) || !reflect.DeepEqual(args, test.args) {
+			t.Fatalf("expected %v %v but got %v %v", test.entrypoint, test.args, entrypoint, args)
+		}
+	}
+}
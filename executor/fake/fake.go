@@ -0,0 +1,187 @@
+package fake
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxinden/automation/executor"
+)
+
+// Rule scripts the result of every container matching its image and command.
+type Rule struct {
+	// Image needs to equal the image of a container, if given.
+	Image string
+	// Command needs to be contained in the process of a container, its
+	// entrypoint and args joined by spaces, if given.
+	Command string
+
+	ExitCode int32
+	Output   string
+	// Delay is the time the container takes to run.
+	Delay time.Duration
+	// Err fails the execution of the step with the given error, as an
+	// unreachable cluster would.
+	Err error
+}
+
+func (r *Rule) matches(c executor.ContainerConfiguration) bool {
+	if r.Image != "" && r.Image != c.Image {
+		return false
+	}
+	entrypoint, args := c.Process()
+	return strings.Contains(strings.Join(append(entrypoint, args...), " "), r.Command)
+}
+
+// FakeExecutor executes configurations in process by returning scripted
+// results, for testing the code driving an executor without a cluster.
+// Containers not matched by any rule succeed without output.
+type FakeExecutor struct {
+	rules []Rule
+
+	mu             sync.Mutex
+	configurations []executor.ExecutionConfiguration
+	steps          []executor.StepConfiguration
+}
+
+// NewFakeExecutor returns an executor applying the first rule matching a
+// container.
+func NewFakeExecutor(rules ...Rule) *FakeExecutor {
+	return &FakeExecutor{rules: rules}
+}
+
+func (f *FakeExecutor) Execute(c executor.ExecutionConfiguration) (executor.ExecutionResult, error) {
+	f.mu.Lock()
+	f.configurations = append(f.configurations, c)
+	f.mu.Unlock()
+
+	return executor.ExecuteGraph(c, f.executeStep)
+}
+
+// Configurations returns all configurations the executor received so far.
+func (f *FakeExecutor) Configurations() []executor.ExecutionConfiguration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]executor.ExecutionConfiguration{}, f.configurations...)
+}
+
+// Steps returns all steps the executor ran so far, in the order they were
+// started.
+func (f *FakeExecutor) Steps() []executor.StepConfiguration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]executor.StepConfiguration{}, f.steps...)
+}
+
+func (f *FakeExecutor) executeStep(step executor.StepConfiguration) (executor.StepResult, error) {
+	f.mu.Lock()
+	f.steps = append(f.steps, step)
+	f.mu.Unlock()
+
+	stepResult := executor.StepResult{StartTime: time.Now()}
+
+	initContainersSucceeded := true
+	for _, c := range step.InitContainers {
+		if !initContainersSucceeded {
+			stepResult.InitContainers = append(stepResult.InitContainers, didNotRun(c))
+			continue
+		}
+
+		result, _, err := f.runContainer(c)
+		if err != nil {
+			return stepResult, err
+		}
+		stepResult.InitContainers = append(stepResult.InitContainers, result)
+		initContainersSucceeded = result.DidSucceed()
+	}
+
+	for _, c := range step.Containers {
+		if !initContainersSucceeded {
+			stepResult.Containers = append(stepResult.Containers, didNotRun(c))
+			continue
+		}
+
+		result, output, err := f.runContainer(c)
+		if err != nil {
+			return stepResult, err
+		}
+		stepResult.Containers = append(stepResult.Containers, result)
+		stepResult.Output = stepResult.Output + output
+	}
+
+	for _, s := range step.Services {
+		stepResult.Services = append(stepResult.Services, executor.ContainerResult{
+			Name:  s.Name,
+			Image: s.Image,
+			State: executor.ContainerStateRunning,
+		})
+	}
+
+	// Artifacts are collected, if the step succeeded or not.
+	if initContainersSucceeded {
+		for i, p := range step.Artifacts {
+			stepResult.Artifacts = append(stepResult.Artifacts, executor.Artifact{
+				Path: p,
+				Key:  fmt.Sprintf("fake/%v-%v.tar.gz", i, path.Base(p)),
+			})
+		}
+	}
+
+	// There is no cache to restore from, thus caches are saved once the
+	// step succeeded.
+	if initContainersSucceeded {
+		for _, c := range step.Caches {
+			stepResult.Caches = append(stepResult.Caches, executor.CacheResult{
+				Path:  c.Path,
+				Key:   c.Key,
+				Saved: stepResult.DidSucceed(),
+			})
+		}
+	}
+
+	// Report files don't exist, reports in the output are parsed.
+	if len(step.TestReports) != 0 {
+		stepResult.TestSuites, _ = executor.ParseTestReports(step.TestReports, stepResult.Output, map[int]string{})
+	}
+
+	stepResult.CompletionTime = time.Now()
+	return stepResult, nil
+}
+
+func (f *FakeExecutor) runContainer(c executor.ContainerConfiguration) (executor.ContainerResult, string, error) {
+	rule := Rule{}
+	for _, r := range f.rules {
+		if r.matches(c) {
+			rule = r
+			break
+		}
+	}
+
+	start := time.Now()
+	time.Sleep(rule.Delay)
+
+	if rule.Err != nil {
+		return executor.ContainerResult{}, "", rule.Err
+	}
+
+	return executor.ContainerResult{
+		Name:           c.Name,
+		Image:          c.Image,
+		State:          executor.ContainerStateTerminated,
+		ExitCode:       rule.ExitCode,
+		StartTime:      start,
+		CompletionTime: time.Now(),
+	}, rule.Output, nil
+}
+
+func didNotRun(c executor.ContainerConfiguration) executor.ContainerResult {
+	return executor.ContainerResult{
+		Name:  c.Name,
+		Image: c.Image,
+		State: executor.ContainerStateDidNotRun,
+	}
+}
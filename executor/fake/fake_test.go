@@ -0,0 +1,90 @@
+package fake
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mxinden/automation/executor"
+)
+
+func step(name string, containers ...executor.ContainerConfiguration) executor.StepConfiguration {
+	return executor.StepConfiguration{Name: name, Containers: containers}
+}
+
+func TestFakeExecutorScriptedResults(t *testing.T) {
+	f := NewFakeExecutor(
+		Rule{Image: "golang", Command: "go test", ExitCode: 1, Output: "FAIL\n"},
+		Rule{Command: "go build", Output: "ok\n"},
+	)
+
+	c := executor.ExecutionConfiguration{
+		Stages: []executor.StageConfiguration{
+			{Steps: []executor.StepConfiguration{
+				step("build", executor.ContainerConfiguration{Image: "golang", Command: "go build ."}),
+				step("test", executor.ContainerConfiguration{Image: "golang", Command: "go test ./..."}),
+			}},
+			{Steps: []executor.StepConfiguration{
+				step("deploy", executor.ContainerConfiguration{Image: "kubectl", Command: "kubectl apply"}),
+			}},
+		},
+	}
+
+	result, err := f.Execute(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build, test := result.Stages[0].Steps[0], result.Stages[0].Steps[1]
+	if !build.DidSucceed() || build.Output != "ok\n" {
+		t.Fatalf("expected build to succeed with output but got %+v", build)
+	}
+	if test.DidSucceed() || test.Output != "FAIL\n" {
+		t.Fatalf("expected test to fail with output but got %+v", test)
+	}
+
+	if len(result.Stages) != 2 || !result.Stages[1].Steps[0].NotRun {
+		t.Fatalf("expected deploy not to run after failing test but got %+v", result.Stages)
+	}
+
+	if len(f.Configurations()) != 1 || len(f.Steps()) != 2 {
+		t.Fatalf("expected 1 configuration and 2 steps to be recorded but got %v and %v", len(f.Configurations()), len(f.Steps()))
+	}
+}
+
+func TestFakeExecutorFailedInitContainer(t *testing.T) {
+	f := NewFakeExecutor(Rule{Command: "git clone", ExitCode: 128})
+
+	s := step("test", executor.ContainerConfiguration{Image: "golang", Command: "go test"})
+	s.InitContainers = []executor.ContainerConfiguration{{Image: "git", Command: "git clone"}}
+
+	result, err := f.Execute(executor.ExecutionConfiguration{
+		Stages: []executor.StageConfiguration{{Steps: []executor.StepConfiguration{s}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container := result.Stages[0].Steps[0].Containers[0]
+	if container.State != executor.ContainerStateDidNotRun {
+		t.Fatalf("expected container not to run after failed init container but got %v", container.State)
+	}
+}
+
+func TestFakeExecutorErrorAndDelay(t *testing.T) {
+	f := NewFakeExecutor(Rule{Command: "sleep", Delay: 50 * time.Millisecond, Err: errors.New("cluster unreachable")})
+
+	start := time.Now()
+	_, err := f.Execute(executor.ExecutionConfiguration{
+		Stages: []executor.StageConfiguration{{Steps: []executor.StepConfiguration{
+			step("sleep", executor.ContainerConfiguration{Image: "debian", Command: "sleep 1"}),
+		}}},
+	})
+
+	if err == nil {
+		t.Fatal("expected scripted error to be returned")
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("expected scripted delay")
+	}
+}
@@ -0,0 +1,232 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// StepGraph is the dependency graph of all steps of an execution
+// configuration. Steps without explicit dependencies depend on all steps of
+// the previous stage, which keeps the semantics of stage based configurations.
+type StepGraph struct {
+	// Nodes are in configuration order.
+	Nodes []StepNode
+}
+
+type StepNode struct {
+	Name  string
+	Stage int
+	Step  StepConfiguration
+	// DependsOn are the indices of the nodes this node depends on.
+	DependsOn []int
+}
+
+func NewStepGraph(c ExecutionConfiguration) (StepGraph, error) {
+	g := StepGraph{}
+	indices := map[string]int{}
+	stageIndices := [][]int{}
+
+	for stageI, stage := range c.Stages {
+		stageIndices = append(stageIndices, []int{})
+
+		for stepI, step := range stage.Steps {
+			name := step.Name
+			if name == "" {
+				name = defaultStepName(stageI, stepI)
+			}
+
+			if _, ok := indices[name]; ok {
+				return g, fmt.Errorf("duplicate step name %v", name)
+			}
+
+			indices[name] = len(g.Nodes)
+			stageIndices[stageI] = append(stageIndices[stageI], len(g.Nodes))
+			g.Nodes = append(g.Nodes, StepNode{Name: name, Stage: stageI, Step: step})
+		}
+	}
+
+	for i := range g.Nodes {
+		node := &g.Nodes[i]
+
+		if len(node.Step.DependsOn) == 0 {
+			if node.Stage > 0 {
+				node.DependsOn = stageIndices[node.Stage-1]
+			}
+			continue
+		}
+
+		for _, dependency := range node.Step.DependsOn {
+			dependencyI, ok := indices[dependency]
+			if !ok {
+				return g, fmt.Errorf("step %v depends on unknown step %v", node.Name, dependency)
+			}
+			node.DependsOn = append(node.DependsOn, dependencyI)
+		}
+	}
+
+	err := g.checkForCycles()
+	if err != nil {
+		return g, err
+	}
+
+	return g, nil
+}
+
+// defaultStepName names unnamed steps by their position.
+func defaultStepName(stageI, stepI int) string {
+	return fmt.Sprintf("stage-%v-step-%v", stageI, stepI)
+}
+
+func (g *StepGraph) checkForCycles() error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(g.Nodes))
+	path := []string{}
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("dependency cycle between steps %v", strings.Join(append(path, g.Nodes[i].Name), " -> "))
+		case visited:
+			return nil
+		}
+
+		state[i] = visiting
+		path = append(path, g.Nodes[i].Name)
+
+		for _, dependency := range g.Nodes[i].DependsOn {
+			err := visit(dependency)
+			if err != nil {
+				return err
+			}
+		}
+
+		state[i] = visited
+		path = path[:len(path)-1]
+		return nil
+	}
+
+	for i := range g.Nodes {
+		err := visit(i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StepExecutor executes a single step.
+type StepExecutor func(StepConfiguration) (StepResult, error)
+
+// ExecuteGraph runs all steps of the configuration as soon as their
+// dependencies succeeded or were skipped, using the given StepExecutor. Steps
+// whose dependencies failed are not run and marked as such in the result. On
+// error no further steps are started and the errors of all running steps are
+// returned once they finished.
+func ExecuteGraph(c ExecutionConfiguration, executeStep StepExecutor) (ExecutionResult, error) {
+	executionResult := ExecutionResult{}
+
+	g, err := NewStepGraph(c)
+	if err != nil {
+		return executionResult, err
+	}
+
+	type stepDone struct {
+		index  int
+		result StepResult
+		err    error
+	}
+
+	results := make([]*StepResult, len(g.Nodes))
+	started := make([]bool, len(g.Nodes))
+	done := make(chan stepDone, len(g.Nodes))
+	running := 0
+	errs := []string{}
+
+	for {
+		// Skipping a step might unblock further steps, thus repeat until no
+		// more steps can be started.
+		for progress := len(errs) == 0; progress; {
+			progress = false
+
+			for i, node := range g.Nodes {
+				if started[i] || !g.dependenciesSucceeded(node, results) {
+					continue
+				}
+
+				started[i] = true
+
+				// Skipped steps don't block the steps depending on them.
+				if node.Step.Skip {
+					results[i] = &StepResult{Name: node.Step.Name, Skipped: true}
+					progress = true
+					continue
+				}
+
+				running++
+				go func(i int, step StepConfiguration) {
+					result, err := executeStep(step)
+					done <- stepDone{index: i, result: result, err: err}
+				}(i, node.Step)
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		d := <-done
+		running--
+		if d.err != nil {
+			errs = append(errs, d.err.Error())
+			continue
+		}
+		d.result.Name = g.Nodes[d.index].Step.Name
+		results[d.index] = &d.result
+	}
+
+	for i, node := range g.Nodes {
+		if !started[i] {
+			results[i] = &StepResult{Name: node.Step.Name, NotRun: true}
+		}
+	}
+
+	// Results are in configuration order, independent of the order in which
+	// the steps finished.
+	for stageI, stage := range c.Stages {
+		stageResult := StageResult{Name: stage.Name}
+		for i, node := range g.Nodes {
+			if node.Stage == stageI && results[i] != nil {
+				stageResult.Steps = append(stageResult.Steps, *results[i])
+			}
+		}
+
+		// Stages of which all steps failed with an error are left out.
+		if len(stageResult.Steps) != 0 {
+			executionResult.Stages = append(executionResult.Stages, stageResult)
+		}
+	}
+
+	if len(errs) != 0 {
+		return executionResult, errors.New(strings.Join(errs, "\n"))
+	}
+
+	return executionResult, nil
+}
+
+func (g *StepGraph) dependenciesSucceeded(node StepNode, results []*StepResult) bool {
+	for _, dependency := range node.DependsOn {
+		result := results[dependency]
+		if result == nil || !result.DidSucceed() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package executor
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestNewStepGraphStagesToDependencies(t *testing.T) {
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{Steps: []StepConfiguration{{Name: "lint"}, {Name: "test"}}},
+			{Steps: []StepConfiguration{{Name: "build"}}},
+		},
+	}
+
+	g, err := NewStepGraph(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(g.Nodes[0].DependsOn) != 0 || len(g.Nodes[1].DependsOn) != 0 {
+		t.Fatal("expected steps of first stage not to depend on any step")
+	}
+
+	if len(g.Nodes[2].DependsOn) != 2 {
+		t.Fatalf("expected step of second stage to depend on both steps of first stage but got %v", g.Nodes[2].DependsOn)
+	}
+}
+
+func TestNewStepGraphInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []StepConfiguration
+	}{
+		{
+			name:  "unknown dependency",
+			steps: []StepConfiguration{{Name: "build", DependsOn: []string{"test"}}},
+		},
+		{
+			name:  "duplicate name",
+			steps: []StepConfiguration{{Name: "build"}, {Name: "build"}},
+		},
+		{
+			name: "cycle",
+			steps: []StepConfiguration{
+				{Name: "build", DependsOn: []string{"push"}},
+				{Name: "test", DependsOn: []string{"build"}},
+				{Name: "push", DependsOn: []string{"test"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		c := ExecutionConfiguration{Stages: []StageConfiguration{{Steps: tt.steps}}}
+		if _, err := NewStepGraph(c); err == nil {
+			t.Fatalf("%v: expected graph to be invalid", tt.name)
+		}
+	}
+}
+
+func TestExecuteGraphSkipsStepsOfFailedDependencies(t *testing.T) {
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{
+				Steps: []StepConfiguration{
+					{Name: "lint", Containers: []ContainerConfiguration{{Command: "false"}}},
+					{Name: "build", Containers: []ContainerConfiguration{{Command: "true"}}},
+				},
+			},
+			{
+				Steps: []StepConfiguration{
+					{Name: "push", DependsOn: []string{"build"}, Containers: []ContainerConfiguration{{Command: "true"}}},
+					{Name: "deploy", Containers: []ContainerConfiguration{{Command: "true"}}},
+				},
+			},
+		},
+	}
+
+	var mutex sync.Mutex
+	ran := map[string]bool{}
+
+	result, err := ExecuteGraph(c, func(step StepConfiguration) (StepResult, error) {
+		mutex.Lock()
+		ran[step.Name] = true
+		mutex.Unlock()
+
+		exitCode := int32(0)
+		if step.Containers[0].Command == "false" {
+			exitCode = 1
+		}
+
+		return StepResult{
+			Containers: []ContainerResult{{State: ContainerStateTerminated, ExitCode: exitCode}},
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ran["push"] {
+		t.Fatal("expected push to run as it only depends on build")
+	}
+
+	if ran["deploy"] {
+		t.Fatal("expected deploy not to run as it implicitly depends on the failed lint step")
+	}
+
+	if result.DidSucceed() {
+		t.Fatal("expected execution to fail")
+	}
+
+	if len(result.Stages) != 2 || len(result.Stages[1].Steps) != 2 {
+		t.Fatalf("expected second stage to contain the push and deploy step results but got %+v", result.Stages)
+	}
+
+	push, deploy := result.Stages[1].Steps[0], result.Stages[1].Steps[1]
+	if push.Name != "push" || push.NotRun || deploy.Name != "deploy" || !deploy.NotRun {
+		t.Fatalf("expected push to run and deploy to be marked as not run but got %+v and %+v", push, deploy)
+	}
+	if deploy.DidSucceed() {
+		t.Fatal("expected deploy not to succeed as it did not run")
+	}
+}
+
+func TestExecuteGraphResultsInConfigurationOrder(t *testing.T) {
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{
+				Name: "test",
+				Steps: []StepConfiguration{
+					{Name: "slow"},
+					{Name: "fast"},
+				},
+			},
+		},
+	}
+
+	fastDone := make(chan struct{})
+
+	result, err := ExecuteGraph(c, func(step StepConfiguration) (StepResult, error) {
+		if step.Name == "slow" {
+			<-fastDone
+		} else {
+			defer close(fastDone)
+		}
+		return StepResult{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Stages[0].Name != "test" {
+		t.Fatalf("expected stage result to be named test but got %v", result.Stages[0].Name)
+	}
+
+	steps := result.Stages[0].Steps
+	if steps[0].Name != "slow" || steps[1].Name != "fast" {
+		t.Fatalf("expected step results in configuration order but got %v, %v", steps[0].Name, steps[1].Name)
+	}
+}
+
+func TestExecuteGraphSkippedStepsDontBlockDependents(t *testing.T) {
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{Steps: []StepConfiguration{{Name: "deploy", Skip: true}}},
+			{Steps: []StepConfiguration{{Name: "notify"}}},
+		},
+	}
+
+	ran := []string{}
+
+	result, err := ExecuteGraph(c, func(step StepConfiguration) (StepResult, error) {
+		ran = append(ran, step.Name)
+		return StepResult{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ran) != 1 || ran[0] != "notify" {
+		t.Fatalf("expected only notify to run but got %v", ran)
+	}
+
+	if !result.Stages[0].Steps[0].Skipped {
+		t.Fatal("expected deploy to be reported as skipped")
+	}
+}
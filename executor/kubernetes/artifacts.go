@@ -0,0 +1,108 @@
+package kubernetes
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/mxinden/automation/artifacts"
+	"github.com/mxinden/automation/executor"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	artifactsContainerName = "automation-artifacts"
+	// artifactUploadedMarker is logged by the artifacts container for
+	// every uploaded artifact, followed by its index.
+	artifactUploadedMarker = "automation-artifact-uploaded"
+)
+
+var invalidKeyCharacters = regexp.MustCompile("[^A-Za-z0-9._-]+")
+
+// getArtifacts returns the artifacts of the given step, keyed by the name of
+// its job.
+func getArtifacts(jobName string, paths []string) []executor.Artifact {
+	result := []executor.Artifact{}
+	for i, p := range paths {
+		base := invalidKeyCharacters.ReplaceAllString(path.Base(p), "-")
+		result = append(result, executor.Artifact{
+			Path: p,
+			Key:  fmt.Sprintf("%v/%v-%v.tar.gz", jobName, i, base),
+		})
+	}
+	return result
+}
+
+// addArtifactsToPodSpec adds a container collecting the given artifacts once
+// the containers of the step terminated. The artifacts container mounts all
+// volumes of the containers and uploads each artifact as a gzipped tarball to
+// the given store.
+func addArtifactsToPodSpec(spec *v1.PodSpec, containers []executor.ContainerConfiguration, toCollect []executor.Artifact, store artifacts.Store, image string) error {
+	terminationMounts, terminated := signalTermination(spec, containers)
+
+	mounts := append(terminationMounts, volumeMountsOf(spec.Containers[:len(containers)])...)
+
+	storeVolumes, storeMounts := store.Volumes()
+	spec.Volumes = append(spec.Volumes, storeVolumes...)
+	mounts = append(mounts, storeMounts...)
+
+	script := waitForTermination(terminated) + "\n"
+	for i, a := range toCollect {
+		upload, err := store.UploadCommand(a.Key)
+		if err != nil {
+			return err
+		}
+
+		script = script + fmt.Sprintf(
+			"if [ -e %v ] && tar czf - -C %v %v | (%v); then echo %v %v; fi\n",
+			shellQuote(a.Path),
+			shellQuote(path.Dir(a.Path)),
+			shellQuote(path.Base(a.Path)),
+			upload,
+			artifactUploadedMarker,
+			i,
+		)
+	}
+
+	spec.Containers = append(spec.Containers, v1.Container{
+		Name:         artifactsContainerName,
+		Image:        image,
+		Command:      []string{"/bin/sh", "-c"},
+		Args:         []string{script},
+		VolumeMounts: mounts,
+	})
+
+	return nil
+}
+
+// getUploadedArtifacts returns the artifacts the artifacts container reported
+// as uploaded in its logs.
+func getUploadedArtifacts(logs string, toCollect []executor.Artifact) []executor.Artifact {
+	uploaded := []executor.Artifact{}
+	for _, i := range getMarkedIndices(logs, artifactUploadedMarker, len(toCollect)) {
+		uploaded = append(uploaded, toCollect[i])
+	}
+	return uploaded
+}
+
+// splitContainer separates the container with the given name from the given
+// containers.
+func splitContainer(containers []v1.Container, name string) ([]v1.Container, bool) {
+	rest := []v1.Container{}
+	found := false
+
+	for _, c := range containers {
+		if c.Name == name {
+			found = true
+			continue
+		}
+		rest = append(rest, c)
+	}
+
+	return rest, found
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,83 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mxinden/automation/artifacts"
+	"github.com/mxinden/automation/configuration"
+	"github.com/mxinden/automation/executor"
+)
+
+func TestAddArtifactsToPodSpec(t *testing.T) {
+	t.Parallel()
+
+	step := executor.StepConfiguration{
+		Containers: []executor.ContainerConfiguration{
+			{
+				Command:      "go build -o bin/automation",
+				Image:        "golang",
+				VolumeMounts: []executor.VolumeMount{{Name: "repository", MountPath: "/src"}},
+			},
+		},
+		Artifacts: []string{"/src/bin/automation", "/src/it's here"},
+	}
+
+	job := stepConfigToK8sJob(step)
+	toCollect := getArtifacts("build-abc", step.Artifacts)
+	store := artifacts.NewPVCStore(configuration.PVCStorage{ClaimName: "artifacts"})
+
+	err := addArtifactsToPodSpec(&job.Spec.Template.Spec, step.Containers, toCollect, store, "curlimages/curl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if toCollect[0].Key != "build-abc/0-automation.tar.gz" || toCollect[1].Key != "build-abc/1-it-s-here.tar.gz" {
+		t.Fatalf("expected keys to be derived from job name and path but got %v", toCollect)
+	}
+
+	spec := job.Spec.Template.Spec
+	if len(spec.Containers) != 2 || spec.Containers[1].Name != artifactsContainerName {
+		t.Fatalf("expected artifacts container to be added but got %v", spec.Containers)
+	}
+
+	main := spec.Containers[0]
+	if !strings.HasPrefix(main.Args[0], "trap 'echo $? > /automation-termination/container-0' EXIT; ") {
+		t.Fatalf("expected container to signal its termination but got %v", main.Args[0])
+	}
+
+	collector := spec.Containers[1]
+	mountPaths := []string{}
+	for _, m := range collector.VolumeMounts {
+		mountPaths = append(mountPaths, m.MountPath)
+	}
+	for _, expected := range []string{"/src", terminationMountPath, exitCodesMountPath, "/automation-artifact-store"} {
+		if !containsString(mountPaths, expected) {
+			t.Fatalf("expected artifacts container to mount %v but got %v", expected, mountPaths)
+		}
+	}
+
+	script := collector.Args[0]
+	for _, expected := range []string{
+		"until { [ -f /automation-termination/container-0 ] || [ -s /automation-exit-codes/container-0 ]; }; do sleep 1; done",
+		"tar czf - -C '/src/bin' 'automation' | (mkdir -p '/automation-artifact-store/build-abc' && cat > '/automation-artifact-store/build-abc/0-automation.tar.gz')",
+		`-C '/src' 'it'\''s here'`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Fatalf("expected script to contain %v but got %v", expected, script)
+		}
+	}
+}
+
+func TestGetUploadedArtifacts(t *testing.T) {
+	t.Parallel()
+
+	toCollect := getArtifacts("job", []string{"/src/a", "/src/b", "/src/c"})
+	logs := "automation-artifact-uploaded 0\ncurl: (22) The requested URL returned error: 403\nautomation-artifact-uploaded 2\nautomation-artifact-uploaded 7\n"
+
+	uploaded := getUploadedArtifacts(logs, toCollect)
+
+	if len(uploaded) != 2 || uploaded[0].Path != "/src/a" || uploaded[1].Path != "/src/c" {
+		t.Fatalf("expected artifacts a and c to be uploaded but got %v", uploaded)
+	}
+}
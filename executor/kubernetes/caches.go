@@ -0,0 +1,148 @@
+package kubernetes
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mxinden/automation/artifacts"
+	"github.com/mxinden/automation/cache"
+	"github.com/mxinden/automation/executor"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	cacheRestoreContainerName = "automation-cache-restore"
+	cacheSaveContainerName    = "automation-cache-save"
+	cacheHitsVolume           = "automation-cache-hits"
+	cacheHitsMountPath        = "/automation-cache-hits"
+	// cacheRestoredMarker and cacheSavedMarker are logged for every
+	// restored and saved cache, followed by its index.
+	cacheRestoredMarker = "automation-cache-restored"
+	cacheSavedMarker    = "automation-cache-saved"
+)
+
+// addCachesToPodSpec restores the given caches in an init container running
+// after the init containers of the step, right before its containers start.
+// Caches which were missed are saved by a sidecar once all containers of the
+// step succeeded. Caches which were hit are never saved again, as their key
+// identifies their content.
+func addCachesToPodSpec(spec *v1.PodSpec, containers []executor.ContainerConfiguration, caches []executor.CacheConfiguration, store cache.Store, image string) error {
+	for _, c := range caches {
+		if !artifacts.ValidKey(c.Key) {
+			return fmt.Errorf("invalid key %q of cache %v, keys need to be resolved first", c.Key, c.Path)
+		}
+	}
+
+	terminationMounts, terminated := signalTermination(spec, containers)
+
+	spec.Volumes = append(spec.Volumes, v1.Volume{
+		Name:         cacheHitsVolume,
+		VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+	})
+	hitsMount := v1.VolumeMount{Name: cacheHitsVolume, MountPath: cacheHitsMountPath}
+
+	storeVolumes, storeMounts := store.Volumes()
+	spec.Volumes = append(spec.Volumes, storeVolumes...)
+
+	stepContainers := spec.Containers[:len(containers)]
+
+	restore := ""
+	save := waitForTermination(terminated) + "\n"
+	save = save + fmt.Sprintf("if %v; then\n", terminatedSuccessfully(terminated))
+
+	for i, c := range caches {
+		download, err := store.DownloadCommand(c.Key)
+		if err != nil {
+			return err
+		}
+		upload, err := store.UploadCommand(c.Key)
+		if err != nil {
+			return err
+		}
+		hitFile := path.Join(cacheHitsMountPath, strconv.Itoa(i))
+
+		restore = restore + fmt.Sprintf(
+			"if mkdir -p %v && (%v) | tar xzf - -C %v; then touch %v; echo %v %v; fi\n",
+			shellQuote(c.Path),
+			download,
+			shellQuote(c.Path),
+			hitFile,
+			cacheRestoredMarker,
+			i,
+		)
+
+		save = save + fmt.Sprintf(
+			"  if [ ! -f %v ] && tar czf - -C %v . | (%v); then echo %v %v; fi\n",
+			hitFile,
+			shellQuote(c.Path),
+			upload,
+			cacheSavedMarker,
+			i,
+		)
+	}
+
+	save = save + "fi\n"
+
+	allContainers := append(append([]v1.Container{}, spec.InitContainers...), stepContainers...)
+	restoreMounts := append([]v1.VolumeMount{hitsMount}, volumeMountsOf(allContainers)...)
+	spec.InitContainers = append(spec.InitContainers, v1.Container{
+		Name:         cacheRestoreContainerName,
+		Image:        image,
+		Command:      []string{"/bin/sh", "-c"},
+		Args:         []string{restore},
+		VolumeMounts: append(restoreMounts, storeMounts...),
+	})
+
+	saveMounts := append(terminationMounts, hitsMount)
+	saveMounts = append(saveMounts, volumeMountsOf(stepContainers)...)
+	spec.Containers = append(spec.Containers, v1.Container{
+		Name:         cacheSaveContainerName,
+		Image:        image,
+		Command:      []string{"/bin/sh", "-c"},
+		Args:         []string{save},
+		VolumeMounts: append(saveMounts, storeMounts...),
+	})
+
+	return nil
+}
+
+// getCacheResults returns whether each of the given caches was restored and
+// saved according to the logs of the restore and the save container.
+func getCacheResults(caches []executor.CacheConfiguration, restoreLogs, saveLogs string) []executor.CacheResult {
+	results := []executor.CacheResult{}
+	for _, c := range caches {
+		results = append(results, executor.CacheResult{Path: c.Path, Key: c.Key})
+	}
+
+	for _, i := range getMarkedIndices(restoreLogs, cacheRestoredMarker, len(caches)) {
+		results[i].Restored = true
+	}
+	for _, i := range getMarkedIndices(saveLogs, cacheSavedMarker, len(caches)) {
+		results[i].Saved = true
+	}
+
+	return results
+}
+
+// getMarkedIndices returns the indices logged after the given marker, which are
+// below n.
+func getMarkedIndices(logs string, marker string, n int) []int {
+	indices := []int{}
+
+	for _, line := range strings.Split(logs, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != marker {
+			continue
+		}
+
+		i, err := strconv.Atoi(fields[1])
+		if err != nil || i < 0 || i >= n {
+			continue
+		}
+		indices = append(indices, i)
+	}
+
+	return indices
+}
@@ -0,0 +1,113 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mxinden/automation/artifacts"
+	"github.com/mxinden/automation/configuration"
+	"github.com/mxinden/automation/executor"
+)
+
+func TestAddCachesToPodSpec(t *testing.T) {
+	t.Parallel()
+
+	step := executor.StepConfiguration{
+		InitContainers: []executor.ContainerConfiguration{
+			{
+				Command:      "git clone $(GIT_REPOSITORY_URL) /src",
+				Image:        "governmentpaas/git-ssh",
+				VolumeMounts: []executor.VolumeMount{{Name: "repository", MountPath: "/src"}},
+			},
+		},
+		Containers: []executor.ContainerConfiguration{
+			{
+				Command:      "dep ensure && go build",
+				Image:        "golang",
+				VolumeMounts: []executor.VolumeMount{{Name: "repository", MountPath: "/src"}},
+			},
+		},
+		Artifacts: []string{"/src/automation"},
+		Caches:    []executor.CacheConfiguration{{Path: "/src/vendor", Key: "repo/dep-1234"}},
+	}
+
+	job := stepConfigToK8sJob(step)
+	spec := &job.Spec.Template.Spec
+	store := artifacts.NewNamedPVCStore(configuration.PVCStorage{ClaimName: "caches"}, "automation-cache-store")
+
+	err := addArtifactsToPodSpec(spec, step.Containers, getArtifacts("build", step.Artifacts), artifacts.NewPVCStore(configuration.PVCStorage{}), "curlimages/curl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = addCachesToPodSpec(spec, step.Containers, step.Caches, store, "curlimages/curl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(spec.InitContainers) != 2 || spec.InitContainers[1].Name != cacheRestoreContainerName {
+		t.Fatalf("expected caches to be restored after the init containers of the step but got %v", spec.InitContainers)
+	}
+
+	if len(spec.Containers) != 3 || spec.Containers[2].Name != cacheSaveContainerName {
+		t.Fatalf("expected cache save container to be added but got %v", spec.Containers)
+	}
+
+	main := spec.Containers[0].Args[0]
+	if strings.Count(main, "trap ") != 1 {
+		t.Fatalf("expected container to signal its termination once but got %v", main)
+	}
+
+	restore := spec.InitContainers[1].Args[0]
+	expected := "if mkdir -p '/src/vendor' && (cat '/automation-cache-store/repo/dep-1234') | tar xzf - -C '/src/vendor'; then touch /automation-cache-hits/0; echo automation-cache-restored 0; fi"
+	if !strings.Contains(restore, expected) {
+		t.Fatalf("expected restore script to contain %v but got %v", expected, restore)
+	}
+
+	save := spec.Containers[2].Args[0]
+	for _, expected := range []string{
+		"until { [ -f /automation-termination/container-0 ] || [ -s /automation-exit-codes/container-0 ]; }; do sleep 1; done",
+		`if [ "$(cat /automation-termination/container-0 2>/dev/null || cat /automation-exit-codes/container-0)" = 0 ]; then`,
+		"if [ ! -f /automation-cache-hits/0 ] && tar czf - -C '/src/vendor' . | (mkdir -p '/automation-cache-store/repo' && cat > '/automation-cache-store/repo/dep-1234'); then echo automation-cache-saved 0; fi",
+	} {
+		if !strings.Contains(save, expected) {
+			t.Fatalf("expected save script to contain %v but got %v", expected, save)
+		}
+	}
+
+	volumes := map[string]bool{}
+	for _, v := range spec.Volumes {
+		if volumes[v.Name] {
+			t.Fatalf("expected volume names to be unique but got %v twice", v.Name)
+		}
+		volumes[v.Name] = true
+	}
+}
+
+func TestAddCachesToPodSpecUnresolvedKey(t *testing.T) {
+	t.Parallel()
+
+	step := executor.StepConfiguration{
+		Containers: []executor.ContainerConfiguration{{Command: "go build", Image: "golang"}},
+		Caches:     []executor.CacheConfiguration{{Path: "/src/vendor", Key: `dep-{{ checksum "Gopkg.lock" }}`}},
+	}
+
+	job := stepConfigToK8sJob(step)
+	store := artifacts.NewNamedPVCStore(configuration.PVCStorage{ClaimName: "caches"}, "automation-cache-store")
+
+	err := addCachesToPodSpec(&job.Spec.Template.Spec, step.Containers, step.Caches, store, "curlimages/curl")
+	if err == nil {
+		t.Fatal("expected unresolved key to be rejected")
+	}
+}
+
+func TestGetCacheResults(t *testing.T) {
+	t.Parallel()
+
+	caches := []executor.CacheConfiguration{{Path: "/a", Key: "a"}, {Path: "/b", Key: "b"}}
+
+	results := getCacheResults(caches, "automation-cache-restored 0\ntar: invalid magic\n", "automation-cache-saved 1\n")
+
+	if !results[0].Restored || results[0].Saved || results[1].Restored || !results[1].Saved {
+		t.Fatalf("expected a to be restored and b to be saved but got %+v", results)
+	}
+}
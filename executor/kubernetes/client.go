@@ -0,0 +1,89 @@
+package kubernetes
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/mxinden/automation/metrics"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ClientOptions configure how the executor connects to Kubernetes. Without
+// InCluster, Kubeconfig and Context, the in-cluster configuration is used when
+// running in a cluster and the kubeconfig otherwise.
+type ClientOptions struct {
+	// InCluster uses the service account of the pod the executor runs in.
+	InCluster bool
+	// Kubeconfig is the path of a kubeconfig file. Defaults to $KUBECONFIG
+	// or ~/.kube/config, just like kubectl.
+	Kubeconfig string
+	// Context is the context of the kubeconfig to use. Defaults to its
+	// current context.
+	Context string
+	// QPS and Burst limit the requests to the API server. Default to the
+	// limits of client-go.
+	QPS   float32
+	Burst int
+}
+
+// NewClient returns a client configured by the given options.
+func NewClient(o ClientOptions) (kubernetes.Interface, error) {
+	config, err := restConfig(o)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.QPS != 0 {
+		config.QPS = o.QPS
+	}
+	if o.Burst != 0 {
+		config.Burst = o.Burst
+	}
+
+	wrapTransport := config.WrapTransport
+	config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		if wrapTransport != nil {
+			rt = wrapTransport(rt)
+		}
+		return metrics.KubernetesTransport(rt)
+	}
+
+	return kubernetes.NewForConfig(config)
+}
+
+func restConfig(o ClientOptions) (*rest.Config, error) {
+	if o.InCluster {
+		if o.Kubeconfig != "" || o.Context != "" {
+			return nil, errors.New("the in-cluster configuration can't be combined with a kubeconfig or context")
+		}
+
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load in-cluster configuration")
+		}
+		return config, nil
+	}
+
+	if o.Kubeconfig == "" && o.Context == "" {
+		config, err := rest.InClusterConfig()
+		if err == nil {
+			return config, nil
+		}
+		log.Printf("not using in-cluster configuration, falling back to kubeconfig: %v", err)
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.Kubeconfig
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules,
+		&clientcmd.ConfigOverrides{CurrentContext: o.Context},
+	).ClientConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load kubeconfig")
+	}
+	return config, nil
+}
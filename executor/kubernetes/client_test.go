@@ -0,0 +1,76 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: staging
+  cluster:
+    server: https://staging.example.com
+- name: production
+  cluster:
+    server: https://production.example.com
+contexts:
+- name: staging
+  context:
+    cluster: staging
+- name: production
+  context:
+    cluster: production
+current-context: staging
+`
+
+func TestNewClient(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config")
+	err = ioutil.WriteFile(path, []byte(testKubeconfig), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		options ClientOptions
+		host    string
+	}{
+		{ClientOptions{Kubeconfig: path}, "https://staging.example.com"},
+		{ClientOptions{Kubeconfig: path, Context: "production", QPS: 50, Burst: 100}, "https://production.example.com"},
+	}
+
+	for _, test := range tests {
+		config, err := restConfig(test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Host != test.host {
+			t.Fatalf("expected host %v for %+v but got %v", test.host, test.options, config.Host)
+		}
+
+		_, err = NewClient(test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = NewClient(ClientOptions{Kubeconfig: path, Context: "unknown"})
+	if err == nil {
+		t.Fatal("expected unknown context to fail")
+	}
+
+	_, err = NewClient(ClientOptions{InCluster: true, Kubeconfig: path})
+	if err == nil {
+		t.Fatal("expected in-cluster configuration combined with kubeconfig to fail")
+	}
+}
@@ -0,0 +1,167 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mxinden/automation/executor"
+	"github.com/mxinden/automation/metrics"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultClusterName is the name of the only cluster of executors created for
+// a single cluster.
+const defaultClusterName = "default"
+
+// Cluster is a Kubernetes cluster steps can run in.
+type Cluster struct {
+	// Name identifies the cluster in the cluster field of steps.
+	Name string
+	// Labels are matched against the clusterSelector of steps.
+	Labels    map[string]string
+	Namespace string
+	Client    kubernetes.Interface
+	// MaxConcurrentJobs limits the jobs running in the cluster at once.
+	// Further steps wait for a running job to finish. Zero means no limit.
+	MaxConcurrentJobs int
+}
+
+// matches returns whether the cluster is the one the given step asks for.
+// Steps not asking for a cluster match the default cluster only.
+func (c Cluster) matches(step executor.StepConfiguration, isDefault bool) bool {
+	if step.Cluster != "" {
+		return step.Cluster == c.Name
+	}
+
+	if len(step.ClusterSelector) == 0 {
+		return isDefault
+	}
+
+	for label, value := range step.ClusterSelector {
+		if c.Labels[label] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// dispatcher assigns steps to clusters, respecting the concurrency limits of
+// the clusters. It is shared by all copies of an executor.
+type dispatcher struct {
+	clusters []Cluster
+	mutex    sync.Mutex
+	// released is signaled whenever a job finished, so steps waiting for
+	// a cluster can retry.
+	released *sync.Cond
+	running  map[string]int
+}
+
+// newDispatcher returns a dispatcher for the given clusters, the first of
+// which is the default cluster.
+func newDispatcher(clusters []Cluster) *dispatcher {
+	d := &dispatcher{
+		clusters: clusters,
+		running:  map[string]int{},
+	}
+	d.released = sync.NewCond(&d.mutex)
+	return d
+}
+
+// candidates returns the clusters the given step can run in.
+func (d *dispatcher) candidates(step executor.StepConfiguration) ([]Cluster, error) {
+	candidates := []Cluster{}
+	for i, c := range d.clusters {
+		if c.matches(step, i == 0) {
+			candidates = append(candidates, c)
+		}
+	}
+
+	if len(candidates) == 0 {
+		if step.Cluster != "" {
+			return candidates, fmt.Errorf("step %v: unknown cluster %q", step.Name, step.Cluster)
+		}
+		return candidates, fmt.Errorf("step %v: no cluster matches the cluster selector %v", step.Name, step.ClusterSelector)
+	}
+
+	return candidates, nil
+}
+
+// clustersOf returns the clusters the steps of the given configuration which
+// are not skipped can run in, or an error if a step can't run in any.
+func (d *dispatcher) clustersOf(c executor.ExecutionConfiguration) ([]Cluster, error) {
+	clusters := []Cluster{}
+	seen := map[string]bool{}
+
+	for _, stage := range c.Stages {
+		for _, step := range stage.Steps {
+			if step.Skip {
+				continue
+			}
+
+			candidates, err := d.candidates(step)
+			if err != nil {
+				return clusters, err
+			}
+
+			for _, candidate := range candidates {
+				if !seen[candidate.Name] {
+					seen[candidate.Name] = true
+					clusters = append(clusters, candidate)
+				}
+			}
+		}
+	}
+
+	return clusters, nil
+}
+
+// acquire waits until one of the clusters the given step can run in has
+// capacity for another job and returns it. Clusters are tried in the order
+// they are configured in. Each acquired cluster needs to be released.
+func (d *dispatcher) acquire(step executor.StepConfiguration) (Cluster, error) {
+	candidates, err := d.candidates(step)
+	if err != nil {
+		return Cluster{}, err
+	}
+
+	start := time.Now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for {
+		for _, c := range candidates {
+			if c.MaxConcurrentJobs == 0 || d.running[c.Name] < c.MaxConcurrentJobs {
+				d.running[c.Name]++
+				metrics.StepQueueWait.WithLabelValues(c.Name).Observe(time.Since(start).Seconds())
+				return c, nil
+			}
+		}
+		d.released.Wait()
+	}
+}
+
+// release frees the capacity of the given cluster taken by acquire.
+func (d *dispatcher) release(c Cluster) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.running[c.Name]--
+	d.released.Broadcast()
+}
+
+// CheckClusters returns an error unless the jobs of the namespace of each
+// cluster can be listed, which needs both a reachable API server and valid
+// credentials.
+func (k *KubernetesExecutor) CheckClusters() error {
+	for _, c := range k.dispatcher.clusters {
+		_, err := c.Client.BatchV1().Jobs(c.Namespace).List(metav1.ListOptions{Limit: 1})
+		if err != nil {
+			return errors.Wrapf(err, "cluster %v", c.Name)
+		}
+	}
+	return nil
+}
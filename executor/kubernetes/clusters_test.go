@@ -0,0 +1,123 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mxinden/automation/executor"
+)
+
+func TestDispatcherCandidates(t *testing.T) {
+	t.Parallel()
+
+	d := newDispatcher([]Cluster{
+		{Name: "general", Labels: map[string]string{"arch": "amd64"}},
+		{Name: "arm", Labels: map[string]string{"arch": "arm64"}},
+		{Name: "arm-large", Labels: map[string]string{"arch": "arm64", "size": "large"}},
+	})
+
+	tests := []struct {
+		step     executor.StepConfiguration
+		expected []string
+	}{
+		{executor.StepConfiguration{}, []string{"general"}},
+		{executor.StepConfiguration{Cluster: "arm-large"}, []string{"arm-large"}},
+		{executor.StepConfiguration{ClusterSelector: map[string]string{"arch": "arm64"}}, []string{"arm", "arm-large"}},
+		{executor.StepConfiguration{ClusterSelector: map[string]string{"arch": "arm64", "size": "large"}}, []string{"arm-large"}},
+	}
+
+	for _, test := range tests {
+		candidates, err := d.candidates(test.step)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := []string{}
+		for _, c := range candidates {
+			names = append(names, c.Name)
+		}
+		if len(names) != len(test.expected) {
+			t.Fatalf("expected clusters %v for %+v but got %v", test.expected, test.step, names)
+		}
+		for i := range names {
+			if names[i] != test.expected[i] {
+				t.Fatalf("expected clusters %v for %+v but got %v", test.expected, test.step, names)
+			}
+		}
+	}
+
+	for _, step := range []executor.StepConfiguration{
+		{Cluster: "gpu"},
+		{ClusterSelector: map[string]string{"arch": "riscv"}},
+	} {
+		_, err := d.candidates(step)
+		if err == nil {
+			t.Fatalf("expected no cluster to match %+v", step)
+		}
+	}
+}
+
+func TestDispatcherClustersOfSkipsSkippedSteps(t *testing.T) {
+	t.Parallel()
+
+	d := newDispatcher([]Cluster{{Name: "general"}})
+
+	c := executor.ExecutionConfiguration{
+		Stages: []executor.StageConfiguration{
+			{Steps: []executor.StepConfiguration{{}, {Skip: true, Cluster: "gpu"}}},
+		},
+	}
+
+	clusters, err := d.clustersOf(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 1 || clusters[0].Name != "general" {
+		t.Fatalf("expected only the general cluster but got %v", clusters)
+	}
+}
+
+func TestDispatcherMaxConcurrentJobs(t *testing.T) {
+	t.Parallel()
+
+	d := newDispatcher([]Cluster{
+		{Name: "arm", Labels: map[string]string{"arch": "arm64"}, MaxConcurrentJobs: 1},
+		{Name: "arm-spare", Labels: map[string]string{"arch": "arm64"}, MaxConcurrentJobs: 1},
+	})
+	step := executor.StepConfiguration{ClusterSelector: map[string]string{"arch": "arm64"}}
+
+	first, err := d.acquire(step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := d.acquire(step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Name != "arm" || second.Name != "arm-spare" {
+		t.Fatalf("expected steps to spread over both clusters but got %v and %v", first.Name, second.Name)
+	}
+
+	acquired := make(chan Cluster)
+	go func() {
+		c, _ := d.acquire(step)
+		acquired <- c
+	}()
+
+	select {
+	case c := <-acquired:
+		t.Fatalf("expected third step to wait but it got cluster %v", c.Name)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	d.release(second)
+
+	select {
+	case c := <-acquired:
+		if c.Name != "arm-spare" {
+			t.Fatalf("expected third step to get the released cluster but got %v", c.Name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected third step to get a cluster once a job finished")
+	}
+}
@@ -0,0 +1,287 @@
+package kubernetes
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mxinden/automation/executor"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	executionNamespacePrefix = "automation-"
+	// executionNamespaceLabel marks the namespaces created for executions.
+	// Namespaces left behind by a crashed server are not cleaned up
+	// automatically, but can be found by it.
+	executionNamespaceLabel = "automation/execution"
+	isolationObjectName     = "automation"
+)
+
+// Isolation configures running each execution in a namespace of its own,
+// which is deleted once the execution finished. Pods of an execution can't be
+// reached by pods of other namespaces. Network policies can't deny egress by
+// namespace though, thus pods of an execution can reach pods of other
+// namespaces unless BlockedCIDRs covers the pod and service networks of the
+// cluster.
+type Isolation struct {
+	// Quota is the hard limit of the resource quota of each namespace,
+	// e.g. on "requests.cpu" or "pods".
+	Quota v1.ResourceList
+	// Defaults are the requests and limits of the containers not
+	// specifying them, e.g. the sidecars of steps. A quota on compute
+	// resources rejects such containers otherwise.
+	Defaults v1.ResourceRequirements
+	// BlockedCIDRs are the IP ranges pods can't connect to, e.g. the pod
+	// and service networks of the cluster or a cloud metadata endpoint. DNS
+	// and pods of the same namespace are always allowed.
+	BlockedCIDRs []string
+}
+
+// SetIsolation runs each execution in a namespace of its own. Only the
+// secrets referenced by the configuration of an execution are copied into its
+// namespace. The configuration passed the policy of its repository before,
+// thus these are the secrets the repository is allowed to use.
+func (k *KubernetesExecutor) SetIsolation(i *Isolation) {
+	k.isolation = i
+}
+
+func (k *KubernetesExecutor) executeIsolated(c executor.ExecutionConfiguration) (executor.ExecutionResult, error) {
+	result := executor.ExecutionResult{}
+
+	for _, stage := range c.Stages {
+		for _, step := range stage.Steps {
+			if !step.Skip && step.ServiceAccountName != "" {
+				return result, fmt.Errorf(
+					"step %v: service accounts are not available in per-execution namespaces",
+					step.Name,
+				)
+			}
+		}
+	}
+
+	clusters, err := k.dispatcher.clustersOf(c)
+	if err != nil {
+		return result, err
+	}
+
+	secretNames := getReferencedSecretNames(c)
+
+	execution := *k
+	execution.jobNamespaces = map[string]string{}
+	for _, cluster := range clusters {
+		namespace, err := createExecutionNamespace(cluster, *k.isolation, secretNames)
+		if namespace != "" {
+			defer deleteExecutionNamespace(cluster, namespace)
+		}
+		if err != nil {
+			return result, errors.Wrapf(err, "cluster %v", cluster.Name)
+		}
+		execution.jobNamespaces[cluster.Name] = namespace
+	}
+
+	return executor.ExecuteGraph(c, execution.executeStep)
+}
+
+// createExecutionNamespace creates a namespace for an execution in the given
+// cluster and copies the given secrets into it. It returns the name of the
+// namespace as soon as it was created, even on subsequent errors, so it can be
+// deleted.
+func createExecutionNamespace(cluster Cluster, isolation Isolation, secretNames []string) (string, error) {
+	namespace, err := cluster.Client.CoreV1().Namespaces().Create(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   executionNamespacePrefix + getRandomName(),
+			Labels: map[string]string{executionNamespaceLabel: "true"},
+		},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create execution namespace")
+	}
+
+	err = setUpExecutionNamespace(cluster.Client, namespace.Name, isolation)
+	if err != nil {
+		return namespace.Name, errors.Wrapf(err, "failed to set up execution namespace %v", namespace.Name)
+	}
+
+	err = copySecrets(cluster.Client, cluster.Namespace, namespace.Name, secretNames)
+	if err != nil {
+		return namespace.Name, errors.Wrapf(err, "failed to copy secrets into execution namespace %v", namespace.Name)
+	}
+
+	// Pods are rejected until the service account controller created the
+	// default service account of the namespace.
+	err = wait.Poll(time.Second, time.Minute, func() (bool, error) {
+		_, err := cluster.Client.CoreV1().ServiceAccounts(namespace.Name).Get("default", metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return namespace.Name, errors.Wrapf(err, "failed to wait for default service account of namespace %v", namespace.Name)
+	}
+
+	return namespace.Name, nil
+}
+
+func deleteExecutionNamespace(cluster Cluster, namespace string) {
+	propagation := metav1.DeletePropagationBackground
+	err := cluster.Client.CoreV1().Namespaces().Delete(namespace, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil {
+		log.Printf("failed to delete execution namespace %v of cluster %v: %v", namespace, cluster.Name, err)
+	}
+}
+
+// setUpExecutionNamespace restricts the given namespace by a network policy, a
+// resource quota and, if resources are limited, default resources.
+func setUpExecutionNamespace(kubeClient kubernetes.Interface, namespace string, isolation Isolation) error {
+	_, err := kubeClient.NetworkingV1().NetworkPolicies(namespace).Create(getNetworkPolicy(isolation.BlockedCIDRs))
+	if err != nil {
+		return errors.Wrap(err, "failed to create network policy")
+	}
+
+	if len(isolation.Quota) != 0 {
+		_, err = kubeClient.CoreV1().ResourceQuotas(namespace).Create(&v1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: isolationObjectName},
+			Spec:       v1.ResourceQuotaSpec{Hard: isolation.Quota},
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to create resource quota")
+		}
+	}
+
+	if len(isolation.Defaults.Requests) != 0 || len(isolation.Defaults.Limits) != 0 {
+		_, err = kubeClient.CoreV1().LimitRanges(namespace).Create(&v1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{Name: isolationObjectName},
+			Spec: v1.LimitRangeSpec{
+				Limits: []v1.LimitRangeItem{
+					{
+						Type:           v1.LimitTypeContainer,
+						DefaultRequest: isolation.Defaults.Requests,
+						Default:        isolation.Defaults.Limits,
+					},
+				},
+			},
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to create limit range")
+		}
+	}
+
+	return nil
+}
+
+// getNetworkPolicy returns a policy allowing ingress only from within the
+// namespace, and egress to anywhere but the given blocked IP ranges.
+func getNetworkPolicy(blockedCIDRs []string) *networkingv1.NetworkPolicy {
+	udp := v1.ProtocolUDP
+	tcp := v1.ProtocolTCP
+	dns := intstr.FromInt(53)
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: isolationObjectName},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}},
+			},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{
+					To: []networkingv1.NetworkPolicyPeer{
+						{IPBlock: &networkingv1.IPBlock{CIDR: "0.0.0.0/0", Except: blockedCIDRs}},
+					},
+				},
+				{
+					Ports: []networkingv1.NetworkPolicyPort{
+						{Protocol: &udp, Port: &dns},
+						{Protocol: &tcp, Port: &dns},
+					},
+				},
+				{To: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}},
+			},
+		},
+	}
+}
+
+// getReferencedSecretNames returns the names of the secrets referenced by
+// environment variables and volumes of the steps of the given configuration
+// which are not skipped.
+func getReferencedSecretNames(c executor.ExecutionConfiguration) []string {
+	names := []string{}
+	add := func(name string) {
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	for _, stage := range c.Stages {
+		for _, step := range stage.Steps {
+			if step.Skip {
+				continue
+			}
+
+			for _, volume := range step.Volumes {
+				if volume.Secret != nil {
+					add(volume.Secret.SecretName)
+				}
+				if volume.Projected != nil {
+					for _, source := range volume.Projected.Sources {
+						if source.Secret != nil {
+							add(source.Secret.Name)
+						}
+					}
+				}
+			}
+
+			containers := append([]executor.ContainerConfiguration{}, step.InitContainers...)
+			containers = append(containers, step.Containers...)
+			for _, s := range step.Services {
+				containers = append(containers, s.ContainerConfiguration)
+			}
+
+			for _, container := range containers {
+				for _, env := range container.Env {
+					if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+						add(env.ValueFrom.SecretKeyRef.Name)
+					}
+				}
+			}
+		}
+	}
+
+	return names
+}
+
+// copySecrets copies the given secrets from one namespace into another.
+// Secrets which don't exist are skipped, the pods referencing them fail just
+// like they would in the original namespace.
+func copySecrets(kubeClient kubernetes.Interface, from, to string, names []string) error {
+	for _, name := range names {
+		secret, err := kubeClient.CoreV1().Secrets(from).Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to get secret %v", name)
+		}
+
+		_, err = kubeClient.CoreV1().Secrets(to).Create(&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: secret.Name, Labels: secret.Labels},
+			Type:       secret.Type,
+			Data:       secret.Data,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to create secret %v", name)
+		}
+	}
+
+	return nil
+}
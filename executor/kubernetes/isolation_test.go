@@ -0,0 +1,147 @@
+package kubernetes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mxinden/automation/executor"
+	"github.com/mxinden/automation/executor/kubernetes/kubetest"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetReferencedSecretNames(t *testing.T) {
+	t.Parallel()
+
+	fromSecret := func(name string) *v1.EnvVarSource {
+		return &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: name}, Key: "key"}}
+	}
+
+	c := executor.ExecutionConfiguration{
+		Stages: []executor.StageConfiguration{
+			{
+				Steps: []executor.StepConfiguration{
+					{
+						Volumes: []v1.Volume{
+							{Name: "ssh", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "ssh"}}},
+							{Name: "projected", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{
+								Sources: []v1.VolumeProjection{{Secret: &v1.SecretProjection{LocalObjectReference: v1.LocalObjectReference{Name: "tls"}}}},
+							}}},
+						},
+						Containers: []executor.ContainerConfiguration{
+							{Env: []v1.EnvVar{{Name: "PASSWORD", ValueFrom: fromSecret("quay")}, {Name: "CI", Value: "true"}}},
+						},
+						Services: []executor.ServiceConfiguration{
+							{ContainerConfiguration: executor.ContainerConfiguration{Env: []v1.EnvVar{{Name: "PASSWORD", ValueFrom: fromSecret("quay")}}}},
+						},
+					},
+					{
+						Skip:       true,
+						Containers: []executor.ContainerConfiguration{{Env: []v1.EnvVar{{Name: "TOKEN", ValueFrom: fromSecret("deploy")}}}},
+					},
+				},
+			},
+		},
+	}
+
+	names := getReferencedSecretNames(c)
+	if expected := []string{"ssh", "tls", "quay"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected secrets %v but got %v", expected, names)
+	}
+}
+
+func TestGetNetworkPolicy(t *testing.T) {
+	t.Parallel()
+
+	p := getNetworkPolicy([]string{"10.0.0.0/8"})
+
+	if len(p.Spec.PolicyTypes) != 2 {
+		t.Fatalf("expected policy to restrict ingress and egress but got %v", p.Spec.PolicyTypes)
+	}
+
+	if len(p.Spec.Ingress) != 1 || p.Spec.Ingress[0].From[0].PodSelector == nil || p.Spec.Ingress[0].From[0].NamespaceSelector != nil {
+		t.Fatalf("expected ingress from the namespace only but got %+v", p.Spec.Ingress)
+	}
+
+	block := p.Spec.Egress[0].To[0].IPBlock
+	if block == nil || block.CIDR != "0.0.0.0/0" || !reflect.DeepEqual(block.Except, []string{"10.0.0.0/8"}) {
+		t.Fatalf("expected egress to anywhere but the blocked ranges but got %+v", block)
+	}
+
+	dns := p.Spec.Egress[1]
+	if len(dns.To) != 0 || len(dns.Ports) != 2 || dns.Ports[0].Port.IntValue() != 53 {
+		t.Fatalf("expected dns to be allowed anywhere but got %+v", dns)
+	}
+}
+
+func TestExecuteIsolated(t *testing.T) {
+	t.Parallel()
+
+	server := kubetest.NewServer(nil)
+	defer server.Close()
+
+	client := server.Client()
+	_, err := client.CoreV1().Secrets("automation").Create(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "quay"},
+		Data:       map[string][]byte{"password": []byte("hunter2")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := NewKubernetesExecutorWithClient("automation", client)
+	k.SetIsolation(&Isolation{BlockedCIDRs: []string{"10.0.0.0/8"}})
+
+	c := executor.ExecutionConfiguration{
+		Stages: []executor.StageConfiguration{
+			{
+				Steps: []executor.StepConfiguration{
+					{
+						Containers: []executor.ContainerConfiguration{
+							{
+								Image:   "docker",
+								Command: "docker login",
+								Env: []v1.EnvVar{{Name: "PASSWORD", ValueFrom: &v1.EnvVarSource{
+									SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "quay"}, Key: "password"},
+								}}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := k.Execute(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.DidSucceed() {
+		t.Fatalf("expected execution to succeed but got %+v", result)
+	}
+
+	namespace := ""
+	for _, request := range server.Requests() {
+		if strings.HasPrefix(request, "POST /apis/batch/v1/namespaces/") {
+			namespace = strings.Split(request, "/")[5]
+		}
+	}
+	if !strings.HasPrefix(namespace, executionNamespacePrefix) {
+		t.Fatalf("expected job to run in an execution namespace but got %q", namespace)
+	}
+
+	for _, expected := range []string{
+		"POST /apis/networking.k8s.io/v1/namespaces/" + namespace + "/networkpolicies",
+		"POST /api/v1/namespaces/" + namespace + "/secrets",
+		"DELETE /api/v1/namespaces/" + namespace,
+	} {
+		if !containsString(server.Requests(), expected) {
+			t.Fatalf("expected request %q but got %v", expected, server.Requests())
+		}
+	}
+
+	if names := server.Names("/api/v1/namespaces"); len(names) != 0 {
+		t.Fatalf("expected execution namespace to be deleted but got %v", names)
+	}
+}
@@ -2,6 +2,8 @@ package kubernetes
 
 import (
 	"fmt"
+	"github.com/mxinden/automation/artifacts"
+	"github.com/mxinden/automation/cache"
 	"github.com/mxinden/automation/executor"
 	"github.com/pkg/errors"
 	batchv1 "k8s.io/api/batch/v1"
@@ -10,114 +12,213 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 	"log"
-	"os"
 	"strings"
-	"sync"
 	"time"
 )
 
+// defaultUnschedulableGracePeriod is the time a pod of a step may stay
+// unschedulable before the step is failed.
+const defaultUnschedulableGracePeriod = 5 * time.Minute
+
 type KubernetesExecutor struct {
+	dispatcher *dispatcher
+	// client and namespace are those of the cluster a step runs in, set by
+	// executeStep.
+	client    kubernetes.Interface
 	namespace string
+	// jobNamespace is the namespace the jobs of a step run in. It is
+	// namespace unless executions are isolated, in which case each
+	// execution has a namespace of its own in each cluster, given by
+	// jobNamespaces.
+	jobNamespace             string
+	jobNamespaces            map[string]string
+	isolation                *Isolation
+	unschedulableGracePeriod time.Duration
+	artifactStore            artifacts.Store
+	artifactImage            string
+	cacheStore               cache.Store
+	cacheImage               string
+	testReportsImage         string
+	maskedSecrets            []string
+	maskedValues             []string
 }
 
-func NewKubernetesExecutor(ns string) KubernetesExecutor {
-	return KubernetesExecutor{
-		namespace: ns,
+// NewKubernetesExecutor returns an executor running jobs in the given
+// namespace, connecting to Kubernetes as configured by the given options.
+func NewKubernetesExecutor(ns string, o ClientOptions) (KubernetesExecutor, error) {
+	client, err := NewClient(o)
+	if err != nil {
+		return KubernetesExecutor{}, errors.Wrap(err, "failed to create kubernetes client")
 	}
+	return NewKubernetesExecutorWithClient(ns, client), nil
 }
 
-func (k *KubernetesExecutor) Execute(c executor.ExecutionConfiguration) (executor.ExecutionResult, error) {
-	executionResult := executor.ExecutionResult{}
-
-	for _, stage := range c.Stages {
-		stageResult, err := k.executeStage(stage)
-		if err != nil {
-			return executionResult, err
-		}
-
-		executionResult.Stages = append(executionResult.Stages, stageResult)
+// NewKubernetesExecutorWithClient returns an executor running jobs in the
+// given namespace using the given client, e.g. a client of a kubetest.Server
+// in tests.
+func NewKubernetesExecutorWithClient(ns string, client kubernetes.Interface) KubernetesExecutor {
+	return NewKubernetesExecutorForClusters([]Cluster{{Name: defaultClusterName, Namespace: ns, Client: client}})
+}
 
-		if !stageResult.DidSucceed() {
-			return executionResult, nil
-		}
+// NewKubernetesExecutorForClusters returns an executor running each step in
+// the cluster it asks for. Steps not asking for a cluster run in the first
+// one.
+func NewKubernetesExecutorForClusters(clusters []Cluster) KubernetesExecutor {
+	return KubernetesExecutor{
+		dispatcher:               newDispatcher(clusters),
+		unschedulableGracePeriod: defaultUnschedulableGracePeriod,
+		testReportsImage:         defaultTestReportsImage,
 	}
+}
 
-	return executionResult, nil
+// SetArtifactStore enables collecting the artifacts of steps into the given
+// store, using the given image. Without a store, artifacts are not collected.
+func (k *KubernetesExecutor) SetArtifactStore(store artifacts.Store, image string) {
+	k.artifactStore = store
+	k.artifactImage = image
 }
 
-func (k *KubernetesExecutor) executeStage(s executor.StageConfiguration) (executor.StageResult, error) {
-	var wg sync.WaitGroup
-	stepResults := make(chan executor.StepResult, len(s.Steps))
-	stepErrors := make(chan error, len(s.Steps))
+// SetCacheStore enables restoring and saving the caches of steps in the given
+// store, using the given image. Without a store, caches are ignored.
+func (k *KubernetesExecutor) SetCacheStore(store cache.Store, image string) {
+	k.cacheStore = store
+	k.cacheImage = image
+}
 
-	for _, step := range s.Steps {
-		wg.Add(1)
-		go func(step executor.StepConfiguration) {
-			defer wg.Done()
-			stepResult, err := k.executeStep(step)
-			if err != nil {
-				stepErrors <- err
-			} else {
-				stepResults <- stepResult
-			}
-		}(step)
+// SetTestReportsImage sets the image printing the report files of steps. An
+// empty image keeps the default busybox.
+func (k *KubernetesExecutor) SetTestReportsImage(image string) {
+	if image != "" {
+		k.testReportsImage = image
 	}
+}
 
-	wg.Wait()
-	close(stepResults)
-	close(stepErrors)
-
-	stageResult := executor.StageResult{}
+// SetMasking redacts all values of the given secrets and the given values
+// from the results of steps, on top of the secrets referenced by the steps
+// themselves.
+func (k *KubernetesExecutor) SetMasking(secrets []string, values []string) {
+	k.maskedSecrets = secrets
+	k.maskedValues = values
+}
 
-	combinedError := []string{}
-	for err := range stepErrors {
-		combinedError = append(combinedError, err.Error())
-	}
-	if len(combinedError) != 0 {
-		return stageResult, errors.New(strings.Join(combinedError, "\n"))
+// Execute runs the steps of the given configuration as Kubernetes jobs, each
+// as soon as the steps it depends on succeeded.
+func (k *KubernetesExecutor) Execute(c executor.ExecutionConfiguration) (executor.ExecutionResult, error) {
+	if k.isolation != nil {
+		return k.executeIsolated(c)
 	}
 
-	for stepResult := range stepResults {
-		stageResult.Steps = append(stageResult.Steps, stepResult)
+	// Fail before running any step if a step can't run in any cluster.
+	_, err := k.dispatcher.clustersOf(c)
+	if err != nil {
+		return executor.ExecutionResult{}, err
 	}
 
-	return stageResult, nil
+	return executor.ExecuteGraph(c, k.executeStep)
 }
 
+// executeStep runs the given step in one of the clusters it asks for, once
+// that cluster has capacity for another job.
 func (k *KubernetesExecutor) executeStep(step executor.StepConfiguration) (executor.StepResult, error) {
-	stepResult := executor.StepResult{}
-
-	kubeClient, err := createKubeClient()
+	cluster, err := k.dispatcher.acquire(step)
 	if err != nil {
-		return stepResult, errors.Wrap(err, "faile to create kubeclient")
+		return executor.StepResult{}, err
 	}
+	defer k.dispatcher.release(cluster)
+
+	inCluster := *k
+	inCluster.client = cluster.Client
+	inCluster.namespace = cluster.Namespace
+	inCluster.jobNamespace = cluster.Namespace
+	if namespace, ok := k.jobNamespaces[cluster.Name]; ok {
+		inCluster.jobNamespace = namespace
+	}
+
+	return inCluster.executeStepInCluster(step)
+}
 
+func (k *KubernetesExecutor) executeStepInCluster(step executor.StepConfiguration) (executor.StepResult, error) {
+	stepResult := executor.StepResult{}
+
+	kubeClient := k.client
 	job := stepConfigToK8sJob(step)
 
-	job, err = kubeClient.BatchV1().Jobs(k.namespace).Create(job)
+	toCollect := []executor.Artifact{}
+	if len(step.Artifacts) != 0 {
+		if k.artifactStore == nil {
+			log.Printf("not collecting artifacts of step %v, as no artifact store is configured", step.Name)
+		} else {
+			toCollect = getArtifacts(job.ObjectMeta.Name, step.Artifacts)
+			err := addArtifactsToPodSpec(&job.Spec.Template.Spec, step.Containers, toCollect, k.artifactStore, k.artifactImage)
+			if err != nil {
+				return stepResult, errors.Wrap(err, "failed to add artifact collection")
+			}
+		}
+	}
+
+	toCache := []executor.CacheConfiguration{}
+	if len(step.Caches) != 0 {
+		if k.cacheStore == nil {
+			log.Printf("not restoring caches of step %v, as no cache store is configured", step.Name)
+		} else {
+			toCache = step.Caches
+			err := addCachesToPodSpec(&job.Spec.Template.Spec, step.Containers, toCache, k.cacheStore, k.cacheImage)
+			if err != nil {
+				return stepResult, errors.Wrap(err, "failed to add caches")
+			}
+		}
+	}
+
+	addTestReportsToPodSpec(&job.Spec.Template.Spec, step.Containers, step.TestReports, k.testReportsImage)
+
+	// Secrets are resolved upfront, as a step whose logs can't be masked
+	// must not run.
+	masker, err := k.newMasker(kubeClient, step)
+	if err != nil {
+		return stepResult, errors.Wrap(err, "failed to resolve secrets to mask")
+	}
+
+	job, err = kubeClient.BatchV1().Jobs(k.jobNamespace).Create(job)
 	if err != nil {
 		return stepResult, errors.Wrapf(err, "failed to create job %v", job.ObjectMeta.Name)
 	}
 
-	err = waitForJobToFinish(kubeClient, k.namespace, job.ObjectMeta.Name)
+	serviceContainerNames := getServiceContainerNames(step)
+
+	stuckReason, err := k.waitForJobToFinish(kubeClient, job.ObjectMeta.Name, serviceContainerNames)
 	if err != nil {
 		return stepResult, errors.Wrapf(err, "failed to waitForJobToFinish for job %v", job.ObjectMeta.Name)
 	}
 
-	stepResult, err = k.getJobResult(kubeClient, job.Name)
+	stepResult, err = k.getJobResult(kubeClient, job.Name, serviceContainerNames, toCollect, toCache, step.TestReports, stuckReason)
+	stepResult = masker.MaskStepResult(stepResult)
 	if err != nil {
 		return stepResult, errors.Wrapf(err, "failed to get job result for job %v", job.ObjectMeta.Name)
 	}
 
+	// The pod of a stuck job would otherwise keep on waiting forever, the
+	// services of a finished job would keep on running forever.
+	if stuckReason != "" || len(serviceContainerNames) != 0 {
+		err = deleteJob(kubeClient, k.jobNamespace, job.ObjectMeta.Name)
+		if err != nil {
+			return stepResult, errors.Wrapf(err, "failed to delete job %v", job.ObjectMeta.Name)
+		}
+	}
+
 	return stepResult, nil
 }
 
-func waitForJobToFinish(kubeClient *kubernetes.Clientset, namespace string, jobName string) error {
+// waitForJobToFinish waits until the given job either completed or failed. In
+// case one of the pods of the job is stuck, it returns the reason right away
+// instead of waiting for the job to time out. Services never terminate on
+// their own, thus a job with services is finished once all its other
+// containers terminated.
+func (k *KubernetesExecutor) waitForJobToFinish(kubeClient kubernetes.Interface, jobName string, serviceContainerNames []string) (string, error) {
+	stuckReason := ""
+
 	err := wait.Poll(time.Second, 30*time.Minute, func() (bool, error) {
-		job, err := kubeClient.BatchV1().Jobs(namespace).Get(jobName, metav1.GetOptions{})
+		job, err := kubeClient.BatchV1().Jobs(k.jobNamespace).Get(jobName, metav1.GetOptions{})
 		if err != nil {
 			return false, err
 		}
@@ -128,19 +229,105 @@ func waitForJobToFinish(kubeClient *kubernetes.Clientset, namespace string, jobN
 			}
 		}
 
+		pods, err := getPodsOfJob(kubeClient, k.jobNamespace, job.UID)
+		if err != nil {
+			return false, err
+		}
+
+		for _, pod := range pods {
+			stuckReason = getPodStuckReason(pod, time.Now(), k.unschedulableGracePeriod)
+			if stuckReason != "" {
+				return true, nil
+			}
+
+			err = annotateExitCodes(kubeClient, k.jobNamespace, pod)
+			if err != nil {
+				return false, err
+			}
+
+			if len(serviceContainerNames) == 0 {
+				continue
+			}
+
+			if getMainContainersTerminated(pod, serviceContainerNames) {
+				return true, nil
+			}
+
+			stuckReason = getServiceStuckReason(pod, serviceContainerNames)
+			if stuckReason != "" {
+				return true, nil
+			}
+		}
+
 		return false, nil
 	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return nil
+	return stuckReason, nil
 }
 
-func (k *KubernetesExecutor) getJobResult(kubeClient *kubernetes.Clientset, jobName string) (executor.StepResult, error) {
+// imagePullWaitingReasons are the container waiting reasons signaling that the
+// image of the container can not be pulled. ErrImagePull is left out on
+// purpose, as it might be a temporary failure, which Kubernetes retries before
+// backing off.
+var imagePullWaitingReasons = []string{"ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull"}
+
+// getPodStuckReason returns why the given pod will never finish successfully,
+// or an empty string if it is not stuck.
+func getPodStuckReason(pod v1.Pod, now time.Time, unschedulableGracePeriod time.Duration) string {
+	if pod.Status.Phase == v1.PodFailed && pod.Status.Reason == "Evicted" {
+		return fmt.Sprintf("pod evicted: %v", pod.Status.Message)
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type != v1.PodScheduled ||
+			condition.Status != v1.ConditionFalse ||
+			condition.Reason != v1.PodReasonUnschedulable {
+			continue
+		}
+
+		if now.Sub(pod.CreationTimestamp.Time) > unschedulableGracePeriod {
+			return fmt.Sprintf("pod unschedulable for more than %v: %v", unschedulableGracePeriod, condition.Message)
+		}
+	}
+
+	statuses := append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, s := range statuses {
+		if s.State.Waiting != nil && containsString(imagePullWaitingReasons, s.State.Waiting.Reason) {
+			return fmt.Sprintf("failed to pull image %v of container %v: %v", s.Image, s.Name, s.State.Waiting.Message)
+		}
+
+		if s.State.Terminated != nil && s.State.Terminated.Reason == "OOMKilled" {
+			return fmt.Sprintf("container %v was OOMKilled", s.Name)
+		}
+	}
+
+	return ""
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func deleteJob(kubeClient kubernetes.Interface, namespace string, jobName string) error {
+	propagation := metav1.DeletePropagationBackground
+	return kubeClient.BatchV1().Jobs(namespace).Delete(jobName, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+}
+
+// getJobResult collects the result of the given job. If the job got stuck,
+// stuckReason is recorded on all of its containers that did not terminate.
+func (k *KubernetesExecutor) getJobResult(kubeClient kubernetes.Interface, jobName string, serviceContainerNames []string, toCollect []executor.Artifact, toCache []executor.CacheConfiguration, reports []executor.TestReportConfiguration, stuckReason string) (executor.StepResult, error) {
 	stepResult := executor.StepResult{}
 
-	job, err := kubeClient.BatchV1().Jobs(k.namespace).Get(jobName, metav1.GetOptions{})
+	job, err := kubeClient.BatchV1().Jobs(k.jobNamespace).Get(jobName, metav1.GetOptions{})
 	if err != nil {
 		err = errors.Wrapf(err, "failed to retrieve job %v for StartTime and CompletionTime", job.Name)
 		return stepResult, err
@@ -154,7 +341,7 @@ func (k *KubernetesExecutor) getJobResult(kubeClient *kubernetes.Clientset, jobN
 		stepResult.CompletionTime = job.Status.CompletionTime.Time
 	}
 
-	pods, err := getPodsOfJob(kubeClient, k.namespace, job.UID)
+	pods, err := getPodsOfJob(kubeClient, k.jobNamespace, job.UID)
 	if err != nil {
 		return stepResult, errors.Wrapf(err, "failed to get pods of job uid %v", job.UID)
 	}
@@ -165,37 +352,155 @@ func (k *KubernetesExecutor) getJobResult(kubeClient *kubernetes.Clientset, jobN
 
 	pod := pods[0]
 
-	for _, c := range pod.Status.InitContainerStatuses {
-		stepResult.InitContainers = append(stepResult.InitContainers, getContainerResult(c))
+	containers, services := splitServiceContainers(pod.Spec.Containers, serviceContainerNames)
+	containers, collectsArtifacts := splitContainer(containers, artifactsContainerName)
+	containers, savesCaches := splitContainer(containers, cacheSaveContainerName)
+	containers, collectsTestReports := splitContainer(containers, testReportsContainerName)
+	initContainers, restoresCaches := splitContainer(pod.Spec.InitContainers, cacheRestoreContainerName)
+
+	stepResult.InitContainers = getContainerResults(initContainers, pod.Status.InitContainerStatuses, stuckReason)
+	stepResult.Containers = getContainerResults(containers, pod.Status.ContainerStatuses, stuckReason)
+	stepResult.Services = getContainerResults(services, pod.Status.ContainerStatuses, "")
+
+	// Jobs with services don't complete, as their services keep on running.
+	if stepResult.CompletionTime.IsZero() {
+		for _, c := range stepResult.Containers {
+			if c.CompletionTime.After(stepResult.CompletionTime) {
+				stepResult.CompletionTime = c.CompletionTime
+			}
+		}
 	}
 
-	for _, c := range pod.Status.ContainerStatuses {
-		stepResult.Containers = append(stepResult.Containers, getContainerResult(c))
+	// TODO: Get logs of init containers as well
+	for _, c := range containers {
+		options := &v1.PodLogOptions{Container: c.Name}
+		req := kubeClient.CoreV1().Pods(k.jobNamespace).GetLogs(pod.ObjectMeta.Name, options)
+		result, err := req.Do().Raw()
+		if err != nil {
+			// Containers of a stuck pod might never have started, thus
+			// there are no logs to retrieve.
+			if stuckReason != "" {
+				stepResult.Output = stuckReason
+				return stepResult, nil
+			}
+			return stepResult, errors.Wrapf(err, "failed to retrieve logs for pod %v", pod.ObjectMeta.Name)
+		}
+		stepResult.Output = stepResult.Output + string(result)
 	}
 
-	// TODO: Get logs of init containers as well
-	options := &v1.PodLogOptions{}
-	req := kubeClient.CoreV1().Pods(k.namespace).GetLogs(pod.ObjectMeta.Name, options)
-	result, err := req.Do().Raw()
-	if err != nil {
-		return stepResult, errors.Wrapf(err, "failed to retrieve logs for pod %v", pod.ObjectMeta.Name)
+	if collectsArtifacts {
+		options := &v1.PodLogOptions{Container: artifactsContainerName}
+		result, err := kubeClient.CoreV1().Pods(k.jobNamespace).GetLogs(pod.ObjectMeta.Name, options).Do().Raw()
+		if err != nil {
+			return stepResult, errors.Wrapf(err, "failed to retrieve artifact logs for pod %v", pod.ObjectMeta.Name)
+		}
+		stepResult.Artifacts = getUploadedArtifacts(string(result), toCollect)
+	}
+
+	if restoresCaches && savesCaches {
+		logs := map[string]string{}
+		for _, name := range []string{cacheRestoreContainerName, cacheSaveContainerName} {
+			options := &v1.PodLogOptions{Container: name}
+			result, err := kubeClient.CoreV1().Pods(k.jobNamespace).GetLogs(pod.ObjectMeta.Name, options).Do().Raw()
+			if err != nil {
+				return stepResult, errors.Wrapf(err, "failed to retrieve cache logs for pod %v", pod.ObjectMeta.Name)
+			}
+			logs[name] = string(result)
+		}
+		stepResult.Caches = getCacheResults(toCache, logs[cacheRestoreContainerName], logs[cacheSaveContainerName])
+	}
+
+	reportFiles := map[int]string{}
+	if collectsTestReports {
+		options := &v1.PodLogOptions{Container: testReportsContainerName}
+		result, err := kubeClient.CoreV1().Pods(k.jobNamespace).GetLogs(pod.ObjectMeta.Name, options).Do().Raw()
+		if err != nil {
+			return stepResult, errors.Wrapf(err, "failed to retrieve test report logs for pod %v", pod.ObjectMeta.Name)
+		}
+		reportFiles = getTestReportFiles(string(result))
+	}
+
+	if len(reports) != 0 {
+		// Invalid reports don't fail the step, its containers decide
+		// about that.
+		stepResult.TestSuites, err = executor.ParseTestReports(reports, stepResult.Output, reportFiles)
+		if err != nil {
+			log.Printf("failed to parse test reports of job %v: %v", jobName, err)
+		}
 	}
-	stepResult.Output = string(result)
 
 	return stepResult, nil
 }
 
+// getContainerResults returns a result for each of the given containers. A
+// container without a status never started, e.g. because its pod could not be
+// scheduled.
+func getContainerResults(containers []v1.Container, statuses []v1.ContainerStatus, stuckReason string) []executor.ContainerResult {
+	results := []executor.ContainerResult{}
+
+	for _, c := range containers {
+		result := executor.ContainerResult{
+			Name:  c.Name,
+			Image: c.Image,
+			State: executor.ContainerStateDidNotRun,
+		}
+
+		for _, s := range statuses {
+			if s.Name == c.Name {
+				result = getContainerResult(s)
+				result.Image = c.Image
+			}
+		}
+
+		if result.State != executor.ContainerStateTerminated && stuckReason != "" {
+			result.Reason = stuckReason
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
 func getContainerResult(s v1.ContainerStatus) executor.ContainerResult {
-	exitCode := int32(0)
-	if s.State.Terminated != nil {
-		exitCode = s.State.Terminated.ExitCode
+	result := executor.ContainerResult{
+		Name:         s.Name,
+		Image:        s.Image,
+		ImageDigest:  getImageDigest(s.ImageID),
+		State:        executor.ContainerStateDidNotRun,
+		RestartCount: s.RestartCount,
 	}
-	return executor.ContainerResult{
-		ExitCode: exitCode,
+
+	switch {
+	case s.State.Terminated != nil:
+		result.State = executor.ContainerStateTerminated
+		result.ExitCode = s.State.Terminated.ExitCode
+		result.StartTime = s.State.Terminated.StartedAt.Time
+		result.CompletionTime = s.State.Terminated.FinishedAt.Time
+		result.Reason = s.State.Terminated.Reason
+		result.Message = s.State.Terminated.Message
+	case s.State.Running != nil:
+		result.State = executor.ContainerStateRunning
+		result.StartTime = s.State.Running.StartedAt.Time
+	case s.State.Waiting != nil:
+		result.Reason = s.State.Waiting.Reason
+		result.Message = s.State.Waiting.Message
+	}
+
+	return result
+}
+
+// getImageDigest extracts the digest out of a container status image id like
+// "docker-pullable://debian@sha256:1234".
+func getImageDigest(imageID string) string {
+	i := strings.LastIndex(imageID, "@")
+	if i == -1 {
+		return ""
 	}
+	return imageID[i+1:]
 }
 
-func getPodsOfJob(kubeClient *kubernetes.Clientset, namespace string, uid types.UID) ([]v1.Pod, error) {
+func getPodsOfJob(kubeClient kubernetes.Interface, namespace string, uid types.UID) ([]v1.Pod, error) {
 	pods := []v1.Pod{}
 
 	podList, err := kubeClient.CoreV1().Pods(namespace).List(metav1.ListOptions{})
@@ -215,63 +520,67 @@ func getPodsOfJob(kubeClient *kubernetes.Clientset, namespace string, uid types.
 	return pods, nil
 }
 
-func createKubeClient() (*kubernetes.Clientset, error) {
-	var config *rest.Config
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		log.Println("failed to get in-cluster k8s client-go configuration, trying out-of-cluster next")
-		config, err = clientcmd.BuildConfigFromFlags("", os.Getenv("KUBECONFIG"))
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	return kubernetes.NewForConfig(config)
-}
-
 func stepConfigToK8sJob(config executor.StepConfiguration) *batchv1.Job {
 
-	containers := containerConfsToK8sContainers(config.Containers)
-	initContainers := containerConfsToK8sContainers(config.InitContainers)
+	containers := containerConfsToK8sContainers(config.Containers, "container")
+	initContainers := containerConfsToK8sContainers(config.InitContainers, "init-container")
 
 	job := &batchv1.Job{}
 
-	job.ObjectMeta.Name = getRandomName()
+	job.ObjectMeta.Name = getJobName(config.Name)
 	job.Spec.Template.Spec.ServiceAccountName = config.ServiceAccountName
 	job.Spec.Template.Spec.RestartPolicy = "Never"
 	job.Spec.Template.Spec.Containers = containers
 	job.Spec.Template.Spec.InitContainers = initContainers
 	job.Spec.Template.Spec.Volumes = config.Volumes
+	job.Spec.Template.Spec.NodeSelector = config.NodeSelector
+	job.Spec.Template.Spec.Tolerations = config.Tolerations
+	job.Spec.Template.Spec.Affinity = config.Affinity
+	job.Spec.Template.Spec.PriorityClassName = config.PriorityClassName
+	addServicesToPodSpec(&job.Spec.Template.Spec, config.Containers, config.Services)
 	job.Spec.BackoffLimit = new(int32)
 
 	return job
 }
 
-func containerConfsToK8sContainers(configs []executor.ContainerConfiguration) []v1.Container {
+// containerConfsToK8sContainers converts the given container configurations.
+// Containers without a name are named by the given prefix and their index.
+func containerConfsToK8sContainers(configs []executor.ContainerConfiguration, unnamedPrefix string) []v1.Container {
 	containers := []v1.Container{}
 
-	for _, c := range configs {
-		containers = append(containers, containerConfToK8sContainer(c))
+	for i, c := range configs {
+		container := containerConfToK8sContainer(c)
+		if c.Name == "" {
+			container.Name = fmt.Sprintf("%v-%v", unnamedPrefix, i)
+		}
+		containers = append(containers, container)
 	}
 
 	return containers
 }
 
-func containerConfToK8sContainer(config executor.ContainerConfiguration) v1.Container {
+func volumeMountsToK8sVolumeMounts(mounts []executor.VolumeMount) []v1.VolumeMount {
 	volumeMounts := []v1.VolumeMount{}
-	for _, m := range config.VolumeMounts {
+	for _, m := range mounts {
 		volumeMounts = append(volumeMounts, v1.VolumeMount{Name: m.Name, MountPath: m.MountPath})
 	}
+	return volumeMounts
+}
+
+func containerConfToK8sContainer(config executor.ContainerConfiguration) v1.Container {
+	volumeMounts := volumeMountsToK8sVolumeMounts(config.VolumeMounts)
+	command, args := config.Process()
 
 	container := v1.Container{
-		Name:            getRandomName(),
+		Name:            toDNSLabel(config.Name),
 		Image:           config.Image,
-		Command:         []string{"/bin/sh", "-c"},
-		Args:            []string{config.Command},
+		Command:         command,
+		Args:            args,
 		Env:             config.Env,
 		VolumeMounts:    volumeMounts,
 		WorkingDir:      config.WorkingDir,
 		SecurityContext: config.SecurityContext,
+		Resources:       config.Resources,
 	}
 
 	return container
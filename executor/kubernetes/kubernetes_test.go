@@ -2,18 +2,32 @@ package kubernetes
 
 import (
 	"github.com/mxinden/automation/executor"
+	"github.com/mxinden/automation/executor/kubernetes/kubetest"
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"strings"
 	"testing"
+	"time"
 )
 
+// newTestExecutor returns an executor running jobs in the automation
+// namespace of the cluster of the current kubeconfig.
+func newTestExecutor(t *testing.T) KubernetesExecutor {
+	k, err := NewKubernetesExecutor("automation", ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
 // ExecuteStep
 
 func TestExecuteStep(t *testing.T) {
 	t.Parallel()
 	expectedOutput := "test"
 
-	k := NewKubernetesExecutor("automation")
+	k := newTestExecutor(t)
 
 	stepConfig := executor.StepConfiguration{}
 	stepConfig.Containers = []executor.ContainerConfiguration{
@@ -30,10 +44,42 @@ func TestExecuteStep(t *testing.T) {
 	}
 }
 
+func TestExecuteStepInjectedClient(t *testing.T) {
+	t.Parallel()
+
+	server := kubetest.NewServer(func(pod *v1.Pod, logs map[string]string) {
+		kubetest.TerminateAll(pod, 3)
+		logs[pod.Spec.Containers[0].Name] = "test\n"
+	})
+	defer server.Close()
+
+	k := NewKubernetesExecutorWithClient("automation", server.Client())
+
+	stepConfig := executor.StepConfiguration{}
+	stepConfig.Containers = []executor.ContainerConfiguration{
+		{Command: "echo test; exit 3", Image: "debian"},
+	}
+
+	stepResult, err := k.executeStep(stepConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stepResult.Output != "test\n" {
+		t.Fatalf("expected output of the container but got %q", stepResult.Output)
+	}
+	if len(stepResult.Containers) != 1 || stepResult.Containers[0].ExitCode != 3 {
+		t.Fatalf("expected container to exit with 3 but got %+v", stepResult.Containers)
+	}
+	if stepResult.StartTime.IsZero() || stepResult.CompletionTime.IsZero() {
+		t.Fatalf("expected start and completion time of the job but got %+v", stepResult)
+	}
+}
+
 func TestExecuteStepFailure(t *testing.T) {
 	t.Parallel()
 
-	k := NewKubernetesExecutor("automation")
+	k := newTestExecutor(t)
 
 	stepConfig := executor.StepConfiguration{}
 	stepConfig.Containers = []executor.ContainerConfiguration{
@@ -55,7 +101,7 @@ func TestExecuteStepFailure(t *testing.T) {
 func TestExecuteStepEnv(t *testing.T) {
 	t.Parallel()
 
-	k := NewKubernetesExecutor("automation")
+	k := newTestExecutor(t)
 
 	stepConfig := executor.StepConfiguration{
 		Containers: []executor.ContainerConfiguration{
@@ -89,7 +135,7 @@ func TestExecuteStepEnv(t *testing.T) {
 func TestWorkingDir(t *testing.T) {
 	t.Parallel()
 
-	k := NewKubernetesExecutor("automation")
+	k := newTestExecutor(t)
 
 	stepConfig := executor.StepConfiguration{
 		Containers: []executor.ContainerConfiguration{
@@ -118,7 +164,7 @@ func TestWorkingDir(t *testing.T) {
 func TestExecuteStepInitContainerShareDataWithContainer(t *testing.T) {
 	t.Parallel()
 
-	k := NewKubernetesExecutor("automation")
+	k := newTestExecutor(t)
 
 	stepConfig := executor.StepConfiguration{
 		Volumes: []v1.Volume{
@@ -178,7 +224,7 @@ func TestExecuteStepInitContainerShareDataWithContainer(t *testing.T) {
 func TestExecuteStageStepsRunInParallel(t *testing.T) {
 	t.Parallel()
 
-	k := NewKubernetesExecutor("automation")
+	k := newTestExecutor(t)
 
 	config := executor.ExecutionConfiguration{
 		Stages: []executor.StageConfiguration{
@@ -236,7 +282,7 @@ func TestExecuteStageStepsRunInParallel(t *testing.T) {
 func TestExecuteDontRunSecondStageIfFirstFails(t *testing.T) {
 	t.Parallel()
 
-	k := NewKubernetesExecutor("automation")
+	k := newTestExecutor(t)
 
 	config := executor.ExecutionConfiguration{
 		Stages: []executor.StageConfiguration{
@@ -272,7 +318,286 @@ func TestExecuteDontRunSecondStageIfFirstFails(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if len(result.Stages) != 1 {
-		t.Fatalf("expected length of result.Stages to be 1, but got %v", len(result.Stages))
+	if len(result.Stages) != 2 || !result.Stages[1].Steps[0].NotRun {
+		t.Fatalf("expected the step of the second stage not to run, but got %+v", result.Stages)
+	}
+}
+
+// getPodStuckReason
+
+func TestGetPodStuckReason(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	gracePeriod := 5 * time.Minute
+
+	tests := []struct {
+		name    string
+		pod     v1.Pod
+		isStuck bool
+	}{
+		{
+			name: "running",
+			pod: v1.Pod{
+				Status: v1.PodStatus{
+					Phase: v1.PodRunning,
+					ContainerStatuses: []v1.ContainerStatus{
+						{State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+					},
+				},
+			},
+			isStuck: false,
+		},
+		{
+			name: "image pull back off",
+			pod: v1.Pod{
+				Status: v1.PodStatus{
+					Phase: v1.PodPending,
+					ContainerStatuses: []v1.ContainerStatus{
+						{State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}},
+					},
+				},
+			},
+			isStuck: true,
+		},
+		{
+			name: "init container image pull back off",
+			pod: v1.Pod{
+				Status: v1.PodStatus{
+					Phase: v1.PodPending,
+					InitContainerStatuses: []v1.ContainerStatus{
+						{State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}},
+					},
+				},
+			},
+			isStuck: true,
+		},
+		{
+			name: "OOMKilled",
+			pod: v1.Pod{
+				Status: v1.PodStatus{
+					Phase: v1.PodRunning,
+					ContainerStatuses: []v1.ContainerStatus{
+						{State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}}},
+					},
+				},
+			},
+			isStuck: true,
+		},
+		{
+			name: "evicted",
+			pod: v1.Pod{
+				Status: v1.PodStatus{
+					Phase:  v1.PodFailed,
+					Reason: "Evicted",
+				},
+			},
+			isStuck: true,
+		},
+		{
+			name: "unschedulable within grace period",
+			pod: v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-time.Minute))},
+				Status: v1.PodStatus{
+					Phase: v1.PodPending,
+					Conditions: []v1.PodCondition{
+						{Type: v1.PodScheduled, Status: v1.ConditionFalse, Reason: v1.PodReasonUnschedulable},
+					},
+				},
+			},
+			isStuck: false,
+		},
+		{
+			name: "unschedulable beyond grace period",
+			pod: v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))},
+				Status: v1.PodStatus{
+					Phase: v1.PodPending,
+					Conditions: []v1.PodCondition{
+						{Type: v1.PodScheduled, Status: v1.ConditionFalse, Reason: v1.PodReasonUnschedulable},
+					},
+				},
+			},
+			isStuck: true,
+		},
+	}
+
+	for _, tt := range tests {
+		reason := getPodStuckReason(tt.pod, now, gracePeriod)
+		if (reason != "") != tt.isStuck {
+			t.Fatalf("%v: expected pod to be stuck to be %v, but got reason '%v'", tt.name, tt.isStuck, reason)
+		}
+	}
+}
+
+func TestGetContainerResultsMarksUnstartedContainersOfStuckPod(t *testing.T) {
+	t.Parallel()
+
+	containers := []v1.Container{{Name: "first"}, {Name: "second"}}
+	statuses := []v1.ContainerStatus{
+		{Name: "first", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 0}}},
+	}
+
+	results := getContainerResults(containers, statuses, "pod evicted")
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 container results but got %v", len(results))
+	}
+
+	if !results[0].DidSucceed() {
+		t.Fatalf("expected terminated container to succeed, but got reason %v", results[0].Reason)
+	}
+
+	if results[1].DidSucceed() {
+		t.Fatal("expected container without status of stuck pod to fail")
+	}
+}
+
+func TestGetContainerResult(t *testing.T) {
+	t.Parallel()
+
+	startedAt := time.Now().Add(-time.Minute)
+	finishedAt := time.Now()
+
+	status := v1.ContainerStatus{
+		Name:         "sample-container",
+		Image:        "debian",
+		ImageID:      "docker-pullable://debian@sha256:1234",
+		RestartCount: 1,
+		State: v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{
+				ExitCode:   2,
+				Reason:     "Error",
+				StartedAt:  metav1.NewTime(startedAt),
+				FinishedAt: metav1.NewTime(finishedAt),
+			},
+		},
+	}
+
+	result := getContainerResult(status)
+
+	if result.Name != status.Name || result.Image != status.Image {
+		t.Fatalf("expected name %v and image %v but got %v and %v", status.Name, status.Image, result.Name, result.Image)
+	}
+
+	if result.ImageDigest != "sha256:1234" {
+		t.Fatalf("expected image digest sha256:1234 but got %v", result.ImageDigest)
+	}
+
+	if result.State != executor.ContainerStateTerminated || result.ExitCode != 2 || result.Reason != "Error" {
+		t.Fatalf("expected terminated container with exit code 2 and reason Error but got %+v", result)
+	}
+
+	if !result.StartTime.Equal(startedAt) || !result.CompletionTime.Equal(finishedAt) {
+		t.Fatalf("expected container to run from %v to %v but got %v to %v", startedAt, finishedAt, result.StartTime, result.CompletionTime)
+	}
+
+	if result.RestartCount != 1 {
+		t.Fatalf("expected restart count 1 but got %v", result.RestartCount)
+	}
+}
+
+// stepConfigToK8sJob
+
+func TestStepConfigToK8sJobScheduling(t *testing.T) {
+	t.Parallel()
+
+	stepConfig := executor.StepConfiguration{
+		NodeSelector:      map[string]string{"disktype": "ssd"},
+		Tolerations:       []v1.Toleration{{Key: "dedicated", Operator: v1.TolerationOpExists}},
+		PriorityClassName: "low",
+		Containers: []executor.ContainerConfiguration{
+			{
+				Command: "true",
+				Image:   "debian",
+				Resources: v1.ResourceRequirements{
+					Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")},
+				},
+			},
+		},
+	}
+
+	job := stepConfigToK8sJob(stepConfig)
+	spec := job.Spec.Template.Spec
+
+	if spec.NodeSelector["disktype"] != "ssd" {
+		t.Fatalf("expected node selector disktype=ssd but got %v", spec.NodeSelector)
+	}
+
+	if len(spec.Tolerations) != 1 || spec.Tolerations[0].Key != "dedicated" {
+		t.Fatalf("expected toleration for dedicated but got %v", spec.Tolerations)
+	}
+
+	if spec.PriorityClassName != "low" {
+		t.Fatalf("expected priority class low but got %v", spec.PriorityClassName)
+	}
+
+	if memory := spec.Containers[0].Resources.Limits[v1.ResourceMemory]; memory.String() != "1Gi" {
+		t.Fatalf("expected memory limit 1Gi but got %v", memory.String())
+	}
+}
+
+func TestStepConfigToK8sJobContainerNames(t *testing.T) {
+	t.Parallel()
+
+	stepConfig := executor.StepConfiguration{
+		Name: "Unit Tests",
+		InitContainers: []executor.ContainerConfiguration{
+			{Command: "true", Image: "debian"},
+		},
+		Containers: []executor.ContainerConfiguration{
+			{Name: "Go Test", Command: "true", Image: "golang"},
+			{Command: "true", Image: "debian"},
+		},
+	}
+
+	job := stepConfigToK8sJob(stepConfig)
+	spec := job.Spec.Template.Spec
+
+	if !strings.HasPrefix(job.Name, "unit-tests-") {
+		t.Fatalf("expected job name to be prefixed with step name but got %v", job.Name)
+	}
+
+	expectedNames := []string{"init-container-0", "go-test", "container-1"}
+	names := []string{spec.InitContainers[0].Name, spec.Containers[0].Name, spec.Containers[1].Name}
+
+	for i := range expectedNames {
+		if names[i] != expectedNames[i] {
+			t.Fatalf("expected container names %v but got %v", expectedNames, names)
+		}
+	}
+}
+
+func TestStepConfigToK8sJobCommandModes(t *testing.T) {
+	t.Parallel()
+
+	stepConfig := executor.StepConfiguration{
+		Containers: []executor.ContainerConfiguration{
+			{Command: "go test | tee report", Shell: "bash -eo pipefail", Image: "golang"},
+			{Entrypoint: []string{"/app"}, Args: []string{"--check"}, Image: "gcr.io/distroless/static"},
+			{Args: []string{"--check"}, Image: "gcr.io/distroless/static"},
+		},
+	}
+
+	containers := stepConfigToK8sJob(stepConfig).Spec.Template.Spec.Containers
+
+	expected := []struct {
+		command []string
+		args    []string
+	}{
+		{[]string{"bash", "-eo", "pipefail", "-c"}, []string{"go test | tee report"}},
+		{[]string{"/app"}, []string{"--check"}},
+		{nil, []string{"--check"}},
+	}
+
+	for i, e := range expected {
+		if strings.Join(containers[i].Command, " ") != strings.Join(e.command, " ") ||
+			strings.Join(containers[i].Args, " ") != strings.Join(e.args, " ") {
+			t.Fatalf("expected container %v to run %v %v but got %v %v", i, e.command, e.args, containers[i].Command, containers[i].Args)
+		}
+	}
+
+	if containers[2].Command != nil {
+		t.Fatalf("expected container without entrypoint to keep the one of its image but got %v", containers[2].Command)
 	}
 }
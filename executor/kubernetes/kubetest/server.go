@@ -0,0 +1,567 @@
+// Package kubetest provides a fake of the parts of the Kubernetes API used by
+// the Kubernetes executor, to test the executor without a cluster.
+package kubetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// kinds are the kinds of the resources served, by the name of their
+// collection.
+var kinds = map[string]string{
+	"namespaces":      "Namespace",
+	"pods":            "Pod",
+	"secrets":         "Secret",
+	"serviceaccounts": "ServiceAccount",
+	"resourcequotas":  "ResourceQuota",
+	"limitranges":     "LimitRange",
+	"jobs":            "Job",
+	"networkpolicies": "NetworkPolicy",
+}
+
+// Kubelet sets the status of a pod, like a kubelet running the pod would, and
+// the logs of its containers by their name. It is called when the pod is
+// created and whenever it is patched.
+type Kubelet func(pod *v1.Pod, logs map[string]string)
+
+// Server stores the objects created through it by their path. Creating a job
+// creates its pod, the status of which is set by the Kubelet. Once all
+// containers of the pod terminated, the job completes. Its URL is meant to be
+// used as the host of a Kubernetes client.
+type Server struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// objects are the JSON encoded objects of each collection, e.g.
+	// "/api/v1/namespaces/automation/pods", by their name.
+	objects map[string]map[string][]byte
+	// logs are the logs of containers by "namespace/pod/container".
+	logs     map[string]string
+	kubelet  Kubelet
+	uids     int
+	requests []string
+}
+
+// NewServer returns a server with the given kubelet. A nil kubelet terminates
+// all containers successfully and without logs.
+func NewServer(kubelet Kubelet) *Server {
+	if kubelet == nil {
+		kubelet = func(pod *v1.Pod, logs map[string]string) {
+			TerminateAll(pod, 0)
+		}
+	}
+
+	s := &Server{
+		objects: map[string]map[string][]byte{},
+		logs:    map[string]string{},
+		kubelet: kubelet,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Client returns a client of the server.
+func (s *Server) Client() kubernetes.Interface {
+	return kubernetes.NewForConfigOrDie(&rest.Config{Host: s.URL})
+}
+
+// TerminateAll terminates all containers of the given pod with the given exit
+// code.
+func TerminateAll(pod *v1.Pod, exitCode int32) {
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{}
+	for _, c := range pod.Spec.Containers {
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, Terminated(c, exitCode))
+	}
+	pod.Status.InitContainerStatuses = []v1.ContainerStatus{}
+	for _, c := range pod.Spec.InitContainers {
+		pod.Status.InitContainerStatuses = append(pod.Status.InitContainerStatuses, Terminated(c, 0))
+	}
+}
+
+// Terminated returns the status of the given container having terminated with
+// the given exit code.
+func Terminated(c v1.Container, exitCode int32) v1.ContainerStatus {
+	reason := "Completed"
+	if exitCode != 0 {
+		reason = "Error"
+	}
+
+	now := metav1.Now()
+	return v1.ContainerStatus{
+		Name:  c.Name,
+		Image: c.Image,
+		State: v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{
+				ExitCode:   exitCode,
+				Reason:     reason,
+				StartedAt:  now,
+				FinishedAt: now,
+			},
+		},
+	}
+}
+
+// Running returns the status of the given container still running.
+func Running(c v1.Container) v1.ContainerStatus {
+	return v1.ContainerStatus{
+		Name:  c.Name,
+		Image: c.Image,
+		State: v1.ContainerState{
+			Running: &v1.ContainerStateRunning{StartedAt: metav1.Now()},
+		},
+	}
+}
+
+// Names returns the names of the objects of the given collection, e.g.
+// "/api/v1/namespaces".
+func (s *Server) Names(collection string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := []string{}
+	for name := range s.objects[collection] {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Get decodes the object at the given path, e.g.
+// "/api/v1/namespaces/automation/pods/test", into the given object. It
+// returns false if there is no such object.
+func (s *Server) Get(path string, into interface{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := strings.LastIndex(path, "/")
+	raw, ok := s.objects[path[:i]][path[i+1:]]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(raw, into) == nil
+}
+
+// Requests returns all requests served so far, like
+// "POST /api/v1/namespaces".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	// Paths look like /api/v1/{segments} or /apis/{group}/{version}/{segments},
+	// an odd number of segments addressing a collection, an even one an
+	// object.
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	prefixLength := 2
+	if parts[0] == "apis" {
+		prefixLength = 3
+	}
+	if len(parts) <= prefixLength {
+		writeStatus(w, http.StatusNotFound, "NotFound", "unknown path "+r.URL.Path)
+		return
+	}
+	segments := parts[prefixLength:]
+
+	if len(segments) == 5 && segments[2] == "pods" && segments[4] == "log" {
+		s.handleLogs(w, r, segments[1], segments[3])
+		return
+	}
+
+	if len(segments)%2 == 1 {
+		collection := r.URL.Path
+		switch r.Method {
+		case "GET":
+			s.handleList(w, collection, segments[len(segments)-1])
+		case "POST":
+			s.handleCreate(w, r, collection, segments[len(segments)-1])
+		default:
+			writeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+		}
+		return
+	}
+
+	collection := "/" + strings.Join(parts[:len(parts)-1], "/")
+	name := segments[len(segments)-1]
+	switch r.Method {
+	case "GET":
+		s.handleGet(w, collection, name)
+	case "PATCH":
+		s.handlePatch(w, r, collection, name)
+	case "DELETE":
+		s.handleDelete(w, collection, name)
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+func (s *Server) handleList(w http.ResponseWriter, collection string, resource string) {
+	items := []json.RawMessage{}
+	for _, raw := range s.objects[collection] {
+		items = append(items, raw)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"kind":       kinds[resource] + "List",
+		"apiVersion": apiVersion(collection),
+		"metadata":   map[string]interface{}{},
+		"items":      items,
+	})
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request, collection string, resource string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	object := map[string]interface{}{}
+	err = json.Unmarshal(body, &object)
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	metadata, _ := object["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+		object["metadata"] = metadata
+	}
+
+	name, _ := metadata["name"].(string)
+	if name == "" {
+		s.uids++
+		generateName, _ := metadata["generateName"].(string)
+		name = fmt.Sprintf("%v%v", generateName, s.uids)
+		metadata["name"] = name
+	}
+
+	if _, exists := s.objects[collection][name]; exists {
+		writeStatus(w, http.StatusConflict, "AlreadyExists", fmt.Sprintf("%v %v already exists", resource, name))
+		return
+	}
+
+	s.uids++
+	metadata["uid"] = fmt.Sprintf("uid-%v", s.uids)
+	metadata["creationTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+	object["kind"] = kinds[resource]
+	object["apiVersion"] = apiVersion(collection)
+
+	raw, err := json.Marshal(object)
+	if err != nil {
+		writeStatus(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	s.store(collection, name, raw)
+
+	switch resource {
+	case "namespaces":
+		s.createDefaultServiceAccount(name)
+	case "jobs":
+		err = s.startJob(collection, raw)
+	case "pods":
+		err = s.runPod(collection, name)
+	}
+	if err != nil {
+		writeStatus(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(s.objects[collection][name])
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, collection string, name string) {
+	raw, ok := s.objects[collection][name]
+	if !ok {
+		writeStatus(w, http.StatusNotFound, "NotFound", fmt.Sprintf("%v not found", name))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(raw)
+}
+
+// handlePatch applies JSON merge patches and strategic merge patches, the
+// latter as far as they are merge patches.
+func (s *Server) handlePatch(w http.ResponseWriter, r *http.Request, collection string, name string) {
+	raw, ok := s.objects[collection][name]
+	if !ok {
+		writeStatus(w, http.StatusNotFound, "NotFound", fmt.Sprintf("%v not found", name))
+		return
+	}
+
+	patch := map[string]interface{}{}
+	err := json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	object := map[string]interface{}{}
+	err = json.Unmarshal(raw, &object)
+	if err != nil {
+		writeStatus(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	raw, err = json.Marshal(mergePatch(object, patch))
+	if err != nil {
+		writeStatus(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	s.store(collection, name, raw)
+
+	if strings.HasSuffix(collection, "/pods") {
+		err = s.runPod(collection, name)
+		if err != nil {
+			writeStatus(w, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(s.objects[collection][name])
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, collection string, name string) {
+	if _, ok := s.objects[collection][name]; !ok {
+		writeStatus(w, http.StatusNotFound, "NotFound", fmt.Sprintf("%v not found", name))
+		return
+	}
+	delete(s.objects[collection], name)
+
+	// Deleting a namespace deletes all objects within it.
+	if strings.HasSuffix(collection, "/namespaces") {
+		for c := range s.objects {
+			if strings.Contains(c, "/namespaces/"+name+"/") {
+				delete(s.objects, c)
+			}
+		}
+	}
+
+	writeStatus(w, http.StatusOK, "", "deleted")
+}
+
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request, namespace string, pod string) {
+	logs, ok := s.logs[namespace+"/"+pod+"/"+r.URL.Query().Get("container")]
+	if !ok {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", "container has no logs")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(logs))
+}
+
+func (s *Server) store(collection string, name string, raw []byte) {
+	if s.objects[collection] == nil {
+		s.objects[collection] = map[string][]byte{}
+	}
+	s.objects[collection][name] = raw
+}
+
+func (s *Server) createDefaultServiceAccount(namespace string) {
+	raw, _ := json.Marshal(v1.ServiceAccount{
+		TypeMeta:   metav1.TypeMeta{Kind: "ServiceAccount", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: namespace},
+	})
+	s.store("/api/v1/namespaces/"+namespace+"/serviceaccounts", "default", raw)
+}
+
+// startJob creates the pod of the given job.
+func (s *Server) startJob(collection string, raw []byte) error {
+	job := batchv1.Job{}
+	err := json.Unmarshal(raw, &job)
+	if err != nil {
+		return err
+	}
+
+	namespace := strings.Split(collection, "/")[5]
+	pod := v1.Pod{
+		TypeMeta: metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              job.Name + "-pod",
+			Namespace:         namespace,
+			UID:               types.UID(string(job.UID) + "-pod"),
+			CreationTimestamp: metav1.Now(),
+			Labels:            job.Spec.Template.Labels,
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "batch/v1", Kind: "Job", Name: job.Name, UID: job.UID},
+			},
+		},
+		Spec: job.Spec.Template.Spec,
+	}
+
+	raw, err = json.Marshal(pod)
+	if err != nil {
+		return err
+	}
+
+	podCollection := "/api/v1/namespaces/" + namespace + "/pods"
+	s.store(podCollection, pod.Name, raw)
+	return s.runPod(podCollection, pod.Name)
+}
+
+// runPod lets the kubelet set the status of the given pod and completes its
+// job once all containers terminated.
+func (s *Server) runPod(collection string, name string) error {
+	pod := v1.Pod{}
+	err := json.Unmarshal(s.objects[collection][name], &pod)
+	if err != nil {
+		return err
+	}
+
+	logs := map[string]string{}
+	s.kubelet(&pod, logs)
+	for container, l := range logs {
+		s.logs[pod.Namespace+"/"+pod.Name+"/"+container] = l
+	}
+	containers := append([]v1.Container{}, pod.Spec.InitContainers...)
+	for _, c := range append(containers, pod.Spec.Containers...) {
+		if _, ok := s.logs[pod.Namespace+"/"+pod.Name+"/"+c.Name]; !ok {
+			s.logs[pod.Namespace+"/"+pod.Name+"/"+c.Name] = ""
+		}
+	}
+
+	terminated, succeeded := true, true
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated == nil {
+			terminated = false
+		} else if status.State.Terminated.ExitCode != 0 {
+			succeeded = false
+		}
+	}
+	if len(pod.Status.ContainerStatuses) != len(pod.Spec.Containers) {
+		terminated = false
+	}
+
+	pod.Status.Phase = v1.PodRunning
+	if terminated && succeeded {
+		pod.Status.Phase = v1.PodSucceeded
+	} else if terminated {
+		pod.Status.Phase = v1.PodFailed
+	}
+
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		return err
+	}
+	s.store(collection, name, raw)
+
+	if !terminated {
+		return nil
+	}
+
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind == "Job" {
+			err = s.completeJob(pod.Namespace, ref.Name, succeeded)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) completeJob(namespace string, name string, succeeded bool) error {
+	collection := "/apis/batch/v1/namespaces/" + namespace + "/jobs"
+
+	job := batchv1.Job{}
+	err := json.Unmarshal(s.objects[collection][name], &job)
+	if err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	job.Status.StartTime = &job.CreationTimestamp
+	condition := batchv1.JobCondition{Type: batchv1.JobFailed, Status: v1.ConditionTrue}
+	if succeeded {
+		job.Status.CompletionTime = &now
+		condition.Type = batchv1.JobComplete
+	}
+	job.Status.Conditions = append(job.Status.Conditions, condition)
+
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	s.store(collection, name, raw)
+	return nil
+}
+
+// mergePatch applies the given JSON merge patch to the given object.
+func mergePatch(object map[string]interface{}, patch map[string]interface{}) map[string]interface{} {
+	for key, value := range patch {
+		if value == nil {
+			delete(object, key)
+			continue
+		}
+
+		patchMap, isMap := value.(map[string]interface{})
+		objectMap, wasMap := object[key].(map[string]interface{})
+		if isMap && wasMap {
+			object[key] = mergePatch(objectMap, patchMap)
+		} else if isMap {
+			object[key] = mergePatch(map[string]interface{}{}, patchMap)
+		} else {
+			object[key] = value
+		}
+	}
+	return object
+}
+
+// apiVersion returns e.g. "batch/v1" for "/apis/batch/v1/namespaces/x/jobs".
+func apiVersion(collection string) string {
+	parts := strings.Split(strings.Trim(collection, "/"), "/")
+	if parts[0] == "apis" {
+		return parts[1] + "/" + parts[2]
+	}
+	return parts[1]
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason string, message string) {
+	status := "Failure"
+	if code == http.StatusOK {
+		status = "Success"
+	}
+
+	writeJSON(w, code, metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   status,
+		Reason:   metav1.StatusReason(reason),
+		Code:     int32(code),
+		Message:  message,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,115 @@
+package kubernetes
+
+import (
+	"github.com/mxinden/automation/executor"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// newMasker returns a masker for the values of all secrets the given step
+// references, as well as the configured secrets and values.
+func (k *KubernetesExecutor) newMasker(kubeClient kubernetes.Interface, step executor.StepConfiguration) (*executor.Masker, error) {
+	getSecret := func(name string) (*v1.Secret, error) {
+		return kubeClient.CoreV1().Secrets(k.namespace).Get(name, metav1.GetOptions{})
+	}
+
+	values, err := getSecretValues(step, k.maskedSecrets, getSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return executor.NewMasker(append(values, k.maskedValues...)), nil
+}
+
+// getSecretValues returns the values of the secrets referenced by environment
+// variables and volumes of the given step, as well as all values of the given
+// secrets. Secrets which don't exist are skipped, as they can't leak.
+func getSecretValues(step executor.StepConfiguration, secretNames []string, getSecret func(name string) (*v1.Secret, error)) ([]string, error) {
+	values := []string{}
+	secrets := map[string]*v1.Secret{}
+
+	lookup := func(name string) (*v1.Secret, error) {
+		if secret, ok := secrets[name]; ok {
+			return secret, nil
+		}
+
+		secret, err := getSecret(name)
+		if apierrors.IsNotFound(err) {
+			secret, err = nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get secret %v", name)
+		}
+
+		secrets[name] = secret
+		return secret, nil
+	}
+
+	addAll := func(name string) error {
+		secret, err := lookup(name)
+		if err != nil || secret == nil {
+			return err
+		}
+		for _, value := range secret.Data {
+			values = append(values, string(value))
+		}
+		return nil
+	}
+
+	for _, name := range secretNames {
+		err := addAll(name)
+		if err != nil {
+			return values, err
+		}
+	}
+
+	for _, volume := range step.Volumes {
+		if volume.Secret != nil {
+			err := addAll(volume.Secret.SecretName)
+			if err != nil {
+				return values, err
+			}
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret == nil {
+					continue
+				}
+				err := addAll(source.Secret.Name)
+				if err != nil {
+					return values, err
+				}
+			}
+		}
+	}
+
+	containers := append([]executor.ContainerConfiguration{}, step.InitContainers...)
+	containers = append(containers, step.Containers...)
+	for _, s := range step.Services {
+		containers = append(containers, s.ContainerConfiguration)
+	}
+
+	for _, c := range containers {
+		for _, env := range c.Env {
+			if env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil {
+				continue
+			}
+
+			ref := env.ValueFrom.SecretKeyRef
+			secret, err := lookup(ref.Name)
+			if err != nil {
+				return values, err
+			}
+			if secret != nil {
+				if value, ok := secret.Data[ref.Key]; ok {
+					values = append(values, string(value))
+				}
+			}
+		}
+	}
+
+	return values, nil
+}
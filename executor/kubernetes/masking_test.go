@@ -0,0 +1,81 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/mxinden/automation/executor"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestGetSecretValues(t *testing.T) {
+	t.Parallel()
+
+	secrets := map[string]*v1.Secret{
+		"quay":     {Data: map[string][]byte{"password": []byte("quay-password"), "user": []byte("robot")}},
+		"ssh":      {Data: map[string][]byte{"id_rsa": []byte("private-key")}},
+		"database": {Data: map[string][]byte{"password": []byte("database-password")}},
+		"registry": {Data: map[string][]byte{"token": []byte("registry-token")}},
+	}
+	lookups := 0
+	getSecret := func(name string) (*v1.Secret, error) {
+		lookups++
+		secret, ok := secrets[name]
+		if !ok {
+			return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+		}
+		return secret, nil
+	}
+
+	fromSecret := func(name, key string) *v1.EnvVarSource {
+		return &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: name}, Key: key}}
+	}
+
+	step := executor.StepConfiguration{
+		Volumes: []v1.Volume{
+			{Name: "ssh", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "ssh"}}},
+			{Name: "credentials", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{
+				Sources: []v1.VolumeProjection{
+					{Secret: &v1.SecretProjection{LocalObjectReference: v1.LocalObjectReference{Name: "registry"}}},
+					{Secret: &v1.SecretProjection{LocalObjectReference: v1.LocalObjectReference{Name: "ssh"}}},
+				},
+			}}},
+		},
+		Containers: []executor.ContainerConfiguration{
+			{Env: []v1.EnvVar{
+				{Name: "PASSWORD", ValueFrom: fromSecret("quay", "password")},
+				{Name: "PASSWORD_AGAIN", ValueFrom: fromSecret("quay", "password")},
+				{Name: "MISSING", ValueFrom: fromSecret("missing", "password")},
+				{Name: "PLAIN", Value: "not a secret"},
+			}},
+		},
+		Services: []executor.ServiceConfiguration{
+			{ContainerConfiguration: executor.ContainerConfiguration{Env: []v1.EnvVar{{Name: "PASSWORD", ValueFrom: fromSecret("database", "password")}}}},
+		},
+	}
+
+	values, err := getSecretValues(step, []string{}, getSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(values)
+	expected := "[database-password private-key private-key quay-password quay-password registry-token]"
+	if fmt.Sprint(values) != expected {
+		t.Fatalf("expected %v but got %v", expected, values)
+	}
+	if lookups != 5 {
+		t.Fatalf("expected each secret to be looked up once but got %v lookups", lookups)
+	}
+
+	failing := func(name string) (*v1.Secret, error) {
+		return nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, name, fmt.Errorf("forbidden"))
+	}
+	_, err = getSecretValues(step, []string{}, failing)
+	if err == nil {
+		t.Fatal("expected failing lookups to fail")
+	}
+}
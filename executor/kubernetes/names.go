@@ -0,0 +1,40 @@
+package kubernetes
+
+import (
+	"regexp"
+	"strings"
+)
+
+// dnsLabelMaxLength is the maximum length of names of e.g. containers.
+const dnsLabelMaxLength = 63
+
+var invalidDNSLabelCharacters = regexp.MustCompile("[^a-z0-9-]+")
+
+// toDNSLabel turns a name given in a configuration into a valid DNS-1123
+// label, as required for e.g. container names.
+func toDNSLabel(name string) string {
+	label := invalidDNSLabelCharacters.ReplaceAllString(strings.ToLower(name), "-")
+	if len(label) > dnsLabelMaxLength {
+		label = label[:dnsLabelMaxLength]
+	}
+	return strings.Trim(label, "-")
+}
+
+// getJobName returns a unique job name, prefixed with the name of the step to
+// ease debugging if given.
+func getJobName(stepName string) string {
+	name := getRandomName()
+
+	prefix := toDNSLabel(stepName)
+	if prefix == "" {
+		return name
+	}
+
+	// Leave room for the random suffix and the separator.
+	maxPrefixLength := dnsLabelMaxLength - len(name) - 1
+	if len(prefix) > maxPrefixLength {
+		prefix = strings.Trim(prefix[:maxPrefixLength], "-")
+	}
+
+	return prefix + "-" + name
+}
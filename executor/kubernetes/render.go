@@ -0,0 +1,27 @@
+package kubernetes
+
+import (
+	"github.com/mxinden/automation/executor"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// RenderJobs returns the jobs Execute would create for the steps of the given
+// configuration, in configuration order. Skipped steps are left out.
+func RenderJobs(c executor.ExecutionConfiguration) []*batchv1.Job {
+	jobs := []*batchv1.Job{}
+
+	for _, stage := range c.Stages {
+		for _, step := range stage.Steps {
+			if step.Skip {
+				continue
+			}
+
+			job := stepConfigToK8sJob(step)
+			job.TypeMeta.APIVersion = "batch/v1"
+			job.TypeMeta.Kind = "Job"
+			jobs = append(jobs, job)
+		}
+	}
+
+	return jobs
+}
@@ -0,0 +1,43 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mxinden/automation/executor"
+)
+
+func TestRenderJobs(t *testing.T) {
+	t.Parallel()
+
+	c := executor.ExecutionConfiguration{
+		Stages: []executor.StageConfiguration{
+			{
+				Steps: []executor.StepConfiguration{
+					{Name: "build", Containers: []executor.ContainerConfiguration{{Command: "go build", Image: "golang"}}},
+					{Name: "deploy", Skip: true, Containers: []executor.ContainerConfiguration{{Command: "kubectl apply", Image: "kubectl"}}},
+				},
+			},
+			{
+				Steps: []executor.StepConfiguration{
+					{Name: "test", Containers: []executor.ContainerConfiguration{{Command: "go test", Image: "golang"}}},
+				},
+			},
+		},
+	}
+
+	jobs := RenderJobs(c)
+
+	if len(jobs) != 2 {
+		t.Fatalf("expected skipped step not to be rendered but got %v jobs", len(jobs))
+	}
+
+	for i, prefix := range []string{"build-", "test-"} {
+		if !strings.HasPrefix(jobs[i].Name, prefix) {
+			t.Fatalf("expected job %v to be prefixed with %v but got %v", i, prefix, jobs[i].Name)
+		}
+		if jobs[i].APIVersion != "batch/v1" || jobs[i].Kind != "Job" {
+			t.Fatalf("expected job %v to have a type but got %v", i, jobs[i].TypeMeta)
+		}
+	}
+}
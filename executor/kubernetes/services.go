@@ -0,0 +1,155 @@
+package kubernetes
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/mxinden/automation/executor"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	// servicesVolumeName is the volume shared by the services and the
+	// containers of a step to signal service readiness.
+	servicesVolumeName = "automation-services"
+	servicesMountPath  = "/automation-services"
+)
+
+func serviceContainerName(s executor.ServiceConfiguration) string {
+	return toDNSLabel("service-" + s.Name)
+}
+
+func getServiceContainerNames(step executor.StepConfiguration) []string {
+	names := []string{}
+	for _, s := range step.Services {
+		names = append(names, serviceContainerName(s))
+	}
+	return names
+}
+
+func serviceReadyFile(s executor.ServiceConfiguration) string {
+	return path.Join(servicesMountPath, serviceContainerName(s)+".ready")
+}
+
+// addServicesToPodSpec adds the services of a step to the given pod spec.
+// Containers of the step wait for the readiness checks of all services to
+// succeed before running their own command. There is no native way to signal
+// readiness from one container to another, thus a readiness check touches a
+// file on a shared volume, which the containers wait for.
+func addServicesToPodSpec(spec *v1.PodSpec, containers []executor.ContainerConfiguration, services []executor.ServiceConfiguration) {
+	if len(services) == 0 {
+		return
+	}
+
+	spec.Volumes = append(spec.Volumes, v1.Volume{
+		Name:         servicesVolumeName,
+		VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+	})
+	mount := v1.VolumeMount{Name: servicesVolumeName, MountPath: servicesMountPath}
+
+	waitForServices := getWaitForServicesScript(services)
+	for i := range spec.Containers {
+		spec.Containers[i].VolumeMounts = append(spec.Containers[i].VolumeMounts, mount)
+		// Containers without a shell can't wait, validation rejects them
+		// in steps with readiness checks.
+		if waitForServices != "" && containers[i].Command != "" {
+			spec.Containers[i].Args[0] = waitForServices + spec.Containers[i].Args[0]
+		}
+	}
+
+	for _, s := range services {
+		container := v1.Container{
+			Name:            serviceContainerName(s),
+			Image:           s.Image,
+			Env:             s.Env,
+			VolumeMounts:    append(volumeMountsToK8sVolumeMounts(s.VolumeMounts), mount),
+			WorkingDir:      s.WorkingDir,
+			SecurityContext: s.SecurityContext,
+			Resources:       s.Resources,
+		}
+
+		container.Command, container.Args = s.Process()
+
+		if s.ReadinessCheck != "" {
+			container.ReadinessProbe = &v1.Probe{
+				Handler: v1.Handler{
+					Exec: &v1.ExecAction{
+						Command: []string{
+							"/bin/sh",
+							"-c",
+							fmt.Sprintf("(%v) && touch %v", s.ReadinessCheck, serviceReadyFile(s)),
+						},
+					},
+				},
+				PeriodSeconds: 1,
+			}
+		}
+
+		spec.Containers = append(spec.Containers, container)
+	}
+}
+
+// getWaitForServicesScript returns a shell snippet blocking until all services
+// with a readiness check are ready.
+func getWaitForServicesScript(services []executor.ServiceConfiguration) string {
+	script := ""
+	for _, s := range services {
+		if s.ReadinessCheck == "" {
+			continue
+		}
+		script = script + fmt.Sprintf("until [ -f %v ]; do sleep 1; done; ", serviceReadyFile(s))
+	}
+	return script
+}
+
+// getMainContainersTerminated returns true once all containers of the pod
+// which are not services terminated.
+func getMainContainersTerminated(pod v1.Pod, serviceContainerNames []string) bool {
+	if len(pod.Status.ContainerStatuses) == 0 {
+		return false
+	}
+
+	for _, s := range pod.Status.ContainerStatuses {
+		if containsString(serviceContainerNames, s.Name) {
+			continue
+		}
+		if s.State.Terminated == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getServiceStuckReason returns a reason if a service terminated while the
+// containers of the step still depend on it.
+func getServiceStuckReason(pod v1.Pod, serviceContainerNames []string) string {
+	for _, s := range pod.Status.ContainerStatuses {
+		if containsString(serviceContainerNames, s.Name) && s.State.Terminated != nil {
+			return fmt.Sprintf(
+				"service %v terminated unexpectedly with exit code %v",
+				strings.TrimPrefix(s.Name, "service-"),
+				s.State.Terminated.ExitCode,
+			)
+		}
+	}
+	return ""
+}
+
+// splitServiceContainers separates the service containers from the main
+// containers of a pod.
+func splitServiceContainers(containers []v1.Container, serviceContainerNames []string) ([]v1.Container, []v1.Container) {
+	main := []v1.Container{}
+	services := []v1.Container{}
+
+	for _, c := range containers {
+		if containsString(serviceContainerNames, c.Name) {
+			services = append(services, c)
+		} else {
+			main = append(main, c)
+		}
+	}
+
+	return main, services
+}
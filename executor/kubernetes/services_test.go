@@ -0,0 +1,160 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mxinden/automation/executor"
+	"github.com/mxinden/automation/executor/kubernetes/kubetest"
+	"k8s.io/api/core/v1"
+)
+
+func TestExecuteStepWithService(t *testing.T) {
+	t.Parallel()
+
+	k := newTestExecutor(t)
+
+	stepConfig := executor.StepConfiguration{
+		Services: []executor.ServiceConfiguration{
+			{
+				Name:                   "redis",
+				ContainerConfiguration: executor.ContainerConfiguration{Image: "redis"},
+				ReadinessCheck:         "redis-cli ping",
+			},
+		},
+		Containers: []executor.ContainerConfiguration{
+			{Command: "redis-cli -h localhost ping", Image: "redis"},
+		},
+	}
+
+	stepResult, err := k.executeStep(stepConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(stepResult.Output) != "PONG" {
+		t.Fatalf("expected output PONG but got output %v", stepResult.Output)
+	}
+
+	if len(stepResult.Containers) != 1 {
+		t.Fatalf("expected 1 container result but got %v", len(stepResult.Containers))
+	}
+
+	if len(stepResult.Services) != 1 {
+		t.Fatalf("expected 1 service result but got %v", len(stepResult.Services))
+	}
+}
+
+func TestExecuteStepWithServiceDeletesJob(t *testing.T) {
+	t.Parallel()
+
+	// Services keep on running once the containers of the step terminated.
+	server := kubetest.NewServer(func(pod *v1.Pod, logs map[string]string) {
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{}
+		for _, c := range pod.Spec.Containers {
+			status := kubetest.Terminated(c, 0)
+			if c.Name == "service-redis" {
+				status = kubetest.Running(c)
+			}
+			pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, status)
+		}
+	})
+	defer server.Close()
+
+	k := NewKubernetesExecutorWithClient("automation", server.Client())
+
+	stepConfig := executor.StepConfiguration{
+		Services: []executor.ServiceConfiguration{
+			{Name: "redis", ContainerConfiguration: executor.ContainerConfiguration{Image: "redis"}},
+		},
+		Containers: []executor.ContainerConfiguration{
+			{Command: "redis-cli -h localhost ping", Image: "redis"},
+		},
+	}
+
+	stepResult, err := k.executeStep(stepConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stepResult.Services) != 1 {
+		t.Fatalf("expected 1 service result but got %v", len(stepResult.Services))
+	}
+
+	deleted := false
+	for _, r := range server.Requests() {
+		if strings.HasPrefix(r, "DELETE /apis/batch/v1/namespaces/automation/jobs/") {
+			deleted = true
+		}
+	}
+	if !deleted {
+		t.Fatalf("expected the job to be deleted to stop its services but got requests %v", server.Requests())
+	}
+	if jobs := server.Names("/apis/batch/v1/namespaces/automation/jobs"); len(jobs) != 0 {
+		t.Fatalf("expected no jobs to be left but got %v", jobs)
+	}
+}
+
+func TestStepConfigToK8sJobServices(t *testing.T) {
+	t.Parallel()
+
+	stepConfig := executor.StepConfiguration{
+		Services: []executor.ServiceConfiguration{
+			{
+				Name:                   "postgres",
+				ContainerConfiguration: executor.ContainerConfiguration{Image: "postgres"},
+				ReadinessCheck:         "pg_isready -h localhost",
+			},
+		},
+		Containers: []executor.ContainerConfiguration{
+			{Command: "psql -h localhost", Image: "postgres"},
+		},
+	}
+
+	spec := stepConfigToK8sJob(stepConfig).Spec.Template.Spec
+
+	if len(spec.Containers) != 2 {
+		t.Fatalf("expected 2 containers but got %v", len(spec.Containers))
+	}
+
+	main := spec.Containers[0]
+	if !strings.HasPrefix(main.Args[0], "until [ -f /automation-services/service-postgres.ready ]") ||
+		!strings.HasSuffix(main.Args[0], "psql -h localhost") {
+		t.Fatalf("expected container to wait for service readiness but got command %v", main.Args[0])
+	}
+
+	service := spec.Containers[1]
+	if service.Name != "service-postgres" {
+		t.Fatalf("expected service container name service-postgres but got %v", service.Name)
+	}
+
+	if service.Command != nil {
+		t.Fatalf("expected service without command to use image entrypoint but got %v", service.Command)
+	}
+
+	if service.ReadinessProbe == nil || service.ReadinessProbe.Exec == nil {
+		t.Fatal("expected service to have an exec readiness probe")
+	}
+}
+
+func TestGetMainContainersTerminated(t *testing.T) {
+	t.Parallel()
+
+	pod := v1.Pod{
+		Status: v1.PodStatus{
+			ContainerStatuses: []v1.ContainerStatus{
+				{Name: "main", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{}}},
+				{Name: "service-postgres", State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+			},
+		},
+	}
+
+	if !getMainContainersTerminated(pod, []string{"service-postgres"}) {
+		t.Fatal("expected main containers to be terminated despite running service")
+	}
+
+	pod.Status.ContainerStatuses[0].State = v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+
+	if getMainContainersTerminated(pod, []string{"service-postgres"}) {
+		t.Fatal("expected main containers not to be terminated")
+	}
+}
@@ -0,0 +1,174 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mxinden/automation/executor"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	terminationVolume    = "automation-termination"
+	terminationMountPath = "/automation-termination"
+	// The exit codes of the containers of a step are annotated on their pod
+	// by the executor and projected into a volume of the sidecars, as
+	// containers can terminate without running their exit trap.
+	exitCodesVolume    = "automation-exit-codes"
+	exitCodesMountPath = "/automation-exit-codes"
+	exitCodeAnnotation = "exit-code.automation/"
+)
+
+// signalTermination makes the containers of the step signal their exit code
+// to sidecars, so these can act once the containers terminated. Each container
+// running its command in a shell writes its exit code to a file on a shared
+// volume on exit of its shell. Containers not running such an exit trap, e.g.
+// ones without a command, killed ones or ones replacing their shell by exec,
+// are signaled by the executor instead, see annotateExitCodes. It returns the mounts of the sidecars and the names of
+// the containers. Calling it again returns the same, without adding another
+// signal.
+func signalTermination(spec *v1.PodSpec, containers []executor.ContainerConfiguration) ([]v1.VolumeMount, []string) {
+	mounts := []v1.VolumeMount{
+		{Name: terminationVolume, MountPath: terminationMountPath},
+		{Name: exitCodesVolume, MountPath: exitCodesMountPath},
+	}
+
+	alreadySignaled := false
+	for _, v := range spec.Volumes {
+		if v.Name == terminationVolume {
+			alreadySignaled = true
+		}
+	}
+
+	names := []string{}
+	exitCodes := []v1.DownwardAPIVolumeFile{}
+
+	// The first containers of the pod spec are the ones of the step,
+	// followed by services and sidecars.
+	for i := range containers {
+		c := &spec.Containers[i]
+		names = append(names, c.Name)
+		exitCodes = append(exitCodes, v1.DownwardAPIVolumeFile{
+			Path:     c.Name,
+			FieldRef: &v1.ObjectFieldSelector{FieldPath: fmt.Sprintf("metadata.annotations['%v%v']", exitCodeAnnotation, c.Name)},
+		})
+
+		// Only the command is run by a shell, args of an entrypoint
+		// are passed as is.
+		if !alreadySignaled && containers[i].Command != "" && len(c.Args) != 0 {
+			c.Args[0] = fmt.Sprintf("trap 'echo $? > %v' EXIT; ", path.Join(terminationMountPath, c.Name)) + c.Args[0]
+			c.VolumeMounts = append(c.VolumeMounts, mounts[0])
+		}
+	}
+
+	if !alreadySignaled {
+		spec.Volumes = append(spec.Volumes,
+			v1.Volume{
+				Name:         terminationVolume,
+				VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+			},
+			v1.Volume{
+				Name:         exitCodesVolume,
+				VolumeSource: v1.VolumeSource{DownwardAPI: &v1.DownwardAPIVolumeSource{Items: exitCodes}},
+			},
+		)
+	}
+
+	return mounts, names
+}
+
+// exitCodeOf returns a shell command printing the exit code of the given
+// container of signalTermination, preferring the one of its exit trap.
+func exitCodeOf(name string) string {
+	return fmt.Sprintf("cat %v 2>/dev/null || cat %v", path.Join(terminationMountPath, name), path.Join(exitCodesMountPath, name))
+}
+
+// waitForTermination returns a shell command waiting for the given containers
+// of signalTermination to terminate.
+func waitForTermination(names []string) string {
+	conditions := []string{}
+	for _, name := range names {
+		conditions = append(conditions, fmt.Sprintf(
+			"{ [ -f %v ] || [ -s %v ]; }",
+			path.Join(terminationMountPath, name),
+			path.Join(exitCodesMountPath, name),
+		))
+	}
+	return fmt.Sprintf("until %v; do sleep 1; done", strings.Join(conditions, " && "))
+}
+
+// terminatedSuccessfully returns a shell condition which is true if all given
+// containers of signalTermination exited with 0.
+func terminatedSuccessfully(names []string) string {
+	conditions := []string{}
+	for _, name := range names {
+		conditions = append(conditions, fmt.Sprintf(`[ "$(%v)" = 0 ]`, exitCodeOf(name)))
+	}
+	return strings.Join(conditions, " && ")
+}
+
+// annotateExitCodes annotates the exit codes of the terminated containers of
+// the given pod signaled by signalTermination, which were not annotated yet.
+func annotateExitCodes(kubeClient kubernetes.Interface, namespace string, pod v1.Pod) error {
+	signaled := map[string]bool{}
+	for _, v := range pod.Spec.Volumes {
+		if v.Name != exitCodesVolume || v.DownwardAPI == nil {
+			continue
+		}
+		for _, item := range v.DownwardAPI.Items {
+			signaled[item.Path] = true
+		}
+	}
+
+	annotations := map[string]string{}
+	for _, s := range pod.Status.ContainerStatuses {
+		if !signaled[s.Name] || s.State.Terminated == nil {
+			continue
+		}
+		if _, ok := pod.Annotations[exitCodeAnnotation+s.Name]; ok {
+			continue
+		}
+		annotations[exitCodeAnnotation+s.Name] = strconv.Itoa(int(s.State.Terminated.ExitCode))
+	}
+
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = kubeClient.CoreV1().Pods(namespace).Patch(pod.Name, types.MergePatchType, patch)
+	if err != nil {
+		return errors.Wrapf(err, "failed to annotate exit codes of pod %v", pod.Name)
+	}
+	return nil
+}
+
+// volumeMountsOf returns the volume mounts of the given containers, each mount
+// path once.
+func volumeMountsOf(containers []v1.Container) []v1.VolumeMount {
+	mounts := []v1.VolumeMount{}
+	mountPaths := map[string]bool{}
+
+	for _, c := range containers {
+		for _, m := range c.VolumeMounts {
+			if !mountPaths[m.MountPath] {
+				mountPaths[m.MountPath] = true
+				mounts = append(mounts, m)
+			}
+		}
+	}
+
+	return mounts
+}
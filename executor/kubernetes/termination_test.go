@@ -0,0 +1,44 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mxinden/automation/executor"
+)
+
+func TestSignalTerminationWithoutCommand(t *testing.T) {
+	t.Parallel()
+
+	step := executor.StepConfiguration{
+		Containers: []executor.ContainerConfiguration{
+			{Image: "golang", Command: "go test ./..."},
+			{Image: "registry", Entrypoint: []string{"/bin/registry"}},
+			{Image: "migrate", Entrypoint: []string{"/bin/migrate"}, Args: []string{"up"}},
+		},
+	}
+
+	job := stepConfigToK8sJob(step)
+	spec := &job.Spec.Template.Spec
+
+	_, names := signalTermination(spec, step.Containers)
+
+	if len(names) != 3 {
+		t.Fatalf("expected all 3 containers to be signaled but got %v", names)
+	}
+	if !strings.HasPrefix(spec.Containers[0].Args[0], "trap ") {
+		t.Fatalf("expected container with a command to signal its termination but got %v", spec.Containers[0].Args)
+	}
+	if len(spec.Containers[1].Args) != 0 {
+		t.Fatalf("expected container without args to be left as is but got %v", spec.Containers[1].Args)
+	}
+	if args := spec.Containers[2].Args; len(args) != 1 || args[0] != "up" {
+		t.Fatalf("expected args of an entrypoint to be left as is but got %v", args)
+	}
+
+	for _, v := range spec.Volumes {
+		if v.Name == exitCodesVolume && len(v.DownwardAPI.Items) != 3 {
+			t.Fatalf("expected exit codes of all 3 containers to be projected but got %v", v.DownwardAPI.Items)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package kubernetes
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mxinden/automation/executor"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	testReportsContainerName = "automation-test-reports"
+	defaultTestReportsImage  = "busybox"
+	// testReportBeginMarker and testReportEndMarker frame the base64
+	// encoded content of a report file in the logs of the test reports
+	// container, each followed by the index of the report.
+	testReportBeginMarker = "automation-test-report-begin"
+	testReportEndMarker   = "automation-test-report-end"
+)
+
+// addTestReportsToPodSpec adds a container of the given image printing the
+// report files of the given reports to its logs, once the containers of the
+// step terminated.
+// Logs are the only way to get files out of a terminated pod without a
+// store.
+func addTestReportsToPodSpec(spec *v1.PodSpec, containers []executor.ContainerConfiguration, reports []executor.TestReportConfiguration, image string) {
+	script := ""
+	for i, r := range reports {
+		if r.Path == "" {
+			continue
+		}
+
+		script = script + fmt.Sprintf(
+			"if [ -f %v ]; then echo %v %v; base64 %v; echo %v %v; fi\n",
+			shellQuote(r.Path),
+			testReportBeginMarker,
+			i,
+			shellQuote(r.Path),
+			testReportEndMarker,
+			i,
+		)
+	}
+
+	if script == "" {
+		return
+	}
+
+	terminationMounts, terminated := signalTermination(spec, containers)
+	mounts := append(terminationMounts, volumeMountsOf(spec.Containers[:len(containers)])...)
+
+	spec.Containers = append(spec.Containers, v1.Container{
+		Name:         testReportsContainerName,
+		Image:        image,
+		Command:      []string{"/bin/sh", "-c"},
+		Args:         []string{waitForTermination(terminated) + "\n" + script},
+		VolumeMounts: mounts,
+	})
+}
+
+// getTestReportFiles returns the content of the report files in the logs of
+// the test reports container by the index of their report.
+func getTestReportFiles(logs string) map[int]string {
+	files := map[int]string{}
+
+	current := -1
+	encoded := []string{}
+	for _, line := range strings.Split(logs, "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) == 2 && fields[0] == testReportBeginMarker {
+			i, err := strconv.Atoi(fields[1])
+			if err == nil {
+				current = i
+				encoded = []string{}
+			}
+			continue
+		}
+
+		if len(fields) == 2 && fields[0] == testReportEndMarker && fields[1] == strconv.Itoa(current) {
+			content, err := base64.StdEncoding.DecodeString(strings.Join(encoded, ""))
+			if err == nil {
+				files[current] = string(content)
+			}
+			current = -1
+			continue
+		}
+
+		if current != -1 {
+			encoded = append(encoded, strings.TrimSpace(line))
+		}
+	}
+
+	return files
+}
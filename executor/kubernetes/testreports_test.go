@@ -0,0 +1,108 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mxinden/automation/executor"
+	"github.com/mxinden/automation/executor/kubernetes/kubetest"
+	"k8s.io/api/core/v1"
+)
+
+func TestAddTestReportsToPodSpec(t *testing.T) {
+	t.Parallel()
+
+	step := executor.StepConfiguration{
+		Containers: []executor.ContainerConfiguration{
+			{
+				Command:      "mvn test",
+				Image:        "maven",
+				VolumeMounts: []executor.VolumeMount{{Name: "repository", MountPath: "/src"}},
+			},
+		},
+		TestReports: []executor.TestReportConfiguration{
+			{Format: executor.TestReportFormatGoTestJSON},
+			{Format: executor.TestReportFormatJUnit, Path: "/src/target/report.xml"},
+		},
+	}
+
+	job := stepConfigToK8sJob(step)
+	spec := &job.Spec.Template.Spec
+	addTestReportsToPodSpec(spec, step.Containers, step.TestReports, "registry.local/busybox")
+
+	if len(spec.Containers) != 2 || spec.Containers[1].Name != testReportsContainerName {
+		t.Fatalf("expected test reports container to be added but got %v", spec.Containers)
+	}
+	if image := spec.Containers[1].Image; image != "registry.local/busybox" {
+		t.Fatalf("expected test reports container to use the given image but got %v", image)
+	}
+
+	script := spec.Containers[1].Args[0]
+	expected := "if [ -f '/src/target/report.xml' ]; then echo automation-test-report-begin 1; base64 '/src/target/report.xml'; echo automation-test-report-end 1; fi"
+	if !strings.Contains(script, expected) {
+		t.Fatalf("expected script to contain %v but got %v", expected, script)
+	}
+
+	// Reports parsed from the output don't need a container.
+	step.TestReports = step.TestReports[:1]
+	job = stepConfigToK8sJob(step)
+	addTestReportsToPodSpec(&job.Spec.Template.Spec, step.Containers, step.TestReports, "busybox")
+	if len(job.Spec.Template.Spec.Containers) != 1 {
+		t.Fatalf("expected no test reports container but got %v", job.Spec.Template.Spec.Containers)
+	}
+}
+
+func TestGetTestReportFiles(t *testing.T) {
+	t.Parallel()
+
+	logs := "automation-test-report-begin 1\nPHRl\nc3RzdWl0ZS8+\nautomation-test-report-end 1\n" +
+		"automation-test-report-begin 2\nnot base64!\nautomation-test-report-end 2\n"
+
+	files := getTestReportFiles(logs)
+
+	if len(files) != 1 || files[1] != "<testsuite/>" {
+		t.Fatalf("expected the decoded report 1 but got %v", files)
+	}
+}
+
+func TestExecuteStepTestReportsWithoutExitTrap(t *testing.T) {
+	t.Parallel()
+
+	// The step container gets killed and thus never writes its exit code
+	// file. The test reports container only terminates once the exit code
+	// is annotated on the pod.
+	server := kubetest.NewServer(func(pod *v1.Pod, logs map[string]string) {
+		step, sidecar := pod.Spec.Containers[0], pod.Spec.Containers[1]
+
+		sidecarStatus := kubetest.Running(sidecar)
+		if pod.Annotations[exitCodeAnnotation+step.Name] == "137" {
+			sidecarStatus = kubetest.Terminated(sidecar, 0)
+		}
+
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{
+			kubetest.Terminated(step, 137),
+			sidecarStatus,
+		}
+	})
+	defer server.Close()
+
+	k := NewKubernetesExecutorWithClient("automation", server.Client())
+
+	stepConfig := executor.StepConfiguration{
+		Containers: []executor.ContainerConfiguration{
+			{Command: "exec go test ./...", Image: "golang"},
+		},
+		TestReports: []executor.TestReportConfiguration{
+			{Format: "junit", Path: "/src/report.xml"},
+		},
+	}
+
+	stepResult, err := k.executeStep(stepConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stepResult.Containers) != 1 || stepResult.Containers[0].ExitCode != 137 {
+		t.Fatalf("expected step container to exit with 137 but got %+v", stepResult.Containers)
+	}
+}
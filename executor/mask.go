@@ -0,0 +1,135 @@
+package executor
+
+import (
+	"encoding/base64"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	// Mask replaces secret values.
+	Mask = "***"
+	// minMaskedLength is the length below which values are not masked, as
+	// masking e.g. "1" or "true" would garble all logs without protecting
+	// anything.
+	minMaskedLength = 4
+	// minMaskedBase64Length is the length below which the base64 encodings
+	// of a value as part of a larger encoded text are not masked, as those
+	// lack the first and last characters of the encoded value.
+	minMaskedBase64Length = 8
+)
+
+// Masker redacts secret values from text, including their base64 and URL
+// encoded forms.
+type Masker struct {
+	replacer *strings.Replacer
+}
+
+// NewMasker returns a masker for the given secret values.
+func NewMasker(secrets []string) *Masker {
+	needles := map[string]bool{}
+
+	add := func(s string, minLength int) {
+		if len(s) >= minLength {
+			needles[s] = true
+		}
+	}
+
+	for _, secret := range secrets {
+		values := []string{secret}
+		// Multi-line secrets, e.g. private keys, might be printed line
+		// by line.
+		for _, line := range strings.Split(secret, "\n") {
+			values = append(values, strings.TrimSpace(line))
+		}
+
+		for _, v := range values {
+			add(v, minMaskedLength)
+			if len(v) < minMaskedLength {
+				continue
+			}
+
+			add(url.QueryEscape(v), minMaskedLength)
+			add(url.PathEscape(v), minMaskedLength)
+			add(base64.StdEncoding.EncodeToString([]byte(v)), minMaskedLength)
+			add(base64.URLEncoding.EncodeToString([]byte(v)), minMaskedLength)
+			for _, encoded := range embeddedBase64(v) {
+				add(encoded, minMaskedBase64Length)
+			}
+		}
+	}
+
+	// Longer needles first, so a value is masked as a whole instead of a
+	// shorter value contained in it.
+	sorted := []string{}
+	for n := range needles {
+		sorted = append(sorted, n)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i]) != len(sorted[j]) {
+			return len(sorted[i]) > len(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	pairs := []string{}
+	for _, n := range sorted {
+		pairs = append(pairs, n, Mask)
+	}
+
+	return &Masker{replacer: strings.NewReplacer(pairs...)}
+}
+
+// embeddedBase64 returns the base64 encodings of the given value as part of a
+// larger encoded text, e.g. the password within an encoded "user:password".
+// Base64 encodes blocks of three bytes, thus there is one encoding for each
+// offset of the value relative to a block. Only the characters of blocks
+// entirely within the value are returned, as the others depend on the
+// surrounding text.
+func embeddedBase64(v string) []string {
+	encodings := []string{}
+
+	for offset := 0; offset < 3; offset++ {
+		padded := strings.Repeat("\x00", offset) + v
+		encoded := base64.StdEncoding.EncodeToString([]byte(padded))
+
+		firstBlock := (offset + 2) / 3
+		lastBlock := len(padded) / 3
+		if lastBlock <= firstBlock {
+			continue
+		}
+
+		stable := encoded[4*firstBlock : 4*lastBlock]
+		encodings = append(encodings, stable)
+		encodings = append(encodings, strings.NewReplacer("+", "-", "/", "_").Replace(stable))
+	}
+
+	return encodings
+}
+
+// Mask redacts all secrets from the given text.
+func (m *Masker) Mask(s string) string {
+	return m.replacer.Replace(s)
+}
+
+// MaskStepResult redacts all secrets from the output and messages of the given
+// result.
+func (m *Masker) MaskStepResult(r StepResult) StepResult {
+	r.Output = m.Mask(r.Output)
+
+	for _, containers := range [][]ContainerResult{r.InitContainers, r.Containers, r.Services} {
+		for i := range containers {
+			containers[i].Reason = m.Mask(containers[i].Reason)
+			containers[i].Message = m.Mask(containers[i].Message)
+		}
+	}
+
+	for i := range r.TestSuites {
+		for j := range r.TestSuites[i].Cases {
+			r.TestSuites[i].Cases[j].Message = m.Mask(r.TestSuites[i].Cases[j].Message)
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,54 @@
+package executor
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMasker(t *testing.T) {
+	password := "s3cr3t+p@ss/word"
+	m := NewMasker([]string{password, "on", "-----BEGIN KEY-----\nMIIEpAIBAAKCAQEA\n-----END KEY-----"})
+
+	tests := []string{
+		"docker login -u=robot -p=" + password + " quay.io",
+		"https://robot:" + url.QueryEscape(password) + "@example.com",
+		"https://example.com/" + url.PathEscape(password),
+		"Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(password)),
+		base64.URLEncoding.EncodeToString([]byte(password)),
+		// Embedded at every offset relative to a base64 block.
+		`{"auth": "` + base64.StdEncoding.EncodeToString([]byte("robot:"+password)) + `"}`,
+		`{"auth": "` + base64.StdEncoding.EncodeToString([]byte("robot1:"+password)) + `"}`,
+		`{"auth": "` + base64.StdEncoding.EncodeToString([]byte("robot12:"+password)) + `"}`,
+		"+ echo MIIEpAIBAAKCAQEA",
+	}
+
+	for _, test := range tests {
+		masked := m.Mask(test)
+		if !strings.Contains(masked, Mask) {
+			t.Fatalf("expected %v to be masked but got %v", test, masked)
+		}
+		if strings.Contains(masked, password) || strings.Contains(masked, "MIIEpAIBAAKCAQEA") {
+			t.Fatalf("expected secret to be removed from %v but got %v", test, masked)
+		}
+	}
+
+	if masked := m.Mask("mount on /src"); masked != "mount on /src" {
+		t.Fatalf("expected short values not to be masked but got %v", masked)
+	}
+}
+
+func TestMaskStepResult(t *testing.T) {
+	m := NewMasker([]string{"hunter22"})
+
+	r := m.MaskStepResult(StepResult{
+		Output:     "password hunter22",
+		Containers: []ContainerResult{{Message: "failed with hunter22"}},
+		TestSuites: []TestSuiteResult{{Cases: []TestCaseResult{{Message: "expected hunter22"}}}},
+	})
+
+	if r.Output != "password ***" || r.Containers[0].Message != "failed with ***" || r.TestSuites[0].Cases[0].Message != "expected ***" {
+		t.Fatalf("expected output and messages to be masked but got %+v", r)
+	}
+}
@@ -0,0 +1,361 @@
+package executor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/api/core/v1"
+)
+
+// Matrix expands a step into one step per combination of its axis values.
+// Values are referenced as ${{ matrix.<axis> }} in images, commands,
+// entrypoints, args and environment variable values of the containers of the
+// step, as well as in cache keys.
+type Matrix struct {
+	Axes map[string][]string `yaml:"axes"`
+	// Include extends each combination of the cartesian product of the
+	// axes matching all axis values of an entry by the remaining values of
+	// the entry. An entry matching no combination is added as a combination
+	// of its own.
+	Include []map[string]string `yaml:"include"`
+	// Exclude removes all combinations matching every value of an entry.
+	Exclude []map[string]string `yaml:"exclude"`
+}
+
+var matrixReference = regexp.MustCompile(`\$\{\{\s*matrix\.([A-Za-z0-9_-]+)\s*\}\}`)
+
+// ExpandMatrices replaces every step with a matrix by one step per matrix
+// combination. Dependencies on such a step are replaced by dependencies on all
+// of its expansions.
+func ExpandMatrices(c ExecutionConfiguration) (ExecutionConfiguration, error) {
+	expandedNames := map[string][]string{}
+
+	for stageI, stage := range c.Stages {
+		steps := []StepConfiguration{}
+
+		for stepI, step := range stage.Steps {
+			if step.Matrix == nil {
+				steps = append(steps, step)
+				continue
+			}
+
+			// Unnamed steps are named by their position, as the
+			// combinations alone are the same for steps with the
+			// same axes.
+			name := step.Name
+			if name == "" {
+				name = defaultStepName(stageI, stepI)
+			}
+
+			expanded, err := expandMatrix(step, name)
+			if err != nil {
+				return c, err
+			}
+
+			if step.Name != "" {
+				for _, e := range expanded {
+					expandedNames[step.Name] = append(expandedNames[step.Name], e.Name)
+				}
+			}
+			steps = append(steps, expanded...)
+		}
+
+		c.Stages[stageI].Steps = steps
+	}
+
+	for stageI := range c.Stages {
+		for stepI, step := range c.Stages[stageI].Steps {
+			dependsOn := []string{}
+			for _, dependency := range step.DependsOn {
+				if names, ok := expandedNames[dependency]; ok {
+					dependsOn = append(dependsOn, names...)
+				} else {
+					dependsOn = append(dependsOn, dependency)
+				}
+			}
+			c.Stages[stageI].Steps[stepI].DependsOn = dependsOn
+		}
+	}
+
+	return c, nil
+}
+
+// expandMatrix expands the matrix of the given step into steps named after the
+// given name and their combination.
+func expandMatrix(step StepConfiguration, name string) ([]StepConfiguration, error) {
+	steps := []StepConfiguration{}
+
+	err := step.Matrix.validate()
+	if err != nil {
+		return steps, fmt.Errorf("step %v: %v", name, err)
+	}
+
+	for _, combination := range step.Matrix.combinations() {
+		expanded, err := expandCombination(step, name, combination)
+		if err != nil {
+			return steps, fmt.Errorf("step %v: %v", expanded.Name, err)
+		}
+		steps = append(steps, expanded)
+	}
+
+	return steps, nil
+}
+
+// validate rejects empty include and exclude entries, as an empty exclude
+// entry would remove all combinations.
+func (m *Matrix) validate() error {
+	for i, include := range m.Include {
+		if len(include) == 0 {
+			return fmt.Errorf("matrix include[%v] is empty", i)
+		}
+	}
+	for i, exclude := range m.Exclude {
+		if len(exclude) == 0 {
+			return fmt.Errorf("matrix exclude[%v] is empty", i)
+		}
+	}
+	return nil
+}
+
+func expandCombination(step StepConfiguration, name string, combination map[string]string) (StepConfiguration, error) {
+	expanded := step
+	expanded.Matrix = nil
+	expanded.Name = matrixStepName(name, combination)
+
+	var err error
+	expanded.InitContainers, err = interpolateContainers(step.InitContainers, combination)
+	if err != nil {
+		return expanded, err
+	}
+	expanded.Containers, err = interpolateContainers(step.Containers, combination)
+	if err != nil {
+		return expanded, err
+	}
+
+	expanded.Services = []ServiceConfiguration{}
+	for _, s := range step.Services {
+		containers, err := interpolateContainers([]ContainerConfiguration{s.ContainerConfiguration}, combination)
+		if err != nil {
+			return expanded, err
+		}
+		s.ContainerConfiguration = containers[0]
+		expanded.Services = append(expanded.Services, s)
+	}
+
+	expanded.Caches = []CacheConfiguration{}
+	for _, cache := range step.Caches {
+		cache.Key, err = interpolateMatrix(cache.Key, combination)
+		if err != nil {
+			return expanded, err
+		}
+		expanded.Caches = append(expanded.Caches, cache)
+	}
+
+	// Matrices commonly span clusters, e.g. one per architecture.
+	expanded.Cluster, err = interpolateMatrix(step.Cluster, combination)
+	if err != nil {
+		return expanded, err
+	}
+	if step.ClusterSelector != nil {
+		expanded.ClusterSelector = map[string]string{}
+		for label, value := range step.ClusterSelector {
+			expanded.ClusterSelector[label], err = interpolateMatrix(value, combination)
+			if err != nil {
+				return expanded, err
+			}
+		}
+	}
+
+	return expanded, nil
+}
+
+// combinations returns the cartesian product of the axes without the excluded
+// combinations, extended by the include entries.
+func (m *Matrix) combinations() []map[string]string {
+	combinations := []map[string]string{{}}
+
+	for _, axis := range sortedAxes(m.Axes) {
+		product := []map[string]string{}
+		for _, combination := range combinations {
+			for _, value := range m.Axes[axis] {
+				c := map[string]string{axis: value}
+				for k, v := range combination {
+					c[k] = v
+				}
+				product = append(product, c)
+			}
+		}
+		combinations = product
+	}
+
+	if len(m.Axes) == 0 {
+		combinations = []map[string]string{}
+	}
+
+	filtered := []map[string]string{}
+	for _, c := range combinations {
+		if !matchesAnyCombination(m.Exclude, c) {
+			filtered = append(filtered, c)
+		}
+	}
+
+	for _, include := range m.Include {
+		extended := false
+		for _, c := range filtered {
+			if m.extends(include, c) {
+				for k, v := range include {
+					c[k] = v
+				}
+				extended = true
+			}
+		}
+
+		if !extended {
+			c := map[string]string{}
+			for k, v := range include {
+				c[k] = v
+			}
+			filtered = append(filtered, c)
+		}
+	}
+
+	return filtered
+}
+
+// extends returns true if the given include entry matches all axis values of
+// the given combination it sets. Values of other keys, e.g. added by earlier
+// entries, can be overridden.
+func (m *Matrix) extends(include map[string]string, c map[string]string) bool {
+	for k, v := range include {
+		if _, isAxis := m.Axes[k]; isAxis && c[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAnyCombination returns true if all values of any of the given
+// partial combinations are contained in c.
+func matchesAnyCombination(partials []map[string]string, c map[string]string) bool {
+	for _, partial := range partials {
+		matches := true
+		for k, v := range partial {
+			if c[k] != v {
+				matches = false
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// matrixStepName returns e.g. "test (go=1.10, k8s=1.9)".
+func matrixStepName(name string, combination map[string]string) string {
+	values := []string{}
+	for _, axis := range sortedKeys(combination) {
+		values = append(values, fmt.Sprintf("%v=%v", axis, combination[axis]))
+	}
+
+	if name == "" {
+		return strings.Join(values, ", ")
+	}
+	return fmt.Sprintf("%v (%v)", name, strings.Join(values, ", "))
+}
+
+func interpolateContainers(containers []ContainerConfiguration, combination map[string]string) ([]ContainerConfiguration, error) {
+	interpolated := []ContainerConfiguration{}
+
+	for _, c := range containers {
+		var err error
+
+		c.Image, err = interpolateMatrix(c.Image, combination)
+		if err != nil {
+			return interpolated, err
+		}
+
+		c.Command, err = interpolateMatrix(c.Command, combination)
+		if err != nil {
+			return interpolated, err
+		}
+
+		c.Entrypoint, err = interpolateMatrixList(c.Entrypoint, combination)
+		if err != nil {
+			return interpolated, err
+		}
+
+		c.Args, err = interpolateMatrixList(c.Args, combination)
+		if err != nil {
+			return interpolated, err
+		}
+
+		env := []v1.EnvVar{}
+		for _, e := range c.Env {
+			e.Value, err = interpolateMatrix(e.Value, combination)
+			if err != nil {
+				return interpolated, err
+			}
+			env = append(env, e)
+		}
+		c.Env = env
+
+		interpolated = append(interpolated, c)
+	}
+
+	return interpolated, nil
+}
+
+func interpolateMatrix(s string, combination map[string]string) (string, error) {
+	var err error
+
+	result := matrixReference.ReplaceAllStringFunc(s, func(reference string) string {
+		axis := matrixReference.FindStringSubmatch(reference)[1]
+		value, ok := combination[axis]
+		if !ok {
+			err = fmt.Errorf("unknown matrix axis %v in %v", axis, s)
+		}
+		return value
+	})
+
+	return result, err
+}
+
+// interpolateMatrixList interpolates all elements into a new list, as the
+// given one is shared by all combinations.
+func interpolateMatrixList(list []string, combination map[string]string) ([]string, error) {
+	if list == nil {
+		return nil, nil
+	}
+
+	interpolated := []string{}
+	for _, s := range list {
+		s, err := interpolateMatrix(s, combination)
+		if err != nil {
+			return interpolated, err
+		}
+		interpolated = append(interpolated, s)
+	}
+
+	return interpolated, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedAxes(m map[string][]string) []string {
+	axes := []string{}
+	for axis := range m {
+		axes = append(axes, axis)
+	}
+	sort.Strings(axes)
+	return axes
+}
@@ -0,0 +1,245 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeExecutionConfigurationExpandsMatrix(t *testing.T) {
+	rawConfig := `
+stages:
+  - steps:
+      - name: test
+        matrix:
+          axes:
+            go: ["1.9", "1.10"]
+            k8s: ["1.8", "1.9"]
+          exclude:
+            - go: "1.9"
+              k8s: "1.9"
+          include:
+            - go: "1.11"
+              k8s: "1.10"
+        containers:
+          - image: "golang:${{ matrix.go }}"
+            command: "go test ./... -k8s ${{matrix.k8s}}"
+            env:
+              - name: K8S_VERSION
+                value: "${{ matrix.k8s }}"
+  - steps:
+      - name: build
+        dependsOn: ["test"]
+`
+
+	c, err := DecodeExecutionConfiguration(strings.NewReader(rawConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := c.Stages[0].Steps
+
+	expectedNames := []string{
+		"test (go=1.9, k8s=1.8)",
+		"test (go=1.10, k8s=1.8)",
+		"test (go=1.10, k8s=1.9)",
+		"test (go=1.11, k8s=1.10)",
+	}
+
+	if len(steps) != len(expectedNames) {
+		t.Fatalf("expected %v expanded steps but got %v", len(expectedNames), len(steps))
+	}
+
+	for i, name := range expectedNames {
+		if steps[i].Name != name {
+			t.Fatalf("expected step %v to be named %v but got %v", i, name, steps[i].Name)
+		}
+	}
+
+	container := steps[1].Containers[0]
+
+	if container.Image != "golang:1.10" {
+		t.Fatalf("expected image golang:1.10 but got %v", container.Image)
+	}
+
+	if container.Command != "go test ./... -k8s 1.8" {
+		t.Fatalf("expected matrix value in command but got %v", container.Command)
+	}
+
+	if container.Env[0].Value != "1.8" {
+		t.Fatalf("expected matrix value in env but got %v", container.Env[0].Value)
+	}
+
+	if steps[0].Containers[0].Image != "golang:1.9" {
+		t.Fatal("expected expanded steps not to share containers")
+	}
+
+	if len(c.Stages[1].Steps[0].DependsOn) != len(expectedNames) {
+		t.Fatalf("expected dependency on matrix step to be expanded but got %v", c.Stages[1].Steps[0].DependsOn)
+	}
+}
+
+func TestDecodeExecutionConfigurationExpandsMatrixClusterSelector(t *testing.T) {
+	rawConfig := `
+stages:
+  - steps:
+      - name: build
+        matrix:
+          axes:
+            arch: ["amd64", "arm64"]
+        clusterSelector:
+          arch: "${{ matrix.arch }}"
+        containers:
+          - image: golang
+            command: go build ./...
+`
+
+	c, err := DecodeExecutionConfiguration(strings.NewReader(rawConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, arch := range []string{"amd64", "arm64"} {
+		if selected := c.Stages[0].Steps[i].ClusterSelector["arch"]; selected != arch {
+			t.Fatalf("expected step %v to select cluster with arch %v but got %v", i, arch, selected)
+		}
+	}
+}
+
+func TestExpandMatricesUnknownAxis(t *testing.T) {
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{
+				Steps: []StepConfiguration{
+					{
+						Matrix:     &Matrix{Axes: map[string][]string{"go": {"1.10"}}},
+						Containers: []ContainerConfiguration{{Image: "golang:${{ matrix.golang }}"}},
+					},
+				},
+			},
+		},
+	}
+
+	if _, err := ExpandMatrices(c); err == nil {
+		t.Fatal("expected reference to unknown matrix axis to fail")
+	}
+}
+
+func TestMatrixCombinationsIncludeExtendsCombinations(t *testing.T) {
+	m := Matrix{
+		Axes:    map[string][]string{"go": {"1.10", "1.11"}},
+		Include: []map[string]string{{"go": "1.11", "race": "true"}},
+	}
+
+	expectedNames := []string{"go=1.10", "go=1.11, race=true"}
+
+	combinations := m.combinations()
+	if len(combinations) != len(expectedNames) {
+		t.Fatalf("expected %v combinations but got %v", len(expectedNames), combinations)
+	}
+	for i, name := range expectedNames {
+		if got := matrixStepName("", combinations[i]); got != name {
+			t.Fatalf("expected combination %v to be %v but got %v", i, name, got)
+		}
+	}
+}
+
+func TestMatrixCombinationsIncludeWithoutAxesExtendsAll(t *testing.T) {
+	m := Matrix{
+		Axes:    map[string][]string{"go": {"1.10", "1.11"}},
+		Include: []map[string]string{{"race": "true"}},
+	}
+
+	combinations := m.combinations()
+	if len(combinations) != 2 {
+		t.Fatalf("expected 2 combinations but got %v", combinations)
+	}
+	for _, c := range combinations {
+		if c["race"] != "true" {
+			t.Fatalf("expected all combinations to be extended but got %v", combinations)
+		}
+	}
+}
+
+func TestExpandMatricesPartialIncludeMissingAxis(t *testing.T) {
+	rawConfig := `
+stages:
+  - steps:
+      - name: test
+        matrix:
+          axes:
+            go: ["1.10"]
+            k8s: ["1.9"]
+          include:
+            - go: "1.12"
+        containers:
+          - image: "golang:${{ matrix.go }}"
+            command: "go test ./... -k8s ${{ matrix.k8s }}"
+`
+
+	_, err := DecodeExecutionConfiguration(strings.NewReader(rawConfig))
+	if err == nil {
+		t.Fatal("expected include matching no combination and lacking a referenced axis to fail")
+	}
+	if !strings.Contains(err.Error(), "test (go=1.12)") {
+		t.Fatalf("expected error to name the offending combination but got %v", err)
+	}
+}
+
+func TestExpandMatricesEmptyEntries(t *testing.T) {
+	for _, m := range []Matrix{
+		{Axes: map[string][]string{"go": {"1.10"}}, Exclude: []map[string]string{{}}},
+		{Axes: map[string][]string{"go": {"1.10"}}, Include: []map[string]string{{}}},
+	} {
+		m := m
+		c := ExecutionConfiguration{
+			Stages: []StageConfiguration{
+				{
+					Steps: []StepConfiguration{
+						{
+							Matrix:     &m,
+							Containers: []ContainerConfiguration{{Image: "golang:${{ matrix.go }}"}},
+						},
+					},
+				},
+			},
+		}
+
+		if _, err := ExpandMatrices(c); err == nil {
+			t.Fatalf("expected empty matrix entry of %+v to fail", m)
+		}
+	}
+}
+
+func TestExpandMatricesOfUnnamedSteps(t *testing.T) {
+	rawConfig := `
+stages:
+  - steps:
+      - matrix:
+          axes:
+            go: ["1"]
+        containers:
+          - image: "golang:${{ matrix.go }}"
+            command: "go test ./..."
+      - matrix:
+          axes:
+            go: ["1"]
+        containers:
+          - image: "golang:${{ matrix.go }}"
+            command: "go vet ./..."
+`
+
+	err := ValidateExecutionConfiguration([]byte(rawConfig))
+	if err != nil {
+		t.Fatalf("expected unnamed steps with the same axes to be valid but got %v", err)
+	}
+
+	c, err := DecodeExecutionConfiguration(strings.NewReader(rawConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := c.Stages[0].Steps
+	if len(steps) != 2 || steps[0].Name != "stage-0-step-0 (go=1)" || steps[1].Name != "stage-0-step-1 (go=1)" {
+		t.Fatalf("expected steps to be named by their position but got %v", steps)
+	}
+}
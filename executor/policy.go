@@ -0,0 +1,228 @@
+package executor
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/api/core/v1"
+)
+
+// Policy restricts what the steps of a repository can request. Every list is
+// an allowlist, thus an empty list allows nothing beyond the stated defaults.
+type Policy struct {
+	// Images are patterns of allowed images, matched by path.Match, e.g.
+	// "golang:*" or "quay.io/mxinden/*". "*" does not match slashes, thus
+	// "*" allows official images of Docker Hub only.
+	Images []string `yaml:"images"`
+	// ServiceAccounts are the allowed service accounts. The default
+	// service account of the namespace is always allowed.
+	ServiceAccounts []string `yaml:"serviceAccounts"`
+	// Secrets are the secrets allowed to be referenced by environment
+	// variables, secret volumes and projected volumes.
+	Secrets []string `yaml:"secrets"`
+	// VolumeTypes are the allowed types of volumes, named like their field
+	// in a volume, e.g. "hostPath". "emptyDir" is always allowed.
+	VolumeTypes []string `yaml:"volumeTypes"`
+	// Capabilities are the Linux capabilities containers are allowed to
+	// add, e.g. "NET_ADMIN".
+	Capabilities []string `yaml:"capabilities"`
+	// Privileged allows privileged containers, adding any capability,
+	// privilege escalation, running as root by "runAsUser: 0" and SELinux
+	// options.
+	Privileged bool `yaml:"privileged"`
+	// Clusters are the clusters steps can ask for by name or by a
+	// clusterSelector, all clusters matching which need to be allowed. Steps
+	// not asking for a cluster run in the default cluster.
+	Clusters []string `yaml:"clusters"`
+}
+
+// PolicyViolation is a field of a configuration requesting something the
+// policy of its repository does not allow.
+type PolicyViolation struct {
+	Path    string
+	Message string
+}
+
+func (v PolicyViolation) Error() string {
+	return fmt.Sprintf("%v: %v", v.Path, v.Message)
+}
+
+// PolicyViolations are all violations of a configuration.
+type PolicyViolations []PolicyViolation
+
+func (v PolicyViolations) Error() string {
+	messages := []string{}
+	for _, violation := range v {
+		messages = append(messages, violation.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// CheckPolicy returns all fields of the configuration violating the given
+// policy as PolicyViolations. Skipped steps are not checked, as they don't
+// run. The cluster selectors of steps are resolved against the given labels
+// of the clusters by their name.
+func CheckPolicy(c ExecutionConfiguration, p Policy, clusterLabels map[string]map[string]string) error {
+	violations := PolicyViolations{}
+	add := func(path string, format string, args ...interface{}) {
+		violations = append(violations, PolicyViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for stageI, stage := range c.Stages {
+		for stepI, step := range stage.Steps {
+			if step.Skip {
+				continue
+			}
+
+			stepPath := fmt.Sprintf("stages[%v].steps[%v]", stageI, stepI)
+			if step.Name != "" {
+				stepPath = fmt.Sprintf("stages[%v].steps[%v](%v)", stageI, stepI, step.Name)
+			}
+
+			if step.ServiceAccountName != "" && !containsString(p.ServiceAccounts, step.ServiceAccountName) {
+				add(stepPath+".serviceAccountName", "service account %q is not allowed", step.ServiceAccountName)
+			}
+
+			if step.Cluster != "" && !containsString(p.Clusters, step.Cluster) {
+				add(stepPath+".cluster", "cluster %q is not allowed", step.Cluster)
+			}
+
+			if len(step.ClusterSelector) != 0 {
+				for _, name := range selectedClusters(clusterLabels, step.ClusterSelector) {
+					if !containsString(p.Clusters, name) {
+						add(stepPath+".clusterSelector", "cluster %q matches the selector but is not allowed", name)
+					}
+				}
+			}
+
+			for i, volume := range step.Volumes {
+				volumePath := fmt.Sprintf("%v.volumes[%v]", stepPath, i)
+
+				volumeType := getVolumeType(volume.VolumeSource)
+				if volumeType != "emptyDir" && !containsString(p.VolumeTypes, volumeType) {
+					add(volumePath, "volume type %v is not allowed", volumeType)
+				}
+
+				if volume.Secret != nil && !containsString(p.Secrets, volume.Secret.SecretName) {
+					add(volumePath+".secret.secretName", "secret %q is not allowed", volume.Secret.SecretName)
+				}
+
+				if volume.Projected != nil {
+					for j, source := range volume.Projected.Sources {
+						if source.Secret != nil && !containsString(p.Secrets, source.Secret.Name) {
+							add(fmt.Sprintf("%v.projected.sources[%v].secret.name", volumePath, j), "secret %q is not allowed", source.Secret.Name)
+						}
+					}
+				}
+			}
+
+			containers := map[string][]ContainerConfiguration{
+				"initContainers": step.InitContainers,
+				"containers":     step.Containers,
+			}
+			for _, s := range step.Services {
+				containers["services"] = append(containers["services"], s.ContainerConfiguration)
+			}
+
+			for _, field := range []string{"initContainers", "containers", "services"} {
+				for i, container := range containers[field] {
+					containerPath := fmt.Sprintf("%v.%v[%v]", stepPath, field, i)
+
+					if !matchesAnyImage(p.Images, container.Image) {
+						add(containerPath+".image", "image %q is not allowed", container.Image)
+					}
+
+					if container.SecurityContext != nil && !p.Privileged {
+						checkSecurityContext(*container.SecurityContext, p, containerPath+".securityContext", add)
+					}
+
+					for j, env := range container.Env {
+						if env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil {
+							continue
+						}
+						if name := env.ValueFrom.SecretKeyRef.Name; !containsString(p.Secrets, name) {
+							add(fmt.Sprintf("%v.env[%v]", containerPath, j), "secret %q is not allowed", name)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if len(violations) != 0 {
+		return violations
+	}
+	return nil
+}
+
+// checkSecurityContext reports all fields of the given security context
+// granting more than an unprivileged container.
+func checkSecurityContext(sc v1.SecurityContext, p Policy, path string, add func(string, string, ...interface{})) {
+	if sc.Privileged != nil && *sc.Privileged {
+		add(path+".privileged", "privileged containers are not allowed")
+	}
+
+	if sc.AllowPrivilegeEscalation != nil && *sc.AllowPrivilegeEscalation {
+		add(path+".allowPrivilegeEscalation", "privilege escalation is not allowed")
+	}
+
+	if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+		add(path+".runAsUser", "running as root by user id 0 is not allowed")
+	}
+
+	if sc.SELinuxOptions != nil {
+		add(path+".seLinuxOptions", "SELinux options are not allowed")
+	}
+
+	if sc.Capabilities != nil {
+		for i, capability := range sc.Capabilities.Add {
+			if !containsString(p.Capabilities, string(capability)) {
+				add(fmt.Sprintf("%v.capabilities.add[%v]", path, i), "capability %v is not allowed", capability)
+			}
+		}
+	}
+}
+
+// selectedClusters returns the names of all clusters matching the given
+// selector, sorted.
+func selectedClusters(clusterLabels map[string]map[string]string, selector map[string]string) []string {
+	names := []string{}
+	for name, labels := range clusterLabels {
+		matches := true
+		for label, value := range selector {
+			if labels[label] != value {
+				matches = false
+			}
+		}
+		if matches {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func matchesAnyImage(patterns []string, image string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, image); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// getVolumeType returns the name of the field set in the given volume source,
+// e.g. "hostPath".
+func getVolumeType(s v1.VolumeSource) string {
+	value := reflect.ValueOf(s)
+	for i := 0; i < value.NumField(); i++ {
+		if value.Field(i).IsNil() {
+			continue
+		}
+		return strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+	}
+	return "emptyDir"
+}
@@ -0,0 +1,236 @@
+package executor
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestCheckPolicy(t *testing.T) {
+	privileged := true
+	secretEnv := v1.EnvVar{
+		Name: "TOKEN",
+		ValueFrom: &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: "deploy-token"},
+				Key:                  "token",
+			},
+		},
+	}
+
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{
+				Steps: []StepConfiguration{
+					{
+						Name:               "build",
+						ServiceAccountName: "deployer",
+						Volumes: []v1.Volume{
+							{Name: "src", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+							{Name: "docker", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/run/docker.sock"}}},
+							{Name: "token", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "deploy-token"}}},
+						},
+						InitContainers: []ContainerConfiguration{{Image: "alpine/git"}},
+						Containers: []ContainerConfiguration{
+							{
+								Image:           "golang:1.11",
+								SecurityContext: &v1.SecurityContext{Privileged: &privileged},
+								Env:             []v1.EnvVar{{Name: "CI", Value: "true"}, secretEnv},
+							},
+						},
+						Services: []ServiceConfiguration{
+							{Name: "db", ContainerConfiguration: ContainerConfiguration{Image: "quay.io/example/postgres"}},
+						},
+					},
+					{
+						Skip:       true,
+						Containers: []ContainerConfiguration{{Image: "example/deploy"}},
+					},
+				},
+			},
+		},
+	}
+
+	err := CheckPolicy(c, Policy{Images: []string{"golang:*"}}, nil)
+	violations, ok := err.(PolicyViolations)
+	if !ok {
+		t.Fatalf("expected policy violations but got %v", err)
+	}
+
+	expected := []string{
+		"stages[0].steps[0](build).serviceAccountName",
+		"stages[0].steps[0](build).volumes[1]",
+		"stages[0].steps[0](build).volumes[2]",
+		"stages[0].steps[0](build).volumes[2].secret.secretName",
+		"stages[0].steps[0](build).initContainers[0].image",
+		"stages[0].steps[0](build).containers[0].securityContext.privileged",
+		"stages[0].steps[0](build).containers[0].env[1]",
+		"stages[0].steps[0](build).services[0].image",
+	}
+
+	if len(violations) != len(expected) {
+		t.Fatalf("expected %v violations but got %v", len(expected), violations)
+	}
+	for i, path := range expected {
+		if violations[i].Path != path {
+			t.Fatalf("expected violation %v at %v but got %v", i, path, violations[i])
+		}
+	}
+
+	err = CheckPolicy(c, Policy{
+		Images:          []string{"golang:*", "alpine/*", "quay.io/example/*"},
+		ServiceAccounts: []string{"deployer"},
+		Secrets:         []string{"deploy-token"},
+		VolumeTypes:     []string{"hostPath", "secret"},
+		Privileged:      true,
+	}, nil)
+	if err != nil {
+		t.Fatalf("expected configuration to comply with policy but got %v", err)
+	}
+}
+
+func TestCheckPolicySecurityContext(t *testing.T) {
+	escalate := true
+	root := int64(0)
+
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{
+				Steps: []StepConfiguration{
+					{
+						Containers: []ContainerConfiguration{
+							{
+								Image: "golang",
+								SecurityContext: &v1.SecurityContext{
+									AllowPrivilegeEscalation: &escalate,
+									RunAsUser:                &root,
+									SELinuxOptions:           &v1.SELinuxOptions{Type: "spc_t"},
+									Capabilities: &v1.Capabilities{
+										Add: []v1.Capability{"NET_ADMIN", "SYS_ADMIN"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	err := CheckPolicy(c, Policy{Images: []string{"*"}, Capabilities: []string{"NET_ADMIN"}}, nil)
+	violations, ok := err.(PolicyViolations)
+	if !ok {
+		t.Fatalf("expected policy violations but got %v", err)
+	}
+
+	expected := []string{
+		"stages[0].steps[0].containers[0].securityContext.allowPrivilegeEscalation",
+		"stages[0].steps[0].containers[0].securityContext.runAsUser",
+		"stages[0].steps[0].containers[0].securityContext.seLinuxOptions",
+		"stages[0].steps[0].containers[0].securityContext.capabilities.add[1]",
+	}
+
+	if len(violations) != len(expected) {
+		t.Fatalf("expected %v violations but got %v", len(expected), violations)
+	}
+	for i, path := range expected {
+		if violations[i].Path != path {
+			t.Fatalf("expected violation %v at %v but got %v", i, path, violations[i])
+		}
+	}
+
+	err = CheckPolicy(c, Policy{Images: []string{"*"}, Privileged: true}, nil)
+	if err != nil {
+		t.Fatalf("expected privileged policy to allow everything but got %v", err)
+	}
+}
+
+func TestCheckPolicyClusters(t *testing.T) {
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{
+				Steps: []StepConfiguration{
+					{Name: "default", Containers: []ContainerConfiguration{{Image: "golang"}}},
+					{Name: "gpu", Cluster: "gpu", Containers: []ContainerConfiguration{{Image: "golang"}}},
+					{Name: "arm", ClusterSelector: map[string]string{"arch": "arm64"}, Containers: []ContainerConfiguration{{Image: "golang"}}},
+				},
+			},
+		},
+	}
+
+	clusterLabels := map[string]map[string]string{
+		"default":   {"arch": "amd64"},
+		"gpu":       {"arch": "amd64"},
+		"arm":       {"arch": "arm64"},
+		"arm-spare": {"arch": "arm64"},
+	}
+
+	err := CheckPolicy(c, Policy{Images: []string{"*"}, Clusters: []string{"arm"}}, clusterLabels)
+	violations, ok := err.(PolicyViolations)
+	if !ok {
+		t.Fatalf("expected policy violations but got %v", err)
+	}
+
+	expected := []string{
+		"stages[0].steps[1](gpu).cluster",
+		"stages[0].steps[2](arm).clusterSelector",
+	}
+
+	if len(violations) != len(expected) {
+		t.Fatalf("expected %v violations but got %v", len(expected), violations)
+	}
+	for i, path := range expected {
+		if violations[i].Path != path {
+			t.Fatalf("expected violation %v at %v but got %v", i, path, violations[i])
+		}
+	}
+
+	err = CheckPolicy(c, Policy{Images: []string{"*"}, Clusters: []string{"gpu", "arm", "arm-spare"}}, clusterLabels)
+	if err != nil {
+		t.Fatalf("expected configuration to comply with policy but got %v", err)
+	}
+}
+
+func TestCheckPolicyProjectedSecrets(t *testing.T) {
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{
+				Steps: []StepConfiguration{
+					{
+						Containers: []ContainerConfiguration{{Image: "golang"}},
+						Volumes: []v1.Volume{
+							{
+								Name: "credentials",
+								VolumeSource: v1.VolumeSource{
+									Projected: &v1.ProjectedVolumeSource{
+										Sources: []v1.VolumeProjection{
+											{Secret: &v1.SecretProjection{LocalObjectReference: v1.LocalObjectReference{Name: "deploy-token"}}},
+											{Secret: &v1.SecretProjection{LocalObjectReference: v1.LocalObjectReference{Name: "server-credentials"}}},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	policy := Policy{Images: []string{"*"}, VolumeTypes: []string{"projected"}, Secrets: []string{"deploy-token"}}
+
+	err := CheckPolicy(c, policy, nil)
+	violations, ok := err.(PolicyViolations)
+	if !ok {
+		t.Fatalf("expected policy violations but got %v", err)
+	}
+	if len(violations) != 1 || violations[0].Path != "stages[0].steps[0].volumes[0].projected.sources[1].secret.name" {
+		t.Fatalf("expected projected secret server-credentials to be rejected but got %v", violations)
+	}
+
+	policy.Secrets = append(policy.Secrets, "server-credentials")
+	err = CheckPolicy(c, policy, nil)
+	if err != nil {
+		t.Fatalf("expected configuration to comply with policy but got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/api/core/v1"
+)
+
+// ApplyResourceDefaults sets the given default requests and limits on all
+// containers of the configuration not specifying them for the respective
+// resource themselves.
+func ApplyResourceDefaults(c ExecutionConfiguration, defaults v1.ResourceRequirements) ExecutionConfiguration {
+	forEachContainer(&c, func(container *ContainerConfiguration) {
+		container.Resources = applyResourceDefaults(container.Resources, defaults)
+	})
+
+	return c
+}
+
+func applyResourceDefaults(r v1.ResourceRequirements, defaults v1.ResourceRequirements) v1.ResourceRequirements {
+	for name, quantity := range defaults.Limits {
+		if _, ok := r.Limits[name]; ok {
+			continue
+		}
+
+		// A default limit below the request of the container would render
+		// the container invalid.
+		if request, ok := r.Requests[name]; ok && request.Cmp(quantity) > 0 {
+			quantity = request
+		}
+
+		if r.Limits == nil {
+			r.Limits = v1.ResourceList{}
+		}
+		r.Limits[name] = quantity
+	}
+
+	for name, quantity := range defaults.Requests {
+		if _, ok := r.Requests[name]; ok {
+			continue
+		}
+
+		// Kubernetes defaults the request to the limit if only the latter is
+		// set.
+		if _, ok := r.Limits[name]; ok {
+			continue
+		}
+
+		if r.Requests == nil {
+			r.Requests = v1.ResourceList{}
+		}
+		r.Requests[name] = quantity
+	}
+
+	return r
+}
+
+// CheckResourceMaximum returns an error listing every container of the
+// configuration requesting or being limited to more than the given maximum.
+func CheckResourceMaximum(c ExecutionConfiguration, max v1.ResourceList) error {
+	violations := []string{}
+
+	forEachContainer(&c, func(container *ContainerConfiguration) {
+		for _, list := range []v1.ResourceList{container.Resources.Requests, container.Resources.Limits} {
+			for name, quantity := range list {
+				maxQuantity, ok := max[name]
+				if !ok || quantity.Cmp(maxQuantity) <= 0 {
+					continue
+				}
+
+				violations = append(violations, fmt.Sprintf(
+					"container with image %v: %v of %v exceeds maximum of %v",
+					container.Image,
+					name,
+					quantity.String(),
+					maxQuantity.String(),
+				))
+			}
+		}
+	})
+
+	if len(violations) != 0 {
+		return fmt.Errorf("resources exceed maximum:\n%v", strings.Join(violations, "\n"))
+	}
+
+	return nil
+}
+
+// forEachContainer calls f with every init container, container and service of
+// the steps of the configuration.
+func forEachContainer(c *ExecutionConfiguration, f func(*ContainerConfiguration)) {
+	for stageI := range c.Stages {
+		for stepI := range c.Stages[stageI].Steps {
+			step := &c.Stages[stageI].Steps[stepI]
+			for i := range step.InitContainers {
+				f(&step.InitContainers[i])
+			}
+			for i := range step.Containers {
+				f(&step.Containers[i])
+			}
+			for i := range step.Services {
+				f(&step.Services[i].ContainerConfiguration)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package executor
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestApplyResourceDefaults(t *testing.T) {
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{
+				Steps: []StepConfiguration{
+					{
+						Containers: []ContainerConfiguration{
+							{
+								Resources: v1.ResourceRequirements{
+									Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("4Gi")},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	defaults := v1.ResourceRequirements{
+		Requests: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("100m"),
+			v1.ResourceMemory: resource.MustParse("256Mi"),
+		},
+		Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("2Gi")},
+	}
+
+	c = ApplyResourceDefaults(c, defaults)
+	r := c.Stages[0].Steps[0].Containers[0].Resources
+
+	if cpu := r.Requests[v1.ResourceCPU]; cpu.String() != "100m" {
+		t.Fatalf("expected default cpu request 100m but got %v", cpu.String())
+	}
+
+	if memory := r.Requests[v1.ResourceMemory]; memory.String() != "4Gi" {
+		t.Fatalf("expected configured memory request 4Gi to stay but got %v", memory.String())
+	}
+
+	if memory := r.Limits[v1.ResourceMemory]; memory.String() != "4Gi" {
+		t.Fatalf("expected memory limit to be raised to request 4Gi but got %v", memory.String())
+	}
+}
+
+func TestCheckResourceMaximum(t *testing.T) {
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{
+				Steps: []StepConfiguration{
+					{
+						InitContainers: []ContainerConfiguration{
+							{
+								Resources: v1.ResourceRequirements{
+									Limits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("8")},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	max := v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}
+
+	if err := CheckResourceMaximum(c, max); err == nil {
+		t.Fatal("expected cpu limit above maximum to be rejected")
+	}
+
+	max[v1.ResourceCPU] = resource.MustParse("8")
+
+	if err := CheckResourceMaximum(c, max); err != nil {
+		t.Fatalf("expected cpu limit equal to maximum to be accepted but got %v", err)
+	}
+}
+
+func TestResourcesOfServices(t *testing.T) {
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{
+			{
+				Steps: []StepConfiguration{
+					{
+						Services: []ServiceConfiguration{
+							{
+								Name: "postgres",
+								ContainerConfiguration: ContainerConfiguration{
+									Image: "postgres",
+									Resources: v1.ResourceRequirements{
+										Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("16Gi")},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	max := v1.ResourceList{v1.ResourceMemory: resource.MustParse("8Gi")}
+
+	if err := CheckResourceMaximum(c, max); err == nil {
+		t.Fatal("expected memory limit of service above maximum to be rejected")
+	}
+
+	defaults := v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+	}
+
+	c = ApplyResourceDefaults(c, defaults)
+	r := c.Stages[0].Steps[0].Services[0].Resources
+
+	if cpu := r.Requests[v1.ResourceCPU]; cpu.String() != "100m" {
+		t.Fatalf("expected default cpu request 100m of service but got %v", cpu.String())
+	}
+}
@@ -0,0 +1,146 @@
+package executor
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// customSchemas are the schemas of types decoding themselves from JSON.
+var customSchemas = map[reflect.Type]map[string]interface{}{
+	reflect.TypeOf(resource.Quantity{}): {
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "number"},
+		},
+	},
+	reflect.TypeOf(intstr.IntOrString{}): {
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "integer"},
+		},
+	},
+	reflect.TypeOf(metav1.Time{}): {
+		"type":   "string",
+		"format": "date-time",
+	},
+}
+
+// JSONSchema returns a JSON Schema of automation-config.yaml, derived from
+// ExecutionConfiguration, to be used by editors for autocompletion and
+// validation.
+func JSONSchema() ([]byte, error) {
+	g := schemaGenerator{definitions: map[string]interface{}{}}
+
+	schema := g.schemaOf(reflect.TypeOf(ExecutionConfiguration{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "automation-config.yaml"
+	schema["definitions"] = g.definitions
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+type schemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if schema, ok := customSchemas[t]; ok {
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return g.structSchema(t)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+
+	return map[string]interface{}{}
+}
+
+// structSchema returns a reference to the definition of the given struct,
+// adding the definition first if needed. The top-level configuration is
+// inlined instead.
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	name := t.String()
+	ref := map[string]interface{}{"$ref": "#/definitions/" + name}
+
+	if _, ok := g.definitions[name]; ok {
+		return ref
+	}
+
+	// Reserve the definition to terminate on recursive types.
+	g.definitions[name] = map[string]interface{}{}
+
+	properties := map[string]interface{}{}
+	g.addProperties(t, properties)
+
+	definition := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+
+	if t == reflect.TypeOf(ExecutionConfiguration{}) {
+		delete(g.definitions, name)
+		return definition
+	}
+
+	g.definitions[name] = definition
+	return ref
+}
+
+// addProperties adds the fields of the given struct by the name they have in a
+// configuration file, flattening embedded structs.
+func (g *schemaGenerator) addProperties(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		jsonTag := f.Tag.Get("json")
+		if jsonTag == "-" {
+			continue
+		}
+
+		name := strings.Split(jsonTag, ",")[0]
+		if name == "" && f.Tag.Get("yaml") != "" {
+			name = strings.Split(f.Tag.Get("yaml"), ",")[0]
+		}
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.addProperties(f.Type, properties)
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		properties[name] = g.schemaOf(f.Type)
+	}
+}
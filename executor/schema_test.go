@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+func TestJSONSchemaIsUpToDate(t *testing.T) {
+	schema, err := JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published, err := ioutil.ReadFile("../automation-config.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(published) != string(schema)+"\n" {
+		t.Fatal("expected automation-config.schema.json to be up to date, regenerate it via 'automation schema > automation-config.schema.json'")
+	}
+}
+
+func TestJSONSchemaProperties(t *testing.T) {
+	raw, err := JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Properties  map[string]interface{} `json:"properties"`
+		Definitions map[string]struct {
+			Properties           map[string]interface{} `json:"properties"`
+			AdditionalProperties bool                   `json:"additionalProperties"`
+		} `json:"definitions"`
+	}
+	err = json.Unmarshal(raw, &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, property := range []string{"variables", "templates", "stages"} {
+		if _, ok := schema.Properties[property]; !ok {
+			t.Fatalf("expected top-level property %v", property)
+		}
+	}
+
+	tests := []struct {
+		definition string
+		properties []string
+	}{
+		{"executor.StepConfiguration", []string{"name", "dependsOn", "initContainers", "containers", "volumes", "services", "matrix", "when"}},
+		// Fields of the embedded container configuration are inlined.
+		{"executor.ServiceConfiguration", []string{"name", "image", "command", "readinessCheck"}},
+		{"v1.EnvVar", []string{"name", "value", "valueFrom"}},
+		{"v1.Volume", []string{"name", "emptyDir", "hostPath", "secret"}},
+		{"v1.SecurityContext", []string{"privileged", "runAsUser", "capabilities"}},
+	}
+
+	for _, test := range tests {
+		definition, ok := schema.Definitions[test.definition]
+		if !ok {
+			t.Fatalf("expected definition %v", test.definition)
+		}
+
+		for _, property := range test.properties {
+			if _, ok := definition.Properties[property]; !ok {
+				t.Fatalf("expected %v to have property %v", test.definition, property)
+			}
+		}
+	}
+
+	if _, ok := schema.Definitions["executor.StepConfiguration"].Properties["skip"]; ok {
+		t.Fatal("expected internal field skip not to be part of the schema")
+	}
+}
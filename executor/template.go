@@ -0,0 +1,174 @@
+package executor
+
+import (
+	"fmt"
+	"reflect"
+
+	"k8s.io/api/core/v1"
+)
+
+// ApplyTemplates fills all fields not set on a step extending a template with
+// the values of the template. Templates can not extend other templates.
+func ApplyTemplates(c ExecutionConfiguration) (ExecutionConfiguration, error) {
+	for name, template := range c.Templates {
+		if template.Extends != "" {
+			return c, fmt.Errorf("template %v can not extend another template", name)
+		}
+	}
+
+	for stageI, stage := range c.Stages {
+		for stepI, step := range stage.Steps {
+			if step.Extends == "" {
+				continue
+			}
+
+			template, ok := c.Templates[step.Extends]
+			if !ok {
+				return c, fmt.Errorf("step %v extends unknown template %v", step.Name, step.Extends)
+			}
+
+			c.Stages[stageI].Steps[stepI] = extendTemplate(template, step)
+		}
+	}
+
+	return c, nil
+}
+
+// extendTemplate overrides each field of the template set on the step. The
+// template is copied first, as later passes modify steps in place and
+// several steps can extend the same template.
+func extendTemplate(template StepConfiguration, step StepConfiguration) StepConfiguration {
+	result := copyStep(template)
+	resultValue := reflect.ValueOf(&result).Elem()
+	stepValue := reflect.ValueOf(step)
+
+	for i := 0; i < stepValue.NumField(); i++ {
+		if !stepValue.Field(i).IsZero() {
+			resultValue.Field(i).Set(stepValue.Field(i))
+		}
+	}
+
+	return result
+}
+
+// copyStep returns a copy of the given step sharing no slices, maps or
+// pointers with it.
+func copyStep(s StepConfiguration) StepConfiguration {
+	c := s
+
+	c.DependsOn = copyStrings(s.DependsOn)
+	if s.When != nil {
+		when := *s.When
+		c.When = &when
+	}
+	if s.Matrix != nil {
+		c.Matrix = s.Matrix.copy()
+	}
+	c.InitContainers = copyContainers(s.InitContainers)
+	c.Containers = copyContainers(s.Containers)
+	if s.Volumes != nil {
+		c.Volumes = []v1.Volume{}
+		for _, v := range s.Volumes {
+			c.Volumes = append(c.Volumes, *v.DeepCopy())
+		}
+	}
+	c.NodeSelector = copyStringMap(s.NodeSelector)
+	if s.Tolerations != nil {
+		c.Tolerations = []v1.Toleration{}
+		for _, t := range s.Tolerations {
+			c.Tolerations = append(c.Tolerations, *t.DeepCopy())
+		}
+	}
+	if s.Affinity != nil {
+		c.Affinity = s.Affinity.DeepCopy()
+	}
+	if s.Services != nil {
+		c.Services = []ServiceConfiguration{}
+		for _, service := range s.Services {
+			service.ContainerConfiguration = copyContainer(service.ContainerConfiguration)
+			c.Services = append(c.Services, service)
+		}
+	}
+	c.ClusterSelector = copyStringMap(s.ClusterSelector)
+	c.Artifacts = copyStrings(s.Artifacts)
+	if s.Caches != nil {
+		c.Caches = append([]CacheConfiguration{}, s.Caches...)
+	}
+	if s.TestReports != nil {
+		c.TestReports = append([]TestReportConfiguration{}, s.TestReports...)
+	}
+
+	return c
+}
+
+func copyContainers(containers []ContainerConfiguration) []ContainerConfiguration {
+	if containers == nil {
+		return nil
+	}
+
+	copied := []ContainerConfiguration{}
+	for _, c := range containers {
+		copied = append(copied, copyContainer(c))
+	}
+	return copied
+}
+
+func copyContainer(c ContainerConfiguration) ContainerConfiguration {
+	copied := c
+
+	copied.Entrypoint = copyStrings(c.Entrypoint)
+	copied.Args = copyStrings(c.Args)
+	if c.Env != nil {
+		copied.Env = []v1.EnvVar{}
+		for _, e := range c.Env {
+			copied.Env = append(copied.Env, *e.DeepCopy())
+		}
+	}
+	if c.VolumeMounts != nil {
+		copied.VolumeMounts = append([]VolumeMount{}, c.VolumeMounts...)
+	}
+	if c.SecurityContext != nil {
+		copied.SecurityContext = c.SecurityContext.DeepCopy()
+	}
+	copied.Resources = *c.Resources.DeepCopy()
+
+	return copied
+}
+
+func (m *Matrix) copy() *Matrix {
+	copied := &Matrix{}
+
+	if m.Axes != nil {
+		copied.Axes = map[string][]string{}
+		for axis, values := range m.Axes {
+			copied.Axes[axis] = copyStrings(values)
+		}
+	}
+	for _, include := range m.Include {
+		copied.Include = append(copied.Include, copyStringMap(include))
+	}
+	for _, exclude := range m.Exclude {
+		copied.Exclude = append(copied.Exclude, copyStringMap(exclude))
+	}
+
+	return copied
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	copied := map[string]string{}
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,72 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeExecutionConfigurationTemplates(t *testing.T) {
+	rawConfig := `
+templates:
+  go:
+    serviceAccountName: automation
+    volumes:
+      - name: repository
+        emptyDir: {}
+    containers:
+      - image: golang
+        command: go test ./...
+stages:
+  - steps:
+      - name: test
+        extends: go
+      - name: build
+        extends: go
+        containers:
+          - image: golang
+            command: go build
+`
+
+	c, err := DecodeExecutionConfiguration(strings.NewReader(rawConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test := c.Stages[0].Steps[0]
+	build := c.Stages[0].Steps[1]
+
+	if test.Name != "test" || test.ServiceAccountName != "automation" || len(test.Volumes) != 1 {
+		t.Fatalf("expected test step to inherit all fields of the template but got %+v", test)
+	}
+
+	if test.Containers[0].Command != "go test ./..." {
+		t.Fatalf("expected test step to inherit containers but got %v", test.Containers[0].Command)
+	}
+
+	if build.Containers[0].Command != "go build" || build.ServiceAccountName != "automation" {
+		t.Fatalf("expected build step to override only its containers but got %+v", build)
+	}
+}
+
+func TestApplyTemplatesUnknownTemplate(t *testing.T) {
+	c := ExecutionConfiguration{
+		Stages: []StageConfiguration{{Steps: []StepConfiguration{{Extends: "unknown"}}}},
+	}
+
+	if _, err := ApplyTemplates(c); err == nil {
+		t.Fatal("expected step extending unknown template to fail")
+	}
+}
+
+func TestApplyTemplatesNoNesting(t *testing.T) {
+	c := ExecutionConfiguration{
+		Templates: map[string]StepConfiguration{
+			"base": {},
+			"go":   {Extends: "base"},
+		},
+	}
+
+	if _, err := ApplyTemplates(c); err == nil {
+		t.Fatal("expected template extending another template to fail")
+	}
+}
@@ -0,0 +1,318 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TestReportFormatJUnit      = "junit"
+	TestReportFormatGoTestJSON = "go-test-json"
+)
+
+var TestReportFormats = []string{TestReportFormatJUnit, TestReportFormatGoTestJSON}
+
+type TestState string
+
+var (
+	TestStatePassed  TestState = "passed"
+	TestStateFailed  TestState = "failed"
+	TestStateSkipped TestState = "skipped"
+)
+
+type TestSuiteResult struct {
+	Name     string
+	Duration time.Duration
+	Cases    []TestCaseResult
+}
+
+// Failed returns the cases of the suite which failed.
+func (r *TestSuiteResult) Failed() []TestCaseResult {
+	failed := []TestCaseResult{}
+	for _, c := range r.Cases {
+		if c.State == TestStateFailed {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+type TestCaseResult struct {
+	Name string
+	// ClassName groups cases within a suite, e.g. by class in Java. It
+	// is empty for Go tests.
+	ClassName string
+	State     TestState
+	Duration  time.Duration
+	// Message describes the failure of a failed case.
+	Message string
+}
+
+// CountTestCases returns the number of passed, failed and skipped cases of the
+// given suites.
+func CountTestCases(suites []TestSuiteResult) (int, int, int) {
+	passed, failed, skipped := 0, 0, 0
+	for _, s := range suites {
+		for _, c := range s.Cases {
+			switch c.State {
+			case TestStatePassed:
+				passed++
+			case TestStateFailed:
+				failed++
+			case TestStateSkipped:
+				skipped++
+			}
+		}
+	}
+	return passed, failed, skipped
+}
+
+// ParseTestReports parses the given reports of a step. Reports with a path are
+// looked up in files by their index, reports without a path are parsed from
+// the output of the step. Missing files are skipped, as a failing step might
+// not get to write its report. Invalid reports are skipped as well, and
+// returned as an error next to the results of all other reports.
+func ParseTestReports(reports []TestReportConfiguration, output string, files map[int]string) ([]TestSuiteResult, error) {
+	suites := []TestSuiteResult{}
+	errs := []string{}
+
+	for i, report := range reports {
+		content := output
+		if report.Path != "" {
+			var ok bool
+			content, ok = files[i]
+			if !ok {
+				continue
+			}
+		}
+
+		var parsed []TestSuiteResult
+		var err error
+		switch report.Format {
+		case TestReportFormatJUnit:
+			parsed, err = ParseJUnit(strings.NewReader(content))
+		case TestReportFormatGoTestJSON:
+			parsed, err = ParseGoTestJSON(strings.NewReader(content))
+		default:
+			err = fmt.Errorf("unknown format %q", report.Format)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("test report %v: %v", i, err))
+			continue
+		}
+
+		suites = append(suites, parsed...)
+	}
+
+	if len(errs) != 0 {
+		return suites, fmt.Errorf("%v", strings.Join(errs, "; "))
+	}
+	return suites, nil
+}
+
+type junitTestSuite struct {
+	Name   string           `xml:"name,attr"`
+	Time   string           `xml:"time,attr"`
+	Cases  []junitTestCase  `xml:"testcase"`
+	Suites []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	Error     *junitFailure `xml:"error"`
+	Skipped   *struct{}     `xml:"skipped"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// ParseJUnit parses a JUnit XML report, with either a testsuites or a single
+// testsuite root element. Nested suites are flattened.
+func ParseJUnit(r io.Reader) ([]TestSuiteResult, error) {
+	decoder := xml.NewDecoder(r)
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		root := junitTestSuite{}
+		err = decoder.DecodeElement(&root, &start)
+		if err != nil {
+			return nil, err
+		}
+
+		switch start.Name.Local {
+		case "testsuites":
+			return junitSuitesToResults(root.Suites), nil
+		case "testsuite":
+			return junitSuitesToResults([]junitTestSuite{root}), nil
+		default:
+			return nil, fmt.Errorf("unexpected root element %v", start.Name.Local)
+		}
+	}
+}
+
+func junitSuitesToResults(suites []junitTestSuite) []TestSuiteResult {
+	results := []TestSuiteResult{}
+
+	for _, s := range suites {
+		result := TestSuiteResult{
+			Name:     s.Name,
+			Duration: parseSeconds(s.Time),
+			Cases:    []TestCaseResult{},
+		}
+
+		for _, c := range s.Cases {
+			caseResult := TestCaseResult{
+				Name:      c.Name,
+				ClassName: c.ClassName,
+				State:     TestStatePassed,
+				Duration:  parseSeconds(c.Time),
+			}
+
+			failure := c.Failure
+			if failure == nil {
+				failure = c.Error
+			}
+
+			switch {
+			case failure != nil:
+				caseResult.State = TestStateFailed
+				caseResult.Message = failure.Message
+				if caseResult.Message == "" {
+					caseResult.Message = strings.TrimSpace(failure.Text)
+				}
+			case c.Skipped != nil:
+				caseResult.State = TestStateSkipped
+			}
+
+			result.Cases = append(result.Cases, caseResult)
+		}
+
+		if len(result.Cases) != 0 {
+			results = append(results, result)
+		}
+		results = append(results, junitSuitesToResults(s.Suites)...)
+	}
+
+	return results
+}
+
+// parseSeconds parses durations like "1.5", returning 0 for invalid ones.
+func parseSeconds(s string) time.Duration {
+	seconds, err := strconv.ParseFloat(strings.Replace(s, ",", "", -1), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// goTestEvent is a line of the output of "go test -json", see "go doc
+// test2json".
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// ParseGoTestJSON parses the output of "go test -json" into one suite per
+// package. Lines which are no test events, e.g. the output of other commands,
+// are ignored. The message of a failed test is its output without the status
+// lines of go test.
+func ParseGoTestJSON(r io.Reader) ([]TestSuiteResult, error) {
+	suites := []*TestSuiteResult{}
+	suitesByPackage := map[string]*TestSuiteResult{}
+	outputs := map[string]map[string]string{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		event := goTestEvent{}
+		if json.Unmarshal([]byte(line), &event) != nil || event.Action == "" || event.Package == "" {
+			continue
+		}
+
+		suite, ok := suitesByPackage[event.Package]
+		if !ok {
+			suite = &TestSuiteResult{Name: event.Package, Cases: []TestCaseResult{}}
+			suitesByPackage[event.Package] = suite
+			suites = append(suites, suite)
+			outputs[event.Package] = map[string]string{}
+		}
+
+		if event.Test == "" {
+			if event.Action == "pass" || event.Action == "fail" {
+				suite.Duration = secondsToDuration(event.Elapsed)
+			}
+			continue
+		}
+
+		switch event.Action {
+		case "output":
+			outputs[event.Package][event.Test] = outputs[event.Package][event.Test] + event.Output
+		case "pass", "fail", "skip":
+			c := TestCaseResult{
+				Name:     event.Test,
+				State:    map[string]TestState{"pass": TestStatePassed, "fail": TestStateFailed, "skip": TestStateSkipped}[event.Action],
+				Duration: secondsToDuration(event.Elapsed),
+			}
+			if c.State == TestStateFailed {
+				c.Message = goTestFailureMessage(outputs[event.Package][event.Test])
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	results := []TestSuiteResult{}
+	for _, s := range suites {
+		if len(s.Cases) != 0 {
+			results = append(results, *s)
+		}
+	}
+	return results, nil
+}
+
+func goTestFailureMessage(output string) string {
+	lines := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- ") {
+			continue
+		}
+		lines = append(lines, trimmed)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
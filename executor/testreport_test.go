@@ -0,0 +1,132 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJUnit(t *testing.T) {
+	report := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="com.example.ParserTest" time="1.5">
+    <testcase name="parsesEmpty" classname="com.example.ParserTest" time="0.5"/>
+    <testcase name="parsesNested" classname="com.example.ParserTest" time="1">
+      <failure message="expected 2 but got 3">stack trace</failure>
+    </testcase>
+    <testcase name="parsesUnicode" classname="com.example.ParserTest">
+      <skipped/>
+    </testcase>
+  </testsuite>
+  <testsuite name="com.example.LexerTest">
+    <testcase name="lexes" classname="com.example.LexerTest">
+      <error>java.lang.NullPointerException</error>
+    </testcase>
+  </testsuite>
+</testsuites>`
+
+	suites, err := ParseJUnit(strings.NewReader(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(suites) != 2 || suites[0].Name != "com.example.ParserTest" || suites[0].Duration != 1500*time.Millisecond {
+		t.Fatalf("expected two suites but got %+v", suites)
+	}
+
+	cases := suites[0].Cases
+	if cases[0].State != TestStatePassed || cases[1].State != TestStateFailed || cases[2].State != TestStateSkipped {
+		t.Fatalf("expected passed, failed and skipped case but got %+v", cases)
+	}
+	if cases[1].Message != "expected 2 but got 3" || cases[1].Duration != time.Second {
+		t.Fatalf("expected failure message and duration but got %+v", cases[1])
+	}
+
+	failed := suites[1].Failed()
+	if len(failed) != 1 || failed[0].Message != "java.lang.NullPointerException" {
+		t.Fatalf("expected errors to be failures with their text as message but got %+v", failed)
+	}
+
+	passed, failedCount, skipped := CountTestCases(suites)
+	if passed != 1 || failedCount != 2 || skipped != 1 {
+		t.Fatalf("expected 1 passed, 2 failed and 1 skipped case but got %v, %v and %v", passed, failedCount, skipped)
+	}
+}
+
+func TestParseJUnitSingleSuite(t *testing.T) {
+	suites, err := ParseJUnit(strings.NewReader(`<testsuite name="pytest"><testcase name="test_a"/></testsuite>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(suites) != 1 || len(suites[0].Cases) != 1 {
+		t.Fatalf("expected one suite with one case but got %+v", suites)
+	}
+
+	_, err = ParseJUnit(strings.NewReader(`<html></html>`))
+	if err == nil {
+		t.Fatal("expected unknown root element to fail")
+	}
+}
+
+func TestParseGoTestJSON(t *testing.T) {
+	output := `+ go test -json ./...
+{"Action":"run","Package":"github.com/mxinden/automation/executor","Test":"TestA"}
+{"Action":"output","Package":"github.com/mxinden/automation/executor","Test":"TestA","Output":"=== RUN   TestA\n"}
+{"Action":"pass","Package":"github.com/mxinden/automation/executor","Test":"TestA","Elapsed":0.5}
+{"Action":"run","Package":"github.com/mxinden/automation/executor","Test":"TestB"}
+{"Action":"output","Package":"github.com/mxinden/automation/executor","Test":"TestB","Output":"=== RUN   TestB\n"}
+{"Action":"output","Package":"github.com/mxinden/automation/executor","Test":"TestB","Output":"    execution_test.go:12: expected 1 but got 2\n"}
+{"Action":"output","Package":"github.com/mxinden/automation/executor","Test":"TestB","Output":"--- FAIL: TestB (0.00s)\n"}
+{"Action":"fail","Package":"github.com/mxinden/automation/executor","Test":"TestB","Elapsed":0}
+{"Action":"fail","Package":"github.com/mxinden/automation/executor","Elapsed":1.25}
+{"Action":"skip","Package":"github.com/mxinden/automation/configuration","Elapsed":0}
+{"Action":"skip","Package":"github.com/mxinden/automation/cache","Test":"TestC","Elapsed":0}
+`
+
+	suites, err := ParseGoTestJSON(strings.NewReader(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(suites) != 2 {
+		t.Fatalf("expected suites of packages with tests only but got %+v", suites)
+	}
+
+	executor := suites[0]
+	if executor.Name != "github.com/mxinden/automation/executor" || executor.Duration != 1250*time.Millisecond || len(executor.Cases) != 2 {
+		t.Fatalf("expected executor suite with two cases but got %+v", executor)
+	}
+
+	failed := executor.Failed()
+	if len(failed) != 1 || failed[0].Name != "TestB" || failed[0].Message != "execution_test.go:12: expected 1 but got 2" {
+		t.Fatalf("expected TestB to fail with its output but got %+v", failed)
+	}
+
+	if suites[1].Cases[0].State != TestStateSkipped {
+		t.Fatalf("expected TestC to be skipped but got %+v", suites[1])
+	}
+}
+
+func TestParseTestReports(t *testing.T) {
+	reports := []TestReportConfiguration{
+		{Format: TestReportFormatGoTestJSON},
+		{Format: TestReportFormatJUnit, Path: "/src/report.xml"},
+		{Format: TestReportFormatJUnit, Path: "/src/missing.xml"},
+		{Format: TestReportFormatJUnit, Path: "/src/invalid.xml"},
+	}
+	output := `{"Action":"pass","Package":"a","Test":"TestA"}`
+	files := map[int]string{
+		1: `<testsuite name="b"><testcase name="TestB"/></testsuite>`,
+		3: `not xml`,
+	}
+
+	suites, err := ParseTestReports(reports, output, files)
+	if err == nil || !strings.Contains(err.Error(), "test report 3") {
+		t.Fatalf("expected invalid report to be reported but got %v", err)
+	}
+
+	if len(suites) != 2 || suites[0].Name != "a" || suites[1].Name != "b" {
+		t.Fatalf("expected results of the valid reports but got %+v", suites)
+	}
+}
@@ -0,0 +1,414 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+)
+
+// ValidationError is a single problem of a configuration file, located by the
+// line and column of the offending node. Line and Column are 0 if the node
+// can't be located unambiguously, leaving Path only.
+type ValidationError struct {
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Line == 0 {
+		if e.Path == "" {
+			return e.Message
+		}
+		return fmt.Sprintf("%v: %v", e.Path, e.Message)
+	}
+	return fmt.Sprintf("line %v, column %v: %v: %v", e.Line, e.Column, e.Path, e.Message)
+}
+
+// ValidationErrors are all problems of a configuration file, ordered by their
+// location.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := []string{}
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// ValidateExecutionConfiguration checks the given configuration file for
+// unknown fields, missing images and commands, conflicting command modes,
+// volume mounts of undeclared volumes and invalid step dependencies. In
+// contrast to DecodeExecutionConfiguration it reports all problems at once.
+// The returned error is of type ValidationErrors.
+func ValidateExecutionConfiguration(raw []byte) error {
+	positions := indexYAMLPositions(raw)
+	v := validator{positions: positions}
+
+	rawJSON, err := yaml.YAMLToJSON(raw)
+	if err != nil {
+		v.add("", err.Error())
+		return v.errs
+	}
+
+	var document interface{}
+	err = json.Unmarshal(rawJSON, &document)
+	if err != nil {
+		v.add("", err.Error())
+		return v.errs
+	}
+
+	v.positions.verify(document)
+
+	v.checkFields(document, reflect.TypeOf(ExecutionConfiguration{}), "")
+	if len(v.errs) != 0 {
+		return v.sorted()
+	}
+
+	c, err := DecodeExecutionConfiguration(bytes.NewReader(raw))
+	if err != nil {
+		v.add("", err.Error())
+		return v.errs
+	}
+
+	// Templates and matrices are applied on decoding. Templates don't change
+	// the location of steps, thus decode again only applying templates to
+	// validate steps at their location in the file.
+	unexpanded := ExecutionConfiguration{}
+	err = json.Unmarshal(rawJSON, &unexpanded)
+	if err == nil {
+		unexpanded, err = ApplyTemplates(unexpanded)
+	}
+	if err != nil {
+		v.add("", err.Error())
+		return v.errs
+	}
+
+	v.checkSteps(unexpanded)
+
+	_, err = NewStepGraph(c)
+	if err != nil && len(v.errs) == 0 {
+		v.add("stages", err.Error())
+	}
+
+	if len(v.errs) != 0 {
+		return v.sorted()
+	}
+
+	return nil
+}
+
+type validator struct {
+	positions yamlPositions
+	errs      ValidationErrors
+}
+
+func (v *validator) add(path string, message string) {
+	position, _ := v.positions.lookup(path)
+	v.errs = append(v.errs, ValidationError{
+		Line:    position.Line,
+		Column:  position.Column,
+		Path:    path,
+		Message: message,
+	})
+}
+
+func (v *validator) sorted() ValidationErrors {
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		if v.errs[i].Line != v.errs[j].Line {
+			return v.errs[i].Line < v.errs[j].Line
+		}
+		return v.errs[i].Column < v.errs[j].Column
+	})
+	return v.errs
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// checkFields reports all fields of the decoded document unknown to the given
+// type, following the field name rules of encoding/json.
+func (v *validator) checkFields(value interface{}, t reflect.Type, path string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Types like resource.Quantity decode themselves.
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		fields := jsonFields(t)
+		for key, fieldValue := range m {
+			fieldType, ok := fields[strings.ToLower(key)]
+			if !ok {
+				v.add(joinPath(path, key), fmt.Sprintf("unknown field %q", key))
+				continue
+			}
+			v.checkFields(fieldValue, fieldType, joinPath(path, key))
+		}
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			v.checkFields(item, t.Elem(), fmt.Sprintf("%v[%v]", path, i))
+		}
+	case reflect.Map:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for key, item := range m {
+			v.checkFields(item, t.Elem(), joinPath(path, key))
+		}
+	}
+}
+
+// jsonFields returns the types of all fields of the given struct by their
+// lower-cased JSON name, including the fields of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+
+		if tag == "-" || f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for embeddedName, embeddedType := range jsonFields(f.Type) {
+				fields[embeddedName] = embeddedType
+			}
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+
+	return fields
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (v *validator) checkSteps(c ExecutionConfiguration) {
+	names := map[string]bool{}
+	for _, stage := range c.Stages {
+		for _, step := range stage.Steps {
+			if step.Name != "" {
+				names[step.Name] = true
+			}
+		}
+	}
+
+	for stageI, stage := range c.Stages {
+		stagePath := fmt.Sprintf("stages[%v]", stageI)
+		v.checkCondition(stage.When, stagePath+".when")
+
+		for stepI, step := range stage.Steps {
+			stepPath := fmt.Sprintf("%v.steps[%v]", stagePath, stepI)
+			v.checkCondition(step.When, stepPath+".when")
+
+			if len(step.Containers) == 0 {
+				v.add(stepPath, "step needs at least one container")
+			}
+
+			volumes := map[string]bool{}
+			for _, volume := range step.Volumes {
+				volumes[volume.Name] = true
+			}
+
+			if step.Cluster != "" && len(step.ClusterSelector) != 0 {
+				v.add(joinPath(stepPath, "clusterSelector"), "\"cluster\" and \"clusterSelector\" can't be combined")
+			}
+
+			v.checkContainers(step.InitContainers, stepPath+".initContainers", volumes)
+			v.checkContainers(step.Containers, stepPath+".containers", volumes)
+
+			// Containers wait for readiness checks of services and signal
+			// their termination to the collection of artifacts and test
+			// report files and to the saving of caches within their shell.
+			if hasReadinessCheck(step.Services) || len(step.Artifacts) != 0 || len(step.Caches) != 0 || hasTestReportFiles(step.TestReports) {
+				for i, c := range step.Containers {
+					if c.Command == "" {
+						v.add(
+							fmt.Sprintf("%v.containers[%v]", stepPath, i),
+							"containers of steps with service readiness checks, artifacts, caches or test report files need a \"command\"",
+						)
+					}
+				}
+			}
+
+			for i, artifact := range step.Artifacts {
+				if !isWithinVolumeMount(artifact, step.Containers) {
+					v.add(
+						fmt.Sprintf("%v.artifacts[%v]", stepPath, i),
+						fmt.Sprintf("artifact %q is not within a volume mounted by the containers of the step", artifact),
+					)
+				}
+			}
+
+			for i, cache := range step.Caches {
+				cachePath := fmt.Sprintf("%v.caches[%v]", stepPath, i)
+				if !isWithinVolumeMount(cache.Path, step.Containers) {
+					v.add(
+						joinPath(cachePath, "path"),
+						fmt.Sprintf("cache %q is not within a volume mounted by the containers of the step", cache.Path),
+					)
+				}
+				if cache.Key == "" {
+					v.add(cachePath, "missing required field \"key\"")
+				} else if _, err := template.New("key").Funcs(cacheKeyFuncs(nil)).Parse(cache.Key); err != nil {
+					v.add(joinPath(cachePath, "key"), fmt.Sprintf("invalid key template: %v", err))
+				}
+			}
+
+			for i, report := range step.TestReports {
+				reportPath := fmt.Sprintf("%v.testReports[%v]", stepPath, i)
+				if !containsString(TestReportFormats, report.Format) {
+					v.add(
+						joinPath(reportPath, "format"),
+						fmt.Sprintf("unknown format %q, expected one of %v", report.Format, strings.Join(TestReportFormats, ", ")),
+					)
+				}
+				if report.Path == "" && report.Format == TestReportFormatJUnit {
+					v.add(reportPath, "junit reports need a \"path\"")
+				}
+				if report.Path != "" && !isWithinVolumeMount(report.Path, step.Containers) {
+					v.add(
+						joinPath(reportPath, "path"),
+						fmt.Sprintf("test report %q is not within a volume mounted by the containers of the step", report.Path),
+					)
+				}
+			}
+
+			for i, service := range step.Services {
+				servicePath := fmt.Sprintf("%v.services[%v]", stepPath, i)
+				if service.Name == "" {
+					v.add(servicePath, "missing required field \"name\"")
+				}
+				// Services without a command run the entrypoint of their
+				// image.
+				v.checkContainer(service.ContainerConfiguration, servicePath, volumes, false)
+			}
+
+			for i, dependency := range step.DependsOn {
+				if !names[dependency] {
+					v.add(fmt.Sprintf("%v.dependsOn[%v]", stepPath, i), fmt.Sprintf("unknown step %q", dependency))
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) checkContainers(containers []ContainerConfiguration, path string, volumes map[string]bool) {
+	for i, c := range containers {
+		v.checkContainer(c, fmt.Sprintf("%v[%v]", path, i), volumes, true)
+	}
+}
+
+func (v *validator) checkContainer(c ContainerConfiguration, path string, volumes map[string]bool, requireCommand bool) {
+	if c.Image == "" {
+		v.add(path, "missing required field \"image\"")
+	}
+
+	shellLess := len(c.Entrypoint) != 0 || len(c.Args) != 0
+
+	if requireCommand && c.Command == "" && !shellLess {
+		v.add(path, "missing required field \"command\", or \"entrypoint\" and \"args\"")
+	}
+
+	if c.Command != "" && shellLess {
+		v.add(path, "\"command\" runs in a shell and can't be combined with \"entrypoint\" or \"args\"")
+	}
+
+	if c.Shell != "" && c.Command == "" {
+		v.add(joinPath(path, "shell"), "\"shell\" requires a \"command\" to run")
+	}
+
+	for i, mount := range c.VolumeMounts {
+		if !volumes[mount.Name] {
+			v.add(
+				fmt.Sprintf("%v.volumeMounts[%v].name", path, i),
+				fmt.Sprintf("volume %q is not declared in the volumes of the step", mount.Name),
+			)
+		}
+	}
+}
+
+// isWithinVolumeMount returns true if the given absolute path is below the
+// mount path of a volume of any of the given containers.
+func isWithinVolumeMount(path string, containers []ContainerConfiguration) bool {
+	if !strings.HasPrefix(path, "/") {
+		return false
+	}
+
+	for _, c := range containers {
+		for _, m := range c.VolumeMounts {
+			mountPath := strings.TrimSuffix(m.MountPath, "/")
+			if strings.HasPrefix(path, mountPath+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasTestReportFiles(reports []TestReportConfiguration) bool {
+	for _, r := range reports {
+		if r.Path != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasReadinessCheck(services []ServiceConfiguration) bool {
+	for _, s := range services {
+		if s.ReadinessCheck != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validator) checkCondition(c *Condition, path string) {
+	if c == nil {
+		return
+	}
+
+	for i, event := range c.Events {
+		if !containsString([]string{EventPush, EventPullRequest, EventTag}, event) {
+			v.add(
+				fmt.Sprintf("%v.events[%v]", path, i),
+				fmt.Sprintf("unknown event %q, expected one of %v, %v, %v", event, EventPush, EventPullRequest, EventTag),
+			)
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package executor
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestValidateExecutionConfigurationUnknownFields(t *testing.T) {
+	rawConfig := `stages:
+  - steps:
+      - initContainer:
+          - image: git
+            command: git clone
+        containers:
+          - image: golang
+            command: go test
+            securityContext:
+              privileged: true
+              privilegd: true
+        skip: true
+`
+
+	err := ValidateExecutionConfiguration([]byte(rawConfig))
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors but got %v", err)
+	}
+
+	expected := []struct {
+		line   int
+		column int
+		path   string
+	}{
+		{3, 9, "stages[0].steps[0].initContainer"},
+		{11, 15, "stages[0].steps[0].containers[0].securityContext.privilegd"},
+		{12, 9, "stages[0].steps[0].skip"},
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %v errors but got %v", len(expected), errs)
+	}
+
+	for i, e := range expected {
+		if errs[i].Line != e.line || errs[i].Column != e.column || errs[i].Path != e.path {
+			t.Fatalf("expected error %v at line %v, column %v for %v but got %v", i, e.line, e.column, e.path, errs[i])
+		}
+	}
+}
+
+func TestValidateExecutionConfigurationSemantics(t *testing.T) {
+	rawConfig := `stages:
+  - steps:
+      - volumes:
+          - name: repository
+            emptyDir: {}
+        containers:
+          - image: golang
+            volumeMounts:
+              - name: repositry
+                mountPath: /go/src
+          - command: go test
+        dependsOn: ["unknown"]
+        when:
+          events: ["merge"]
+`
+
+	err := ValidateExecutionConfiguration([]byte(rawConfig))
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors but got %v", err)
+	}
+
+	expectedLines := []int{
+		7,  // missing command
+		9,  // undeclared volume
+		11, // missing image
+		12, // unknown dependency
+		14, // unknown event
+	}
+
+	if len(errs) != len(expectedLines) {
+		t.Fatalf("expected %v errors but got %v", len(expectedLines), errs)
+	}
+
+	for i, line := range expectedLines {
+		if errs[i].Line != line {
+			t.Fatalf("expected error %v on line %v but got %v", i, line, errs[i])
+		}
+	}
+}
+
+func TestValidateExecutionConfigurationCycle(t *testing.T) {
+	rawConfig := `stages:
+  - steps:
+      - name: a
+        dependsOn: ["b"]
+        containers:
+          - image: debian
+            command: "true"
+      - name: b
+        dependsOn: ["a"]
+        containers:
+          - image: debian
+            command: "true"
+`
+
+	if err := ValidateExecutionConfiguration([]byte(rawConfig)); err == nil {
+		t.Fatal("expected dependency cycle to be reported")
+	}
+}
+
+func TestValidateExecutionConfigurationOwnConfiguration(t *testing.T) {
+	rawConfig, err := ioutil.ReadFile("../automation-config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ValidateExecutionConfiguration(rawConfig)
+	if err != nil {
+		t.Fatalf("expected automation-config.yaml to be valid but got %v", err)
+	}
+}
+
+func TestValidateExecutionConfigurationCommandModes(t *testing.T) {
+	rawConfig := `stages:
+  - steps:
+      - containers:
+          - image: gcr.io/distroless/static
+            entrypoint: ["/app"]
+            args: ["--check"]
+          - image: golang
+            shell: bash -eo pipefail
+            command: go test ./... | tee report
+          - image: golang
+            command: go test
+            args: ["-v"]
+          - image: golang
+            shell: bash
+            args: ["-v"]
+      - containers:
+          - image: gcr.io/distroless/static
+            args: ["--check"]
+        services:
+          - name: postgres
+            image: postgres
+            readinessCheck: pg_isready
+`
+
+	err := ValidateExecutionConfiguration([]byte(rawConfig))
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors but got %v", err)
+	}
+
+	expectedLines := []int{
+		10, // command combined with args
+		14, // shell without command
+		17, // shell-less container waiting for service
+	}
+
+	if len(errs) != len(expectedLines) {
+		t.Fatalf("expected %v errors but got %v", len(expectedLines), errs)
+	}
+
+	for i, line := range expectedLines {
+		if errs[i].Line != line {
+			t.Fatalf("expected error %v on line %v but got %v", i, line, errs[i])
+		}
+	}
+}
+
+func TestValidateExecutionConfigurationArtifacts(t *testing.T) {
+	rawConfig := `stages:
+  - steps:
+      - volumes:
+          - name: repository
+            emptyDir: {}
+        containers:
+          - image: golang
+            command: go build -o bin/automation
+            volumeMounts:
+              - name: repository
+                mountPath: /go/src/github.com/mxinden/automation
+        artifacts:
+          - /go/src/github.com/mxinden/automation/bin/automation
+          - /tmp/coverage.out
+          - bin/automation
+`
+
+	err := ValidateExecutionConfiguration([]byte(rawConfig))
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors but got %v", err)
+	}
+
+	expectedLines := []int{
+		14, // not within a volume
+		15, // relative path
+	}
+
+	if len(errs) != len(expectedLines) {
+		t.Fatalf("expected %v errors but got %v", len(expectedLines), errs)
+	}
+
+	for i, line := range expectedLines {
+		if errs[i].Line != line {
+			t.Fatalf("expected error %v on line %v but got %v", i, line, errs[i])
+		}
+	}
+}
+
+func TestValidateExecutionConfigurationCaches(t *testing.T) {
+	rawConfig := `stages:
+  - steps:
+      - volumes:
+          - name: repository
+            emptyDir: {}
+        containers:
+          - image: golang
+            command: go build
+            volumeMounts:
+              - name: repository
+                mountPath: /go/src/github.com/mxinden/automation
+        caches:
+          - path: /go/src/github.com/mxinden/automation/vendor
+            key: 'dep-{{ checksum "Gopkg.lock" }}'
+          - path: /root/.cache/go-build
+            key: go-build
+          - path: /go/src/github.com/mxinden/automation/.cache
+          - path: /go/src/github.com/mxinden/automation/.cache
+            key: '{{ checksum "Gopkg.lock" '
+`
+
+	err := ValidateExecutionConfiguration([]byte(rawConfig))
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors but got %v", err)
+	}
+
+	expectedLines := []int{
+		15, // not within a volume
+		17, // missing key
+		19, // invalid template
+	}
+
+	if len(errs) != len(expectedLines) {
+		t.Fatalf("expected %v errors but got %v", len(expectedLines), errs)
+	}
+
+	for i, line := range expectedLines {
+		if errs[i].Line != line {
+			t.Fatalf("expected error %v on line %v but got %v", i, line, errs[i])
+		}
+	}
+}
+
+func TestValidateExecutionConfigurationTestReports(t *testing.T) {
+	rawConfig := `stages:
+  - steps:
+      - volumes:
+          - name: repository
+            emptyDir: {}
+        containers:
+          - image: golang
+            command: go test -json ./... | tee report.json
+            volumeMounts:
+              - name: repository
+                mountPath: /src
+        testReports:
+          - format: go-test-json
+          - format: go-test-json
+            path: /src/report.json
+          - format: junit
+          - format: junit
+            path: /tmp/report.xml
+          - format: tap
+            path: /src/report.tap
+`
+
+	err := ValidateExecutionConfiguration([]byte(rawConfig))
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors but got %v", err)
+	}
+
+	expectedLines := []int{
+		16, // junit without path
+		18, // not within a volume
+		19, // unknown format
+	}
+
+	if len(errs) != len(expectedLines) {
+		t.Fatalf("expected %v errors but got %v", len(expectedLines), errs)
+	}
+
+	for i, line := range expectedLines {
+		if errs[i].Line != line {
+			t.Fatalf("expected error %v on line %v but got %v", i, line, errs[i])
+		}
+	}
+}
+
+func TestValidateExecutionConfigurationCluster(t *testing.T) {
+	rawConfig := `stages:
+  - steps:
+      - cluster: arm
+        clusterSelector:
+          arch: arm64
+        containers:
+          - image: golang
+            command: go build ./...
+`
+
+	err := ValidateExecutionConfiguration([]byte(rawConfig))
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors but got %v", err)
+	}
+
+	if len(errs) != 1 || errs[0].Line != 4 {
+		t.Fatalf("expected 1 error on line 4 but got %v", errs)
+	}
+}
+
+func TestValidateExecutionConfigurationFlowStyle(t *testing.T) {
+	rawConfig := `stages:
+  - steps:
+      - containers: [{image: golang,
+                      command: "go test"},
+                     {image: golang}]
+      - containers:
+          - image: golang
+`
+
+	err := ValidateExecutionConfiguration([]byte(rawConfig))
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors but got %v", err)
+	}
+
+	expected := []struct {
+		line int
+		path string
+	}{
+		{3, "stages[0].steps[0].containers[1]"}, // missing command within flow style
+		{7, "stages[0].steps[1].containers[0]"}, // missing command
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %v errors but got %v", len(expected), errs)
+	}
+
+	for i, e := range expected {
+		if errs[i].Line != e.line || errs[i].Path != e.path {
+			t.Fatalf("expected error %v on line %v for %v but got %v", i, e.line, e.path, errs[i])
+		}
+	}
+}
+
+func TestValidateExecutionConfigurationMultiLineScalars(t *testing.T) {
+	rawConfig := `stages:
+  - steps:
+      - containers:
+          - command: "echo
+              image: not a key"
+          - image: golang
+            command: >
+              go test
+          - image: golang
+`
+
+	err := ValidateExecutionConfiguration([]byte(rawConfig))
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors but got %v", err)
+	}
+
+	expectedLines := []int{
+		4, // missing image
+		9, // missing command
+	}
+
+	if len(errs) != len(expectedLines) {
+		t.Fatalf("expected %v errors but got %v", len(expectedLines), errs)
+	}
+
+	for i, line := range expectedLines {
+		if errs[i].Line != line {
+			t.Fatalf("expected error %v on line %v but got %v", i, line, errs[i])
+		}
+	}
+}
+
+func TestValidateExecutionConfigurationMergeKeys(t *testing.T) {
+	rawConfig := `stages:
+  - steps:
+      - &test
+        name: a
+        containers:
+          - image: golang
+      - <<: *test
+        name: b
+`
+
+	err := ValidateExecutionConfiguration([]byte(rawConfig))
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors but got %v", err)
+	}
+
+	expected := []struct {
+		line int
+		path string
+	}{
+		{0, "stages[0].steps[1].containers[0]"}, // merged, thus not located
+		{6, "stages[0].steps[0].containers[0]"},
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %v errors but got %v", len(expected), errs)
+	}
+
+	for i, e := range expected {
+		if errs[i].Line != e.line || errs[i].Path != e.path {
+			t.Fatalf("expected error %v on line %v for %v but got %v", i, e.line, e.path, errs[i])
+		}
+	}
+
+	if errs[0].Error() != "stages[0].steps[1].containers[0]: "+errs[0].Message {
+		t.Fatalf("expected error without location to report its path only but got %v", errs[0])
+	}
+}
+
+func TestValidateExecutionConfigurationUnlocatable(t *testing.T) {
+	rawConfig := `stages:
+  - steps:
+      - ? containers
+        : - image: golang
+`
+
+	err := ValidateExecutionConfiguration([]byte(rawConfig))
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors but got %v", err)
+	}
+
+	if len(errs) != 1 || errs[0].Line != 0 || errs[0].Path != "stages[0].steps[0].containers[0]" {
+		t.Fatalf("expected 1 error without location but got %v", errs)
+	}
+}
@@ -0,0 +1,133 @@
+package executor
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var variableReference = regexp.MustCompile(`\$\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// ResolveVariables replaces all ${{ NAME }} references in images, commands,
+// working directories, environment variable values, volume mount paths, caches
+// and clusters by the value of the variable, or of the given context value like
+// GIT_SHA.
+// Variables can reference context values, but not other variables.
+func ResolveVariables(c ExecutionConfiguration, context map[string]string) (ExecutionConfiguration, error) {
+	values := map[string]string{}
+	for name, value := range context {
+		values[name] = value
+	}
+
+	for name, value := range c.Variables {
+		if _, ok := context[name]; ok {
+			return c, fmt.Errorf("variable %v shadows a context value", name)
+		}
+
+		resolved, err := interpolateVariables(value, context)
+		if err != nil {
+			return c, fmt.Errorf("variable %v: %v", name, err)
+		}
+		values[name] = resolved
+	}
+
+	var err error
+	forEachContainer(&c, func(container *ContainerConfiguration) {
+		if err != nil {
+			return
+		}
+		err = resolveContainerVariables(container, values)
+	})
+	if err != nil {
+		return c, err
+	}
+
+	for stageI := range c.Stages {
+		for stepI := range c.Stages[stageI].Steps {
+			step := &c.Stages[stageI].Steps[stepI]
+
+			step.ServiceAccountName, err = interpolateVariables(step.ServiceAccountName, values)
+			if err != nil {
+				return c, err
+			}
+
+			step.Cluster, err = interpolateVariables(step.Cluster, values)
+			if err != nil {
+				return c, err
+			}
+
+			for i := range step.Services {
+				err = resolveContainerVariables(&step.Services[i].ContainerConfiguration, values)
+				if err != nil {
+					return c, err
+				}
+			}
+
+			caches := []CacheConfiguration{}
+			for _, cache := range step.Caches {
+				cache.Path, err = interpolateVariables(cache.Path, values)
+				if err != nil {
+					return c, err
+				}
+				cache.Key, err = interpolateVariables(cache.Key, values)
+				if err != nil {
+					return c, err
+				}
+				caches = append(caches, cache)
+			}
+			step.Caches = caches
+		}
+	}
+
+	return c, nil
+}
+
+func resolveContainerVariables(c *ContainerConfiguration, values map[string]string) error {
+	var err error
+
+	for _, field := range []*string{&c.Image, &c.Command, &c.WorkingDir} {
+		*field, err = interpolateVariables(*field, values)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, list := range [][]string{c.Entrypoint, c.Args} {
+		for i := range list {
+			list[i], err = interpolateVariables(list[i], values)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := range c.Env {
+		c.Env[i].Value, err = interpolateVariables(c.Env[i].Value, values)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range c.VolumeMounts {
+		c.VolumeMounts[i].MountPath, err = interpolateVariables(c.VolumeMounts[i].MountPath, values)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func interpolateVariables(s string, values map[string]string) (string, error) {
+	var err error
+
+	result := variableReference.ReplaceAllStringFunc(s, func(reference string) string {
+		name := variableReference.FindStringSubmatch(reference)[1]
+		value, ok := values[name]
+		if !ok {
+			err = fmt.Errorf("unknown variable %v in %v", name, s)
+		}
+		return value
+	})
+
+	return result, err
+}
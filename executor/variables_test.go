@@ -0,0 +1,62 @@
+package executor
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestResolveVariables(t *testing.T) {
+	c := ExecutionConfiguration{
+		Variables: map[string]string{
+			"REPOSITORY_PATH": "/go/src/github.com/mxinden/automation",
+			"IMAGE":           "quay.io/mxinden/automation:${{ GIT_SHA }}",
+		},
+		Stages: []StageConfiguration{
+			{
+				Steps: []StepConfiguration{
+					{
+						Containers: []ContainerConfiguration{
+							{
+								Image:        "docker",
+								Command:      "docker build -t ${{IMAGE}} .",
+								WorkingDir:   "${{ REPOSITORY_PATH }}",
+								Env:          []v1.EnvVar{{Name: "BRANCH", Value: "${{ GIT_BRANCH_NAME }}"}},
+								VolumeMounts: []VolumeMount{{Name: "repository", MountPath: "${{ REPOSITORY_PATH }}"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	c, err := ResolveVariables(c, map[string]string{"GIT_SHA": "1234", "GIT_BRANCH_NAME": "master"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container := c.Stages[0].Steps[0].Containers[0]
+
+	if container.Command != "docker build -t quay.io/mxinden/automation:1234 ." {
+		t.Fatalf("expected variable referencing context value to be resolved but got %v", container.Command)
+	}
+
+	if container.WorkingDir != "/go/src/github.com/mxinden/automation" || container.VolumeMounts[0].MountPath != container.WorkingDir {
+		t.Fatalf("expected working dir and mount path to be resolved but got %v and %v", container.WorkingDir, container.VolumeMounts[0].MountPath)
+	}
+
+	if container.Env[0].Value != "master" {
+		t.Fatalf("expected env value to be resolved but got %v", container.Env[0].Value)
+	}
+}
+
+func TestResolveVariablesUnknownVariable(t *testing.T) {
+	c := ExecutionConfiguration{
+		Variables: map[string]string{"A": "${{ B }}"},
+	}
+
+	if _, err := ResolveVariables(c, map[string]string{}); err == nil {
+		t.Fatal("expected variable referencing another variable to fail")
+	}
+}
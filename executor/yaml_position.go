@@ -0,0 +1,307 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlPosition is the line and column of a node within a YAML document, both
+// starting at 1.
+type yamlPosition struct {
+	Line   int
+	Column int
+}
+
+// yamlPositions maps paths like "stages[0].steps[1].containers" to the
+// position of the respective node within a YAML document.
+type yamlPositions struct {
+	positions map[string]yamlPosition
+	// opaque are the paths of nodes whose children are not indexed, e.g.
+	// flow style collections like {} or [] and aliases. Their children
+	// resolve to their position.
+	opaque map[string]bool
+	// valid is false if the document uses constructs the index can't
+	// follow. No path resolves to a position then.
+	valid bool
+}
+
+// indexYAMLPositions records the positions of all mapping keys and sequence
+// items of a block style YAML document. It is a line based scanner rather than
+// a parser, thus the positions need to be verified against the parsed
+// document before they are looked up.
+func indexYAMLPositions(raw []byte) yamlPositions {
+	type node struct {
+		column int
+		path   string
+		isItem bool
+	}
+
+	p := yamlPositions{
+		positions: map[string]yamlPosition{},
+		opaque:    map[string]bool{},
+		valid:     true,
+	}
+	stack := []node{}
+	itemCounts := map[string]int{}
+	// Lines indented more than skipColumn continue the value of the
+	// previous node, e.g. a block scalar, a multi-line plain or quoted
+	// scalar or a flow collection.
+	skipColumn := -1
+	// openBrackets counts the unclosed brackets of a multi-line flow
+	// collection.
+	openBrackets := 0
+
+	for lineI, line := range strings.Split(string(raw), "\n") {
+		content := strings.TrimLeft(line, " ")
+		column := len(line) - len(content)
+
+		if openBrackets > 0 {
+			openBrackets += countFlowBrackets(content)
+			continue
+		}
+
+		if skipColumn != -1 {
+			if strings.TrimSpace(content) == "" || column > skipColumn {
+				continue
+			}
+			skipColumn = -1
+		}
+
+		content = strings.TrimRight(stripYAMLComment(content), " \t\r")
+		if content == "" || content == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(content, "\t") || content == "?" || strings.HasPrefix(content, "? ") {
+			p.valid = false
+			return p
+		}
+
+		// value is the content following the innermost node of the line,
+		// which is indexed at path.
+		value := content
+		path := ""
+
+		for content == "-" || strings.HasPrefix(content, "- ") {
+			for len(stack) != 0 {
+				top := stack[len(stack)-1]
+				if top.column > column || (top.column == column && top.isItem) {
+					stack = stack[:len(stack)-1]
+					continue
+				}
+				break
+			}
+
+			parent := ""
+			if len(stack) != 0 {
+				parent = stack[len(stack)-1].path
+			}
+
+			index := itemCounts[parent]
+			itemCounts[parent] = index + 1
+			path = parent + "[" + strconv.Itoa(index) + "]"
+
+			p.positions[path] = yamlPosition{Line: lineI + 1, Column: column + 1}
+			stack = append(stack, node{column: column, path: path, isItem: true})
+
+			rest := strings.TrimPrefix(strings.TrimPrefix(content, "-"), " ")
+			column = column + len(content) - len(rest)
+			content = strings.TrimLeft(rest, " ")
+			column = column + len(rest) - len(content)
+
+			stripped := stripYAMLProperties(content)
+			column = column + len(content) - len(stripped)
+			content = stripped
+			value = content
+		}
+
+		key, keyValue, isKey := splitYAMLKey(content)
+		if isKey && key == "<<" {
+			// The keys merged into the mapping are not indexed.
+			continue
+		}
+
+		if isKey {
+			for len(stack) != 0 && stack[len(stack)-1].column >= column {
+				stack = stack[:len(stack)-1]
+			}
+
+			path = key
+			if len(stack) != 0 {
+				path = stack[len(stack)-1].path + "." + key
+			}
+
+			p.positions[path] = yamlPosition{Line: lineI + 1, Column: column + 1}
+			stack = append(stack, node{column: column, path: path})
+			// A key appearing again, e.g. in a later document, starts
+			// counting its items anew.
+			delete(itemCounts, path)
+
+			value = stripYAMLProperties(keyValue)
+		} else if value == content && path == "" {
+			// Neither an item nor a key, e.g. a scalar document.
+			continue
+		}
+
+		switch {
+		case value == "":
+			// Nested nodes follow on the next lines.
+		case strings.HasPrefix(value, "{") || strings.HasPrefix(value, "["):
+			p.opaque[path] = true
+			openBrackets = countFlowBrackets(value)
+		case strings.HasPrefix(value, "*"):
+			p.opaque[path] = true
+		default:
+			// A scalar, possibly continued on more indented lines.
+			skipColumn = column
+		}
+	}
+
+	return p
+}
+
+// verify invalidates the index unless all indexed paths exist in the given
+// document decoded from JSON, as the scanner got lost otherwise.
+func (p *yamlPositions) verify(document interface{}) {
+	paths := map[string]bool{}
+	collectYAMLPaths(document, "", paths)
+
+	for path := range p.positions {
+		if !paths[path] {
+			p.valid = false
+			return
+		}
+	}
+}
+
+func collectYAMLPaths(value interface{}, path string, paths map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childPath := joinPath(path, key)
+			paths[childPath] = true
+			collectYAMLPaths(child, childPath, paths)
+		}
+	case []interface{}:
+		for i, child := range v {
+			childPath := fmt.Sprintf("%v[%v]", path, i)
+			paths[childPath] = true
+			collectYAMLPaths(child, childPath, paths)
+		}
+	}
+}
+
+// lookup returns the position of the given path. Paths within opaque nodes
+// resolve to the position of the opaque node. It returns false if the path
+// can't be located unambiguously.
+func (p yamlPositions) lookup(path string) (yamlPosition, bool) {
+	if !p.valid {
+		return yamlPosition{}, false
+	}
+
+	if position, ok := p.positions[path]; ok {
+		return position, true
+	}
+
+	for path != "" {
+		i := strings.LastIndexAny(path, ".[")
+		if i == -1 {
+			break
+		}
+		path = path[:i]
+
+		if position, ok := p.positions[path]; ok && p.opaque[path] {
+			return position, true
+		} else if ok {
+			break
+		}
+	}
+
+	return yamlPosition{}, false
+}
+
+// splitYAMLKey splits "key: value" into its key and value.
+func splitYAMLKey(content string) (string, string, bool) {
+	if strings.HasPrefix(content, `"`) || strings.HasPrefix(content, "'") {
+		end := strings.Index(content[1:], content[:1])
+		if end == -1 {
+			return "", "", false
+		}
+		key := content[1 : end+1]
+		rest := content[end+2:]
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(strings.TrimPrefix(rest, ":")), true
+	}
+
+	if strings.HasPrefix(content, "{") || strings.HasPrefix(content, "[") {
+		return "", "", false
+	}
+
+	if strings.HasSuffix(content, ":") {
+		return content[:len(content)-1], "", true
+	}
+
+	i := strings.Index(content, ": ")
+	if i == -1 {
+		return "", "", false
+	}
+	return content[:i], strings.TrimSpace(content[i+1:]), true
+}
+
+// stripYAMLProperties removes leading anchors like "&go" and tags like
+// "!!str" of a node.
+func stripYAMLProperties(content string) string {
+	for strings.HasPrefix(content, "&") || strings.HasPrefix(content, "!") {
+		i := strings.Index(content, " ")
+		if i == -1 {
+			return ""
+		}
+		content = strings.TrimLeft(content[i:], " ")
+	}
+	return content
+}
+
+// countFlowBrackets returns the number of brackets opened minus the number of
+// brackets closed outside of quotes.
+func countFlowBrackets(content string) int {
+	count := 0
+	quote := byte(0)
+	for i := 0; i < len(content); i++ {
+		switch {
+		case quote != 0:
+			if content[i] == quote {
+				quote = 0
+			}
+		case content[i] == '"' || content[i] == '\'':
+			quote = content[i]
+		case content[i] == '{' || content[i] == '[':
+			count++
+		case content[i] == '}' || content[i] == ']':
+			count--
+		case content[i] == '#' && (i == 0 || content[i-1] == ' '):
+			return count
+		}
+	}
+	return count
+}
+
+// stripYAMLComment removes a trailing comment outside of quotes.
+func stripYAMLComment(content string) string {
+	quote := byte(0)
+	for i := 0; i < len(content); i++ {
+		switch {
+		case quote != 0:
+			if content[i] == quote {
+				quote = 0
+			}
+		case content[i] == '"' || content[i] == '\'':
+			quote = content[i]
+		case content[i] == '#' && (i == 0 || content[i-1] == ' ' || content[i-1] == '\t'):
+			return content[:i]
+		}
+	}
+	return content
+}
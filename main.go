@@ -1,25 +1,134 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"github.com/mxinden/automation/artifacts"
+	"github.com/mxinden/automation/cache"
 	"github.com/mxinden/automation/configuration"
 	"github.com/mxinden/automation/connector/github"
+	"github.com/mxinden/automation/executor"
 	"github.com/mxinden/automation/executor/kubernetes"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
 	"net/http"
+	"os"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	config, err := configuration.Parse()
 	if err != nil {
 		panic(err)
 	}
 
-	kubernetesExecutor := kubernetes.NewKubernetesExecutor(config.Namespace)
+	artifactStore, artifactImage, err := artifacts.NewStore(config.Artifacts)
+	if err != nil {
+		panic(err)
+	}
+
+	clusters := []kubernetes.Cluster{}
+	for _, c := range config.ExecutionClusters() {
+		client, err := kubernetes.NewClient(clientOptions(c.Kubernetes))
+		if err != nil {
+			panic(fmt.Sprintf("cluster %v: %v", c.Name, err))
+		}
+
+		clusters = append(clusters, kubernetes.Cluster{
+			Name:              c.Name,
+			Labels:            c.Labels,
+			Namespace:         c.Namespace,
+			Client:            client,
+			MaxConcurrentJobs: c.MaxConcurrentJobs,
+		})
+	}
+
+	kubernetesExecutor := kubernetes.NewKubernetesExecutorForClusters(clusters)
+	kubernetesExecutor.SetMasking(config.Masking.Secrets, config.Masking.Values())
+	kubernetesExecutor.SetTestReportsImage(config.TestReports.Image)
+	if artifactStore != nil {
+		kubernetesExecutor.SetArtifactStore(artifactStore, artifactImage)
+		http.HandleFunc("/api/artifacts/", artifacts.Handler(artifactStore, "/api/artifacts/"))
+	}
+
+	cacheStore, cacheImage, err := cache.NewStore(config.Caches)
+	if err != nil {
+		panic(err)
+	}
+	if cacheStore != nil {
+		kubernetesExecutor.SetCacheStore(cacheStore, cacheImage)
+
+		maxAge, maxSize, err := config.Caches.Eviction()
+		if err != nil {
+			panic(err)
+		}
+		go cache.EvictPeriodically(cacheStore, maxAge, maxSize, time.Hour)
+	}
+
+	if config.Isolation.Namespaces {
+		quota, err := config.Isolation.ResourceQuota()
+		if err != nil {
+			panic(err)
+		}
+		defaults, err := config.Resources.Defaults()
+		if err != nil {
+			panic(err)
+		}
+		kubernetesExecutor.SetIsolation(&kubernetes.Isolation{
+			Quota:        quota,
+			Defaults:     defaults,
+			BlockedCIDRs: config.Isolation.BlockedCIDRs,
+		})
+	}
+
 	githubConnector := github.NewGithubConnector(config, &kubernetesExecutor)
 
+	gracePeriod, err := config.ShutdownGracePeriodDuration()
+	if err != nil {
+		panic(err)
+	}
+
+	var shuttingDown int32
+	readinessChecks := map[string]readinessCheck{
+		"github": githubConnector.CheckGithub,
+		"kubernetes": func(ctx context.Context) error {
+			return kubernetesExecutor.CheckClusters()
+		},
+	}
+
 	http.Handle("/metrics", promhttp.Handler())
 	http.HandleFunc("/api/github/trigger", githubConnector.TriggerHandler)
+	http.HandleFunc("/api/schema", schemaHandler)
+	http.HandleFunc("/healthz", healthzHandler)
+	http.HandleFunc("/readyz", readyzHandler(&shuttingDown, readinessChecks))
+
+	serve(newServer(":8080", nil), &githubConnector, &shuttingDown, gracePeriod)
+}
+
+func clientOptions(k configuration.Kubernetes) kubernetes.ClientOptions {
+	return kubernetes.ClientOptions{
+		InCluster:  k.InCluster,
+		Kubeconfig: k.Kubeconfig,
+		Context:    k.Context,
+		QPS:        k.QPS,
+		Burst:      k.Burst,
+	}
+}
+
+// schemaHandler serves the JSON Schema of automation-config.yaml.
+func schemaHandler(w http.ResponseWriter, r *http.Request) {
+	schema, err := executor.JSONSchema()
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "error generating schema", http.StatusInternalServerError)
+		return
+	}
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(schema)
 }
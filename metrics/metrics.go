@@ -0,0 +1,134 @@
+// Package metrics defines the Prometheus metrics of the server, registered
+// with the default registry served at /metrics.
+package metrics
+
+import (
+	"time"
+
+	"github.com/mxinden/automation/executor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "automation"
+
+// Outcomes of executions and steps.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	// OutcomeError is the outcome of executions which could not run to
+	// completion, e.g. because a job could not be created.
+	OutcomeError = "error"
+)
+
+var (
+	WebhooksReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhooks_received_total",
+		Help:      "Webhooks received, by event type.",
+	}, []string{"event"})
+
+	WebhooksRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhooks_rejected_total",
+		Help:      "Webhooks rejected, by event type and reason.",
+	}, []string{"event", "reason"})
+
+	ExecutionsStarted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "executions_started_total",
+		Help:      "Executions started, by repository.",
+	}, []string{"repository"})
+
+	ExecutionsFinished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "executions_finished_total",
+		Help:      "Executions finished, by repository and outcome.",
+	}, []string{"repository", "outcome"})
+
+	StepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "step_duration_seconds",
+		Help:      "Duration of steps from start to completion, by repository and outcome.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	}, []string{"repository", "outcome"})
+
+	StageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stage_duration_seconds",
+		Help:      "Duration of stages from the start of their first to the completion of their last step, by repository.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	}, []string{"repository"})
+
+	StepQueueWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "step_queue_wait_seconds",
+		Help:      "Time steps waited for their cluster to have capacity for another job, by cluster.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 16),
+	}, []string{"cluster"})
+
+	KubernetesAPIErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kubernetes_api_errors_total",
+		Help:      "Failed requests to the Kubernetes API, by status code, or \"error\" if no response was received.",
+	}, []string{"code"})
+
+	GithubAPIDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "github_api_request_duration_seconds",
+		Help:      "Latency of requests to the GitHub API, by method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	GithubRateLimitRemaining = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "github_api_rate_limit_remaining",
+		Help:      "Requests to the GitHub API remaining in the current rate limit window, as of the last response.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		WebhooksReceived,
+		WebhooksRejected,
+		ExecutionsStarted,
+		ExecutionsFinished,
+		StepDuration,
+		StageDuration,
+		StepQueueWait,
+		KubernetesAPIErrors,
+		GithubAPIDuration,
+		GithubRateLimitRemaining,
+	)
+}
+
+// ObserveExecutionResult records the durations of the steps and stages of the
+// given result of an execution of the given repository. Skipped steps and
+// steps without start or completion time are left out.
+func ObserveExecutionResult(repository string, r executor.ExecutionResult) {
+	for _, stage := range r.Stages {
+		var start, completion time.Time
+
+		for _, step := range stage.Steps {
+			if step.Skipped || step.StartTime.IsZero() || step.CompletionTime.IsZero() {
+				continue
+			}
+
+			outcome := OutcomeFailure
+			if step.DidSucceed() {
+				outcome = OutcomeSuccess
+			}
+			StepDuration.WithLabelValues(repository, outcome).Observe(step.CompletionTime.Sub(step.StartTime).Seconds())
+
+			if start.IsZero() || step.StartTime.Before(start) {
+				start = step.StartTime
+			}
+			if step.CompletionTime.After(completion) {
+				completion = step.CompletionTime
+			}
+		}
+
+		if !start.IsZero() {
+			StageDuration.WithLabelValues(repository).Observe(completion.Sub(start).Seconds())
+		}
+	}
+}
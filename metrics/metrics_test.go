@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mxinden/automation/executor"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func sampleCount(t *testing.T, h prometheus.Histogram) uint64 {
+	m := dto.Metric{}
+	err := h.Write(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func sampleSum(t *testing.T, h prometheus.Histogram) float64 {
+	m := dto.Metric{}
+	err := h.Write(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleSum()
+}
+
+func value(t *testing.T, c prometheus.Metric) float64 {
+	m := dto.Metric{}
+	err := c.Write(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Gauge != nil {
+		return m.GetGauge().GetValue()
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestObserveExecutionResult(t *testing.T) {
+	repository := "github.com/mxinden/observe"
+	start := time.Now()
+
+	r := executor.ExecutionResult{
+		Stages: []executor.StageResult{
+			{
+				Steps: []executor.StepResult{
+					{StartTime: start, CompletionTime: start.Add(10 * time.Second)},
+					{StartTime: start.Add(5 * time.Second), CompletionTime: start.Add(30 * time.Second), Containers: []executor.ContainerResult{{ExitCode: 1, State: executor.ContainerStateTerminated}}},
+					{Skipped: true},
+				},
+			},
+		},
+	}
+
+	ObserveExecutionResult(repository, r)
+
+	if count := sampleCount(t, StepDuration.WithLabelValues(repository, OutcomeSuccess)); count != 1 {
+		t.Fatalf("expected 1 successful step but got %v", count)
+	}
+	if count := sampleCount(t, StepDuration.WithLabelValues(repository, OutcomeFailure)); count != 1 {
+		t.Fatalf("expected 1 failed step but got %v", count)
+	}
+	if sum := sampleSum(t, StageDuration.WithLabelValues(repository)); sum != 30 {
+		t.Fatalf("expected stage to last from its first start to its last completion, 30s, but got %v", sum)
+	}
+}
+
+func TestGithubTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "4321")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: GithubTransport(nil)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if count := sampleCount(t, GithubAPIDuration.WithLabelValues("GET", "418")); count != 1 {
+		t.Fatalf("expected 1 request to be observed but got %v", count)
+	}
+	if remaining := value(t, GithubRateLimitRemaining); remaining != 4321 {
+		t.Fatalf("expected remaining rate limit 4321 but got %v", remaining)
+	}
+}
+
+func TestKubernetesTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/conflict":
+			w.WriteHeader(http.StatusConflict)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: KubernetesTransport(http.DefaultTransport)}
+	for _, path := range []string{"/ok", "/missing", "/conflict"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if errors := value(t, KubernetesAPIErrors.WithLabelValues("409")); errors != 1 {
+		t.Fatalf("expected 1 conflict to be counted but got %v", errors)
+	}
+	if errors := value(t, KubernetesAPIErrors.WithLabelValues("404")); errors != 0 {
+		t.Fatalf("expected not found responses not to be counted but got %v", errors)
+	}
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// roundTripperFunc turns a function into an http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// GithubTransport records the latency of the requests made through the given
+// transport and the remaining rate limit GitHub reports in its responses. A
+// nil transport means http.DefaultTransport.
+func GithubTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(r)
+
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+
+			remaining, parseErr := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+			if parseErr == nil {
+				GithubRateLimitRemaining.Set(float64(remaining))
+			}
+		}
+		GithubAPIDuration.WithLabelValues(r.Method, code).Observe(time.Since(start).Seconds())
+
+		return resp, err
+	})
+}
+
+// KubernetesTransport counts the failed requests made through the given
+// transport. Not found responses are expected, e.g. when looking up optional
+// secrets, thus they are not counted.
+func KubernetesTransport(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		resp, err := next.RoundTrip(r)
+
+		switch {
+		case err != nil:
+			KubernetesAPIErrors.WithLabelValues("error").Inc()
+		case resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound:
+			KubernetesAPIErrors.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+		}
+
+		return resp, err
+	})
+}
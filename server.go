@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// readinessCheckTimeout bounds each request to /readyz, as probes
+	// time out themselves.
+	readinessCheckTimeout = 5 * time.Second
+	// requestShutdownTimeout is the time requests still being served, e.g.
+	// artifact downloads, get once all executions finished.
+	requestShutdownTimeout = 10 * time.Second
+)
+
+// newServer returns a server with timeouts, so slow or stuck clients can't
+// hold on to connections forever. Writes get plenty of time, as artifacts are
+// downloaded through the server.
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      10 * time.Minute,
+		IdleTimeout:       2 * time.Minute,
+	}
+}
+
+// healthzHandler serves whether the server is alive, which it is as long as
+// it serves requests.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// readinessCheck returns an error unless a dependency of the server works.
+type readinessCheck func(ctx context.Context) error
+
+// readyzHandler serves whether all given checks pass. Once the server is
+// shutting down, it is never ready.
+func readyzHandler(shuttingDown *int32, checks map[string]readinessCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(shuttingDown) != 0 {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+		defer cancel()
+
+		names := []string{}
+		for name := range checks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		failures := []string{}
+		for _, name := range names {
+			err := runCheck(ctx, checks[name])
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%v: %v", name, err))
+			}
+		}
+
+		if len(failures) != 0 {
+			http.Error(w, strings.Join(failures, "\n"), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// runCheck runs the given check, but gives up once the given context is done,
+// as not all clients take a context.
+func runCheck(ctx context.Context, check readinessCheck) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- check(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// executions are the executions of the server, e.g. of the GitHub connector.
+type executions interface {
+	// Shutdown stops starting executions and waits for the running ones
+	// until the given context is done.
+	Shutdown(ctx context.Context) error
+}
+
+// serve serves until the process is asked to terminate. It then stops
+// starting executions for new webhooks, waits up to the given grace period
+// for the running executions and shuts the server down.
+func serve(server *http.Server, connector executions, shuttingDown *int32, gracePeriod time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		log.Fatal(err)
+	case s := <-signals:
+		log.Printf("received %v, shutting down", s)
+	}
+
+	drain(server, connector, shuttingDown, gracePeriod)
+}
+
+// drain shuts the server down once the running executions finished, but at
+// most after the given grace period.
+func drain(server *http.Server, connector executions, shuttingDown *int32, gracePeriod time.Duration) {
+	// The server keeps on serving while executions finish, e.g. artifacts,
+	// but reports not to be ready to receive further webhooks.
+	atomic.StoreInt32(shuttingDown, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+	err := connector.Shutdown(ctx)
+	if err != nil {
+		log.Printf("handed off executions still running after %v: %v", gracePeriod, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), requestShutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	if err != nil {
+		log.Printf("failed to shut down server: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadyzHandler(t *testing.T) {
+	var shuttingDown int32
+	failing := false
+	checks := map[string]readinessCheck{
+		"github": func(ctx context.Context) error {
+			if failing {
+				return errors.New("unauthorized")
+			}
+			return nil
+		},
+		"kubernetes": func(ctx context.Context) error { return nil },
+	}
+	handler := readyzHandler(&shuttingDown, checks)
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected to be ready but got %v: %v", recorder.Code, recorder.Body)
+	}
+
+	failing = true
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable || !strings.Contains(recorder.Body.String(), "github: unauthorized") {
+		t.Fatalf("expected failing check to be reported but got %v: %v", recorder.Code, recorder.Body)
+	}
+
+	failing = false
+	shuttingDown = 1
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected not to be ready once shutting down but got %v", recorder.Code)
+	}
+}
+
+func TestReadyzHandlerCheckTimeout(t *testing.T) {
+	var shuttingDown int32
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	// The check ignores its context, like clients not taking one.
+	checks := map[string]readinessCheck{
+		"stuck": func(ctx context.Context) error {
+			<-unblock
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	recorder := httptest.NewRecorder()
+	readyzHandler(&shuttingDown, checks)(recorder, httptest.NewRequest("GET", "/readyz", nil).WithContext(ctx))
+
+	if recorder.Code != http.StatusServiceUnavailable || !strings.Contains(recorder.Body.String(), "stuck: context deadline exceeded") {
+		t.Fatalf("expected stuck check to time out but got %v: %v", recorder.Code, recorder.Body)
+	}
+}
+
+// blockingExecutions finish once released.
+type blockingExecutions struct {
+	shutdown chan struct{}
+	release  chan struct{}
+}
+
+func (e *blockingExecutions) Shutdown(ctx context.Context) error {
+	close(e.shutdown)
+	select {
+	case <-e.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestDrainKeepsServingHealthz(t *testing.T) {
+	var shuttingDown int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler(&shuttingDown, nil))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newServer(listener.Addr().String(), mux)
+	go server.Serve(listener)
+
+	executions := &blockingExecutions{shutdown: make(chan struct{}), release: make(chan struct{})}
+	drained := make(chan struct{})
+	go func() {
+		drain(server, executions, &shuttingDown, time.Minute)
+		close(drained)
+	}()
+	<-executions.shutdown
+
+	get := func(path string) int {
+		resp, err := http.Get("http://" + listener.Addr().String() + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Fatalf("expected to be alive while draining but got %v", code)
+	}
+	if code := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected not to be ready while draining but got %v", code)
+	}
+
+	close(executions.release)
+	select {
+	case <-drained:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected server to shut down once executions finished")
+	}
+
+	_, err = http.Get("http://" + listener.Addr().String() + "/healthz")
+	if err == nil {
+		t.Fatal("expected server to be shut down")
+	}
+}